@@ -0,0 +1,72 @@
+package analytics
+
+import (
+	"context"
+	"time"
+
+	"github.com/fatah-illah/asset-finder/models"
+	"github.com/fatah-illah/asset-finder/utils"
+	"gorm.io/gorm"
+)
+
+// cooccurrenceLockKey keeps replicas from refreshing the snapshot at the same time
+const cooccurrenceLockKey = 7_236_419_502
+
+// cooccurrencesSQL counts the posts shared by every pair of tags and their lift,
+// P(a,b) / (P(a) P(b)), over the posts having at least one tag
+const cooccurrencesSQL = `INSERT INTO tag_cooccurrences (tag_id, related_tag_id, support, lift, refreshed_at)
+WITH usage AS (
+	SELECT tag_id, COUNT(*) AS posts FROM post_tags GROUP BY tag_id
+), total AS (
+	SELECT COUNT(DISTINCT post_id) AS posts FROM post_tags
+), pairs AS (
+	SELECT a.tag_id AS tag_id, b.tag_id AS related_tag_id, COUNT(*) AS support
+	FROM post_tags a
+	JOIN post_tags b ON b.post_id = a.post_id AND b.tag_id <> a.tag_id
+	GROUP BY a.tag_id, b.tag_id
+	HAVING COUNT(*) >= ?
+)
+SELECT pairs.tag_id, pairs.related_tag_id, pairs.support,
+	1.0 * pairs.support * total.posts / (usage_a.posts * usage_b.posts), ?
+FROM pairs
+JOIN usage usage_a ON usage_a.tag_id = pairs.tag_id
+JOIN usage usage_b ON usage_b.tag_id = pairs.related_tag_id
+CROSS JOIN total`
+
+// RefreshCooccurrences rebuilds the tag co-occurrence snapshot, keeping the pairs
+// sharing at least minSupport posts. It returns the number of stored pairs, or
+// -1 when another replica is already refreshing.
+func RefreshCooccurrences(ctx context.Context, db *gorm.DB, minSupport int) (int64, error) {
+	var pairs int64
+	start := time.Now()
+
+	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if tx.Dialector.Name() == "postgres" {
+			var locked bool
+			if err := tx.Raw("SELECT pg_try_advisory_xact_lock(?)", cooccurrenceLockKey).Scan(&locked).Error; err != nil {
+				return err
+			}
+			if !locked {
+				pairs = -1
+				return nil
+			}
+		}
+
+		if err := tx.Where("1 = 1").Delete(&models.TagCooccurrence{}).Error; err != nil {
+			return err
+		}
+
+		result := tx.Exec(cooccurrencesSQL, minSupport, time.Now())
+		pairs = result.RowsAffected
+		return result.Error
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if pairs >= 0 {
+		utils.Logger(ctx).Info().Int64("pairs", pairs).Dur("elapsed", time.Since(start)).Msg("Tag co-occurrences refreshed")
+	}
+
+	return pairs, nil
+}
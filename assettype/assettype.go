@@ -0,0 +1,83 @@
+// Package assettype validates the metadata of posts against the JSON Schema of
+// their asset type.
+package assettype
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+// schemaURL names the compiled schema, the schemas are self-contained
+const schemaURL = "mem:///asset-type.json"
+
+// Violation is a part of the metadata failing the schema, Path is a JSON pointer
+// to the offending value, empty for the metadata itself
+type Violation struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+// Schema is a compiled asset type schema
+type Schema struct {
+	compiled *jsonschema.Schema
+}
+
+// Compile compiles a JSON Schema, draft 2020-12 unless it declares another draft
+// with $schema. References to other documents are rejected.
+func Compile(document string) (*Schema, error) {
+	compiler := jsonschema.NewCompiler()
+	compiler.Draft = jsonschema.Draft2020
+	compiler.LoadURL = func(url string) (io.ReadCloser, error) {
+		return nil, fmt.Errorf("external reference %q is not allowed", url)
+	}
+
+	if err := compiler.AddResource(schemaURL, strings.NewReader(document)); err != nil {
+		return nil, err
+	}
+	compiled, err := compiler.Compile(schemaURL)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Schema{compiled: compiled}, nil
+}
+
+// Validate returns the violations of metadata, sorted by path, none when it is valid
+func (s *Schema) Validate(metadata map[string]interface{}) ([]Violation, error) {
+	if metadata == nil {
+		metadata = map[string]interface{}{}
+	}
+
+	err := s.compiled.Validate(metadata)
+	if err == nil {
+		return nil, nil
+	}
+
+	var validationError *jsonschema.ValidationError
+	if !errors.As(err, &validationError) {
+		return nil, err
+	}
+
+	var violations []Violation
+	collect(validationError, &violations)
+	sort.SliceStable(violations, func(i, j int) bool { return violations[i].Path < violations[j].Path })
+
+	return violations, nil
+}
+
+// collect appends the root causes of a validation error, the enclosing errors
+// only repeat that a subschema failed
+func collect(validationError *jsonschema.ValidationError, violations *[]Violation) {
+	if len(validationError.Causes) == 0 {
+		*violations = append(*violations, Violation{Path: validationError.InstanceLocation, Message: validationError.Message})
+		return
+	}
+	for _, cause := range validationError.Causes {
+		collect(cause, violations)
+	}
+}
@@ -0,0 +1,83 @@
+// Package autotag matches the auto-tagging rules against the title and content
+// of the posts.
+package autotag
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/fatah-illah/asset-finder/models"
+)
+
+// Fields a rule matches
+const (
+	FieldTitle   = "title"
+	FieldContent = "content"
+	FieldAny     = "any"
+)
+
+// Kinds of patterns
+const (
+	MatchRegex   = "regex"
+	MatchKeyword = "keyword"
+)
+
+// Rule is an auto-tagging rule with its compiled pattern
+type Rule struct {
+	models.AutoTagRule
+	expr *regexp.Regexp
+}
+
+// Compile returns the expression of a pattern: a regular expression, or for a
+// keyword the keyword as a whole word, ignoring case
+func Compile(matchType, pattern string) (*regexp.Regexp, error) {
+	switch matchType {
+	case MatchRegex:
+		return regexp.Compile(pattern)
+	case MatchKeyword:
+		return regexp.Compile(`(?i)(?:^|[^\pL\pN_])` + regexp.QuoteMeta(pattern) + `(?:$|[^\pL\pN_])`)
+	default:
+		return nil, fmt.Errorf("unknown match type %q", matchType)
+	}
+}
+
+func NewRule(rule models.AutoTagRule) (Rule, error) {
+	expr, err := Compile(rule.MatchType, rule.Pattern)
+	if err != nil {
+		return Rule{}, fmt.Errorf("auto-tagging rule %d: %w", rule.ID, err)
+	}
+	return Rule{AutoTagRule: rule, expr: expr}, nil
+}
+
+// Matches reports whether the rule matches a post
+func (r Rule) Matches(title, content string) bool {
+	switch r.Field {
+	case FieldTitle:
+		return r.expr.MatchString(title)
+	case FieldContent:
+		return r.expr.MatchString(content)
+	default:
+		return r.expr.MatchString(title) || r.expr.MatchString(content)
+	}
+}
+
+// Tags returns the tags of the rules matching a post in the order of the rules,
+// each tag once
+func Tags(rules []Rule, title, content string) []models.Tag {
+	var tags []models.Tag
+	seen := make(map[uint]bool)
+
+	for _, rule := range rules {
+		if !rule.Matches(title, content) {
+			continue
+		}
+		for _, tag := range rule.Tags {
+			if !seen[tag.ID] {
+				seen[tag.ID] = true
+				tags = append(tags, tag)
+			}
+		}
+	}
+
+	return tags
+}
@@ -1,22 +1,396 @@
 package config
 
 import (
-	"github.com/rs/zerolog/log"
-	"github.com/spf13/viper"
+	"errors"
+	"fmt"
+	"net"
+	"reflect"
+	"regexp"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/fatah-illah/asset-finder/workflow"
+	"github.com/rs/zerolog"
 )
 
-func InitConfig(fileName string) *viper.Viper {
-	config := viper.New()
+var sha256Pattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// Config is the typed configuration of the service. See asset_finder.toml for
+// the matching keys; every key can be overridden with an ASSET_FINDER_* variable.
+type Config struct {
+	Log         LogConfig         `mapstructure:"log"`
+	Database    DatabaseConfig    `mapstructure:"database"`
+	HTTP        HTTPConfig        `mapstructure:"http"`
+	RateLimit   RateLimitConfig   `mapstructure:"rate_limit"`
+	Metrics     MetricsConfig     `mapstructure:"metrics"`
+	Tracing     TracingConfig     `mapstructure:"tracing"`
+	Tags        TagsConfig        `mapstructure:"tags"`
+	Attachments AttachmentsConfig `mapstructure:"attachments"`
+	Auth        AuthConfig        `mapstructure:"auth"`
+	Workflow    WorkflowConfig    `mapstructure:"workflow"`
+}
+
+type LogConfig struct {
+	Level string `mapstructure:"level"`
+}
+
+type DatabaseConfig struct {
+	ConnectionString      string        `mapstructure:"connection_string"`
+	MaxIdleConnections    int           `mapstructure:"max_idle_connections"`
+	MaxOpenConnections    int           `mapstructure:"max_open_connections"`
+	ConnectionMaxLifetime time.Duration `mapstructure:"connection_max_lifetime"`
+	SlowQueryThreshold    time.Duration `mapstructure:"slow_query_threshold"`
+}
+
+type HTTPConfig struct {
+	ServerAddress      string        `mapstructure:"server_address"`
+	ShutdownDrainDelay time.Duration `mapstructure:"shutdown_drain_delay"`
+	ShutdownTimeout    time.Duration `mapstructure:"shutdown_timeout"`
+	// TrustedProxies lists the addresses or CIDRs of the reverse proxies whose
+	// X-Forwarded-For header gives the client IP, none are trusted by default
+	TrustedProxies []string `mapstructure:"trusted_proxies"`
+}
+
+type RateLimitConfig struct {
+	Enabled bool                           `mapstructure:"enabled"`
+	Default RateLimitRuleConfig            `mapstructure:"default"`
+	Groups  map[string]RateLimitRuleConfig `mapstructure:"groups"`
+}
+
+type RateLimitRuleConfig struct {
+	Requests int           `mapstructure:"requests"`
+	Period   time.Duration `mapstructure:"period"`
+	Burst    int           `mapstructure:"burst"`
+}
+
+type MetricsConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+}
+
+type TracingConfig struct {
+	Exporter    string     `mapstructure:"exporter"`
+	ServiceName string     `mapstructure:"service_name"`
+	SampleRatio float64    `mapstructure:"sample_ratio"`
+	OTLP        OTLPConfig `mapstructure:"otlp"`
+}
+
+type OTLPConfig struct {
+	Endpoint string `mapstructure:"endpoint"`
+	Insecure bool   `mapstructure:"insecure"`
+}
+
+type TagsConfig struct {
+	Normalization TagNormalizationConfig `mapstructure:"normalization"`
+	Cooccurrence  CooccurrenceConfig     `mapstructure:"cooccurrence"`
+	// Namespaces holds the rules of the tag namespaces, keyed by namespace
+	Namespaces map[string]TagNamespaceConfig `mapstructure:"namespaces"`
+}
+
+type TagNamespaceConfig struct {
+	// MaxPerPost limits the tags of the namespace a post can have, 0 is unlimited
+	MaxPerPost int `mapstructure:"max_per_post"`
+}
+
+type TagNormalizationConfig struct {
+	Trim               bool `mapstructure:"trim"`
+	NFC                bool `mapstructure:"nfc"`
+	CaseFold           bool `mapstructure:"case_fold"`
+	CollapseWhitespace bool `mapstructure:"collapse_whitespace"`
+}
+
+type CooccurrenceConfig struct {
+	RefreshInterval time.Duration `mapstructure:"refresh_interval"`
+	MinSupport      int           `mapstructure:"min_support"`
+}
+
+type AttachmentsConfig struct {
+	// Storage is the blob store backend, local or s3
+	Storage string `mapstructure:"storage"`
+	// MaxSize is the largest accepted upload in bytes
+	MaxSize int64 `mapstructure:"max_size"`
+	// AllowedMIMETypes lists the accepted content types, any type when empty
+	AllowedMIMETypes []string `mapstructure:"allowed_mime_types"`
+	// AutoTag adds a type:<kind> tag, such as type:image, to the posts of the uploads
+	AutoTag    bool               `mapstructure:"auto_tag"`
+	Local      LocalStorageConfig `mapstructure:"local"`
+	S3         S3StorageConfig    `mapstructure:"s3"`
+	Thumbnails ThumbnailsConfig   `mapstructure:"thumbnails"`
+}
+
+type ThumbnailsConfig struct {
+	// Sizes are the bounding boxes in pixels of the thumbnails of the images,
+	// none disables the thumbnails
+	Sizes     []int `mapstructure:"sizes"`
+	Workers   int   `mapstructure:"workers"`
+	QueueSize int   `mapstructure:"queue_size"`
+	// BackfillInterval is how often the images missing thumbnails are queued,
+	// 0 disables the backfill
+	BackfillInterval time.Duration `mapstructure:"backfill_interval"`
+}
+
+type LocalStorageConfig struct {
+	Path string `mapstructure:"path"`
+}
+
+type S3StorageConfig struct {
+	Endpoint        string `mapstructure:"endpoint"`
+	Region          string `mapstructure:"region"`
+	Bucket          string `mapstructure:"bucket"`
+	AccessKeyID     string `mapstructure:"access_key_id"`
+	SecretAccessKey string `mapstructure:"secret_access_key"`
+	UseSSL          bool   `mapstructure:"use_ssl"`
+}
+
+type AuthConfig struct {
+	KeyHeader string                  `mapstructure:"key_header"`
+	Keys      map[string]APIKeyConfig `mapstructure:"keys"`
+}
+
+// APIKeyConfig identifies the user it is keyed by, only the SHA-256 of the key
+// is configured
+type APIKeyConfig struct {
+	KeySHA256 string `mapstructure:"key_sha256"`
+	Role      string `mapstructure:"role"`
+}
+
+type WorkflowConfig struct {
+	Permissions       map[string][]string `mapstructure:"permissions"`
+	SchedulerInterval time.Duration       `mapstructure:"scheduler_interval"`
+}
+
+// defaults are applied before the configuration files and the environment
+var defaults = map[string]interface{}{
+	"log.level": "info",
+
+	"database.connection_string":       "",
+	"database.max_idle_connections":    5,
+	"database.max_open_connections":    20,
+	"database.connection_max_lifetime": "60s",
+	"database.slow_query_threshold":    "200ms",
+
+	"http.server_address":       ":8000",
+	"http.shutdown_drain_delay": "5s",
+	"http.shutdown_timeout":     "15s",
+	"http.trusted_proxies":      []string{},
+
+	"rate_limit.enabled":          true,
+	"rate_limit.default.requests": 120,
+	"rate_limit.default.period":   "1m",
+	"rate_limit.default.burst":    30,
+
+	"metrics.enabled": true,
+
+	"tracing.exporter":      "none",
+	"tracing.service_name":  "asset-finder",
+	"tracing.sample_ratio":  1.0,
+	"tracing.otlp.endpoint": "localhost:4318",
+	"tracing.otlp.insecure": false,
 
-	config.SetConfigName(fileName)
+	"tags.normalization.trim":                true,
+	"tags.normalization.nfc":                 true,
+	"tags.normalization.case_fold":           true,
+	"tags.normalization.collapse_whitespace": true,
+	"tags.cooccurrence.refresh_interval":     "15m",
+	"tags.cooccurrence.min_support":          2,
+
+	"attachments.storage":                      "local",
+	"attachments.max_size":                     50 << 20,
+	"attachments.allowed_mime_types":           []string{},
+	"attachments.auto_tag":                     false,
+	"attachments.thumbnails.sizes":             []int{128, 512},
+	"attachments.thumbnails.workers":           2,
+	"attachments.thumbnails.queue_size":        256,
+	"attachments.thumbnails.backfill_interval": "1h",
+	"attachments.local.path":                   "uploads",
+	"attachments.s3.endpoint":                  "",
+	"attachments.s3.region":                    "",
+	"attachments.s3.bucket":                    "",
+	"attachments.s3.access_key_id":             "",
+	"attachments.s3.secret_access_key":         "",
+	"attachments.s3.use_ssl":                   true,
+
+	"auth.key_header": "X-API-Key",
+
+	"workflow.permissions.submit":  []string{"author", "editor", "admin"},
+	"workflow.permissions.approve": []string{"editor", "admin"},
+	"workflow.permissions.reject":  []string{"editor", "admin"},
+	"workflow.permissions.archive": []string{"editor", "admin"},
+	"workflow.scheduler_interval":  "1m",
+}
+
+// secrets can be loaded from a file named by the <key>_file setting, e.g.
+// ASSET_FINDER_DATABASE_CONNECTION_STRING_FILE=/run/secrets/dsn
+var secrets = []string{
+	"database.connection_string",
+	"attachments.s3.secret_access_key",
+}
+
+// Validate reports every invalid setting at once
+func (c *Config) Validate() error {
+	var errs []error
+	invalid := func(key, format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf("%s: "+format, append([]interface{}{key}, args...)...))
+	}
+
+	if _, err := zerolog.ParseLevel(c.Log.Level); err != nil || c.Log.Level == "" {
+		invalid("log.level", "unknown level %q", c.Log.Level)
+	}
+
+	if c.Database.ConnectionString == "" {
+		invalid("database.connection_string", "is required")
+	}
+	if c.Database.MaxOpenConnections < 0 {
+		invalid("database.max_open_connections", "must not be negative")
+	}
+	if c.Database.MaxIdleConnections < 0 {
+		invalid("database.max_idle_connections", "must not be negative")
+	}
+	if c.Database.MaxOpenConnections > 0 && c.Database.MaxIdleConnections > c.Database.MaxOpenConnections {
+		invalid("database.max_idle_connections", "must not exceed database.max_open_connections")
+	}
+	if c.Database.ConnectionMaxLifetime < 0 {
+		invalid("database.connection_max_lifetime", "must not be negative")
+	}
+
+	if c.HTTP.ServerAddress == "" {
+		invalid("http.server_address", "is required")
+	}
+	if c.HTTP.ShutdownDrainDelay < 0 {
+		invalid("http.shutdown_drain_delay", "must not be negative")
+	}
+	if c.HTTP.ShutdownTimeout <= 0 {
+		invalid("http.shutdown_timeout", "must be positive")
+	}
+	for _, proxy := range c.HTTP.TrustedProxies {
+		if _, _, err := net.ParseCIDR(proxy); err != nil && net.ParseIP(proxy) == nil {
+			invalid("http.trusted_proxies", "must be IP addresses or CIDRs, got %q", proxy)
+		}
+	}
+
+	validateRule := func(key string, rule RateLimitRuleConfig) {
+		if rule.Requests < 0 || rule.Burst < 0 {
+			invalid(key, "requests and burst must not be negative")
+		}
+		if rule.Requests > 0 && rule.Period <= 0 {
+			invalid(key+".period", "must be positive")
+		}
+	}
+	validateRule("rate_limit.default", c.RateLimit.Default)
+	for group, rule := range c.RateLimit.Groups {
+		validateRule("rate_limit.groups."+group, rule)
+	}
+
+	switch c.Tracing.Exporter {
+	case "otlp":
+		if c.Tracing.OTLP.Endpoint == "" {
+			invalid("tracing.otlp.endpoint", "is required with the otlp exporter")
+		}
+	case "stdout", "none":
+	default:
+		invalid("tracing.exporter", "must be one of otlp, stdout or none, got %q", c.Tracing.Exporter)
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		invalid("tracing.sample_ratio", "must be between 0 and 1")
+	}
+
+	if c.Tags.Cooccurrence.RefreshInterval < 0 {
+		invalid("tags.cooccurrence.refresh_interval", "must not be negative")
+	}
+	if c.Tags.Cooccurrence.MinSupport < 1 {
+		invalid("tags.cooccurrence.min_support", "must be at least 1")
+	}
+	for namespace, rule := range c.Tags.Namespaces {
+		if rule.MaxPerPost < 0 {
+			invalid("tags.namespaces."+namespace+".max_per_post", "must not be negative")
+		}
+	}
+
+	switch c.Attachments.Storage {
+	case "local":
+		if c.Attachments.Local.Path == "" {
+			invalid("attachments.local.path", "is required with the local storage")
+		}
+	case "s3":
+		if c.Attachments.S3.Endpoint == "" {
+			invalid("attachments.s3.endpoint", "is required with the s3 storage")
+		}
+		if c.Attachments.S3.Bucket == "" {
+			invalid("attachments.s3.bucket", "is required with the s3 storage")
+		}
+	default:
+		invalid("attachments.storage", "must be local or s3, got %q", c.Attachments.Storage)
+	}
+	if c.Attachments.MaxSize <= 0 {
+		invalid("attachments.max_size", "must be positive")
+	}
+	for _, size := range c.Attachments.Thumbnails.Sizes {
+		if size < 16 || size > 4096 {
+			invalid("attachments.thumbnails.sizes", "must be between 16 and 4096 pixels, got %d", size)
+		}
+	}
+	if c.Attachments.Thumbnails.Workers < 1 {
+		invalid("attachments.thumbnails.workers", "must be at least 1")
+	}
+	if c.Attachments.Thumbnails.QueueSize < 1 {
+		invalid("attachments.thumbnails.queue_size", "must be at least 1")
+	}
+	if c.Attachments.Thumbnails.BackfillInterval < 0 {
+		invalid("attachments.thumbnails.backfill_interval", "must not be negative")
+	}
+
+	if c.Auth.KeyHeader == "" {
+		invalid("auth.key_header", "is required")
+	}
+	hashes := make(map[string]string, len(c.Auth.Keys))
+	for user, key := range c.Auth.Keys {
+		if !sha256Pattern.MatchString(key.KeySHA256) {
+			invalid("auth.keys."+user+".key_sha256", "must be the lowercase hex SHA-256 of the key")
+		} else if other, ok := hashes[key.KeySHA256]; ok {
+			invalid("auth.keys."+user+".key_sha256", "is also the key of %s", other)
+		}
+		hashes[key.KeySHA256] = user
+		if !slices.Contains(workflow.Roles, key.Role) {
+			invalid("auth.keys."+user+".role", "must be one of %v, got %q", workflow.Roles, key.Role)
+		}
+	}
+
+	if c.Workflow.SchedulerInterval < 0 {
+		invalid("workflow.scheduler_interval", "must not be negative")
+	}
+	for transition, roles := range c.Workflow.Permissions {
+		if t, ok := workflow.Lookup(transition); !ok || t.Scheduled {
+			invalid("workflow.permissions."+transition, "unknown transition, expected one of %v", workflow.Names())
+		}
+		for _, role := range roles {
+			if !slices.Contains(workflow.Roles, role) {
+				invalid("workflow.permissions."+transition, "unknown role %q, expected one of %v", role, workflow.Roles)
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
 
-	config.AddConfigPath(".")
-	config.AddConfigPath("$HOME")
+// RestartRequired lists the sections changed in next which are only applied at
+// startup. The log, rate_limit and auth sections are hot reloaded.
+func (c *Config) RestartRequired(next *Config) []string {
+	var sections []string
 
-	err := config.ReadInConfig()
-	if err != nil {
-		log.Fatal().Err(err).Msg("Error while parsing configuration file")
+	for name, changed := range map[string]bool{
+		"database":    !reflect.DeepEqual(c.Database, next.Database),
+		"http":        !reflect.DeepEqual(c.HTTP, next.HTTP),
+		"metrics":     !reflect.DeepEqual(c.Metrics, next.Metrics),
+		"tracing":     !reflect.DeepEqual(c.Tracing, next.Tracing),
+		"tags":        !reflect.DeepEqual(c.Tags, next.Tags),
+		"attachments": !reflect.DeepEqual(c.Attachments, next.Attachments),
+		"workflow":    !reflect.DeepEqual(c.Workflow, next.Workflow),
+	} {
+		if changed {
+			sections = append(sections, name)
+		}
 	}
+	sort.Strings(sections)
 
-	return config
+	return sections
 }
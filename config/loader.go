@@ -0,0 +1,225 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/pelletier/go-toml/v2"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
+)
+
+const (
+	fileName  = "asset_finder"
+	envPrefix = "ASSET_FINDER"
+	redacted  = "<redacted>"
+)
+
+var profilePattern = regexp.MustCompile(`^[a-z0-9_-]+$`)
+
+// Profile returns the configuration profile (dev, staging, prod, ...) from
+// ASSET_FINDER_PROFILE, falling back to the legacy ENV variable.
+func Profile() string {
+	if profile := os.Getenv(envPrefix + "_PROFILE"); profile != "" {
+		return profile
+	}
+	return os.Getenv("ENV")
+}
+
+// Loader layers the configuration: defaults, asset_finder.toml, the profile file
+// asset_finder.<profile>.toml, ASSET_FINDER_* environment variables and secret files.
+type Loader struct {
+	profile string
+
+	mu      sync.Mutex
+	files   []string
+	current *Config
+}
+
+func NewLoader(profile string) *Loader {
+	return &Loader{profile: profile}
+}
+
+// Load reads and validates the configuration
+func (l *Loader) Load() (*Config, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	v, files, err := l.read()
+	if err != nil {
+		return nil, err
+	}
+
+	var config Config
+	if err := v.Unmarshal(&config); err != nil {
+		return nil, fmt.Errorf("decoding configuration: %w", err)
+	}
+
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration:\n%w", err)
+	}
+
+	l.files = files
+	l.current = &config
+
+	return &config, nil
+}
+
+// Watch reloads the configuration whenever one of its files changes. Invalid
+// changes are logged and ignored; onChange receives the new valid configuration.
+func (l *Loader) Watch(onChange func(*Config)) {
+	l.mu.Lock()
+	files := l.files
+	l.mu.Unlock()
+
+	for _, file := range files {
+		watcher := viper.New()
+		watcher.SetConfigFile(file)
+		if err := watcher.ReadInConfig(); err != nil {
+			log.Warn().Err(err).Str("file", file).Msg("Unable to watch configuration file")
+			continue
+		}
+
+		watcher.OnConfigChange(func(event fsnotify.Event) {
+			l.mu.Lock()
+			previous := l.current
+			l.mu.Unlock()
+
+			next, err := l.Load()
+			if err != nil {
+				log.Error().Err(err).Str("file", event.Name).Msg("Ignoring configuration change")
+				return
+			}
+
+			if sections := previous.RestartRequired(next); len(sections) > 0 {
+				log.Warn().Strs("sections", sections).Msg("Configuration changes require a restart to apply")
+			}
+
+			log.Info().Str("file", event.Name).Msg("Configuration reloaded")
+			onChange(next)
+		})
+		watcher.WatchConfig()
+	}
+}
+
+// Print writes the effective configuration as TOML with secrets redacted,
+// then reports whether it is valid.
+func (l *Loader) Print(w io.Writer) error {
+	v, files, err := l.read()
+	if err != nil {
+		return err
+	}
+
+	settings := v.AllSettings()
+	for _, key := range secrets {
+		redact(settings, strings.Split(key, "."))
+	}
+
+	out, err := toml.Marshal(settings)
+	if err != nil {
+		return err
+	}
+
+	if _, err := fmt.Fprintf(w, "# profile: %q, files: %s\n\n%s", l.profile, strings.Join(files, ", "), out); err != nil {
+		return err
+	}
+
+	var config Config
+	if err := v.Unmarshal(&config); err != nil {
+		return err
+	}
+	return config.Validate()
+}
+
+func (l *Loader) read() (*viper.Viper, []string, error) {
+	if l.profile != "" && !profilePattern.MatchString(l.profile) {
+		return nil, nil, fmt.Errorf("invalid configuration profile %q", l.profile)
+	}
+
+	v := viper.New()
+
+	keys := make([]string, 0, len(defaults))
+	for key := range defaults {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		v.SetDefault(key, defaults[key])
+	}
+
+	v.SetEnvPrefix(envPrefix)
+	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	v.AutomaticEnv()
+
+	v.AddConfigPath(".")
+	v.AddConfigPath("$HOME")
+
+	var files []string
+
+	v.SetConfigName(fileName)
+	if err := v.ReadInConfig(); err != nil {
+		var notFound viper.ConfigFileNotFoundError
+		if !errors.As(err, &notFound) {
+			return nil, nil, fmt.Errorf("parsing configuration file: %w", err)
+		}
+		log.Warn().Msg("No configuration file found, using defaults and environment")
+	} else {
+		files = append(files, v.ConfigFileUsed())
+	}
+
+	if l.profile != "" {
+		v.SetConfigName(fileName + "." + l.profile)
+		if err := v.MergeInConfig(); err != nil {
+			return nil, nil, fmt.Errorf("loading configuration profile %q: %w", l.profile, err)
+		}
+		files = append(files, v.ConfigFileUsed())
+	}
+
+	if err := loadSecrets(v); err != nil {
+		return nil, nil, err
+	}
+
+	return v, files, nil
+}
+
+func loadSecrets(v *viper.Viper) error {
+	for _, key := range secrets {
+		fileKey := key + "_file"
+		if err := v.BindEnv(fileKey); err != nil {
+			return err
+		}
+
+		path := v.GetString(fileKey)
+		if path == "" {
+			continue
+		}
+
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("reading secret %s: %w", fileKey, err)
+		}
+		v.Set(key, strings.TrimSpace(string(content)))
+	}
+
+	return nil
+}
+
+func redact(settings map[string]interface{}, path []string) {
+	if len(path) == 1 {
+		if value, ok := settings[path[0]]; ok && value != "" {
+			settings[path[0]] = redacted
+		}
+		return
+	}
+
+	if nested, ok := settings[path[0]].(map[string]interface{}); ok {
+		redact(nested, path[1:])
+	}
+}
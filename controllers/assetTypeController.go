@@ -0,0 +1,570 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/fatah-illah/asset-finder/assettype"
+	"github.com/fatah-illah/asset-finder/data/request"
+	"github.com/fatah-illah/asset-finder/data/response"
+	"github.com/fatah-illah/asset-finder/models"
+	"github.com/fatah-illah/asset-finder/utils"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultReportLimit = 100
+	maxReportLimit     = 1000
+	reportBatchSize    = 500
+)
+
+// metadataViolationError rejects a post whose metadata fails the schema of its asset type
+type metadataViolationError struct {
+	AssetType  string
+	Violations []assettype.Violation
+}
+
+func (e *metadataViolationError) Error() string {
+	return fmt.Sprintf("Metadata does not match the schema of asset type %q", e.AssetType)
+}
+
+type AssetTypeController struct {
+	DB *gorm.DB
+}
+
+func NewAssetTypeController(db *gorm.DB) *AssetTypeController {
+	return &AssetTypeController{DB: db}
+}
+
+// GetAssetTypes godoc
+// @Summary Get the asset types
+// @Description Get the asset types with the JSON Schema of their current version
+// @Tags assetTypes
+// @Produce json
+// @Success 200 {object} response.Response{data=[]response.AssetTypeResponse}
+// @Router /assetTypes [get]
+func (h *AssetTypeController) GetAssetTypes(c *gin.Context) {
+	db := h.DB.WithContext(c.Request.Context())
+
+	var assetTypes []models.AssetType
+	if err := db.Order("name").Find(&assetTypes).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, response.NewErrorResponse(http.StatusInternalServerError, err.Error()))
+		return
+	}
+
+	var schemas []models.AssetTypeSchema
+	err := db.Where("(asset_type_id, version) IN (?)", db.Model(&models.AssetType{}).Select("id", "current_version")).
+		Find(&schemas).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, response.NewErrorResponse(http.StatusInternalServerError, err.Error()))
+		return
+	}
+
+	documents := make(map[uint]string, len(schemas))
+	for _, schema := range schemas {
+		documents[schema.AssetTypeID] = schema.Schema
+	}
+
+	assetTypeResponses := make([]response.AssetTypeResponse, 0, len(assetTypes))
+	for _, assetType := range assetTypes {
+		assetTypeResponses = append(assetTypeResponses, toAssetTypeResponse(assetType, documents[assetType.ID]))
+	}
+
+	c.JSON(http.StatusOK, response.NewSuccessResponse(assetTypeResponses))
+}
+
+// GetAssetType godoc
+// @Summary Get an asset type
+// @Description Get an asset type by its ID with the JSON Schema of its current version
+// @Tags assetTypes
+// @Produce json
+// @Param typeId path int true "Asset type ID"
+// @Success 200 {object} response.Response{data=response.AssetTypeResponse}
+// @Failure 404 {object} response.Response{} "Asset type not found"
+// @Router /assetTypes/{typeId} [get]
+func (h *AssetTypeController) GetAssetType(c *gin.Context) {
+	db := h.DB.WithContext(c.Request.Context())
+
+	var assetType models.AssetType
+	if err := db.First(&assetType, c.Param("typeId")).Error; err != nil {
+		c.JSON(http.StatusNotFound, response.NewErrorResponse(http.StatusNotFound, "Record not found!"))
+		return
+	}
+
+	var schema models.AssetTypeSchema
+	if err := db.First(&schema, "asset_type_id = ? AND version = ?", assetType.ID, assetType.CurrentVersion).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, response.NewErrorResponse(http.StatusInternalServerError, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, response.NewSuccessResponse(toAssetTypeResponse(assetType, schema.Schema)))
+}
+
+// CreateAssetType godoc
+// @Summary Create an asset type
+// @Description Create an asset type whose posts must have metadata matching a JSON Schema, draft 2020-12 unless the schema declares another draft with $schema. The schema is version 1 of the type.
+// @Tags assetTypes
+// @Accept json
+// @Produce json
+// @Param input body request.AssetTypeRequest true "Asset type"
+// @Success 200 {object} response.Response{data=response.AssetTypeResponse}
+// @Failure 400 {object} response.Response{} "Invalid schema"
+// @Failure 409 {object} response.Response{} "Asset type name already used"
+// @Router /assetTypes [post]
+func (h *AssetTypeController) CreateAssetType(c *gin.Context) {
+	db := h.DB.WithContext(c.Request.Context())
+
+	var assetTypeRequest request.AssetTypeRequest
+	if !bindRequest(c, &assetTypeRequest) {
+		return
+	}
+
+	document, responseError := compileSchemaRequest(assetTypeRequest.Schema)
+	if responseError != nil {
+		c.JSON(responseError.Status, response.NewErrorResponse(responseError.Status, responseError.Message))
+		return
+	}
+
+	assetType := models.AssetType{Name: assetTypeRequest.Name, Description: assetTypeRequest.Description, CurrentVersion: 1}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := checkAssetTypeName(tx, assetType.Name, 0); err != nil {
+			return err
+		}
+		if err := tx.Create(&assetType).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.AssetTypeSchema{AssetTypeID: assetType.ID, Version: 1, Schema: document}).Error
+	})
+	if !respondError(c, err) {
+		return
+	}
+
+	c.JSON(http.StatusOK, response.NewSuccessResponse(toAssetTypeResponse(assetType, document)))
+}
+
+// UpdateAssetType godoc
+// @Summary Update an asset type
+// @Description Rename an asset type or change its description, its schema changes with new versions
+// @Tags assetTypes
+// @Accept json
+// @Produce json
+// @Param typeId path int true "Asset type ID"
+// @Param input body request.AssetTypeUpdateRequest true "Asset type"
+// @Success 200 {object} response.Response{data=response.AssetTypeResponse}
+// @Failure 404 {object} response.Response{} "Asset type not found"
+// @Failure 409 {object} response.Response{} "Asset type name already used"
+// @Router /assetTypes/{typeId} [put]
+func (h *AssetTypeController) UpdateAssetType(c *gin.Context) {
+	db := h.DB.WithContext(c.Request.Context())
+
+	var assetType models.AssetType
+	if err := db.First(&assetType, c.Param("typeId")).Error; err != nil {
+		c.JSON(http.StatusNotFound, response.NewErrorResponse(http.StatusNotFound, "Record not found!"))
+		return
+	}
+
+	var assetTypeRequest request.AssetTypeUpdateRequest
+	if !bindRequest(c, &assetTypeRequest) {
+		return
+	}
+
+	var schema models.AssetTypeSchema
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := checkAssetTypeName(tx, assetTypeRequest.Name, assetType.ID); err != nil {
+			return err
+		}
+
+		assetType.Name = assetTypeRequest.Name
+		assetType.Description = assetTypeRequest.Description
+		if err := tx.Save(&assetType).Error; err != nil {
+			return err
+		}
+
+		return tx.First(&schema, "asset_type_id = ? AND version = ?", assetType.ID, assetType.CurrentVersion).Error
+	})
+	if !respondError(c, err) {
+		return
+	}
+
+	c.JSON(http.StatusOK, response.NewSuccessResponse(toAssetTypeResponse(assetType, schema.Schema)))
+}
+
+// DeleteAssetType godoc
+// @Summary Delete an asset type
+// @Description Delete an asset type with its schema versions, the asset types of posts cannot be deleted
+// @Tags assetTypes
+// @Produce json
+// @Param typeId path int true "Asset type ID"
+// @Success 200 {object} response.Response{}
+// @Failure 404 {object} response.Response{} "Asset type not found"
+// @Failure 409 {object} response.Response{} "Asset type used by posts"
+// @Router /assetTypes/{typeId} [delete]
+func (h *AssetTypeController) DeleteAssetType(c *gin.Context) {
+	db := h.DB.WithContext(c.Request.Context())
+
+	var assetType models.AssetType
+	if err := db.First(&assetType, c.Param("typeId")).Error; err != nil {
+		c.JSON(http.StatusNotFound, response.NewErrorResponse(http.StatusNotFound, "Record not found!"))
+		return
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// locked so that no post takes the type while it is deleted
+		if err := utils.ForUpdate(tx).First(&assetType, assetType.ID).Error; err != nil {
+			return err
+		}
+
+		var posts int64
+		if err := tx.Model(&models.Post{}).Where("asset_type_id = ?", assetType.ID).Count(&posts).Error; err != nil {
+			return err
+		}
+		if posts > 0 {
+			return &utils.ResponseError{
+				Message: fmt.Sprintf("Asset type %q is used by %d posts", assetType.Name, posts),
+				Status:  http.StatusConflict,
+			}
+		}
+
+		if err := tx.Where("asset_type_id = ?", assetType.ID).Delete(&models.AssetTypeSchema{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&assetType).Error
+	})
+	if !respondError(c, err) {
+		return
+	}
+
+	c.JSON(http.StatusOK, response.NewSuccessResponse(nil))
+}
+
+// GetAssetTypeSchemas godoc
+// @Summary Get the schema versions of an asset type
+// @Description Get all the JSON Schema versions of an asset type, the latest first
+// @Tags assetTypes
+// @Produce json
+// @Param typeId path int true "Asset type ID"
+// @Success 200 {object} response.Response{data=[]response.AssetTypeSchemaResponse}
+// @Failure 404 {object} response.Response{} "Asset type not found"
+// @Router /assetTypes/{typeId}/schemas [get]
+func (h *AssetTypeController) GetAssetTypeSchemas(c *gin.Context) {
+	db := h.DB.WithContext(c.Request.Context())
+
+	var assetType models.AssetType
+	if err := db.First(&assetType, c.Param("typeId")).Error; err != nil {
+		c.JSON(http.StatusNotFound, response.NewErrorResponse(http.StatusNotFound, "Record not found!"))
+		return
+	}
+
+	var schemas []models.AssetTypeSchema
+	if err := db.Where("asset_type_id = ?", assetType.ID).Order("version DESC").Find(&schemas).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, response.NewErrorResponse(http.StatusInternalServerError, err.Error()))
+		return
+	}
+
+	schemaResponses := make([]response.AssetTypeSchemaResponse, 0, len(schemas))
+	for _, schema := range schemas {
+		schemaResponses = append(schemaResponses, toAssetTypeSchemaResponse(assetType, schema))
+	}
+
+	c.JSON(http.StatusOK, response.NewSuccessResponse(schemaResponses))
+}
+
+// GetAssetTypeSchema godoc
+// @Summary Get a schema version of an asset type
+// @Description Get a JSON Schema version of an asset type
+// @Tags assetTypes
+// @Produce json
+// @Param typeId path int true "Asset type ID"
+// @Param version path int true "Schema version"
+// @Success 200 {object} response.Response{data=response.AssetTypeSchemaResponse}
+// @Failure 404 {object} response.Response{} "Asset type or version not found"
+// @Router /assetTypes/{typeId}/schemas/{version} [get]
+func (h *AssetTypeController) GetAssetTypeSchema(c *gin.Context) {
+	db := h.DB.WithContext(c.Request.Context())
+
+	var assetType models.AssetType
+	if err := db.First(&assetType, c.Param("typeId")).Error; err != nil {
+		c.JSON(http.StatusNotFound, response.NewErrorResponse(http.StatusNotFound, "Record not found!"))
+		return
+	}
+
+	var schema models.AssetTypeSchema
+	if err := db.First(&schema, "asset_type_id = ? AND version = ?", assetType.ID, c.Param("version")).Error; err != nil {
+		c.JSON(http.StatusNotFound, response.NewErrorResponse(http.StatusNotFound, "Record not found!"))
+		return
+	}
+
+	c.JSON(http.StatusOK, response.NewSuccessResponse(toAssetTypeSchemaResponse(assetType, schema)))
+}
+
+// CreateAssetTypeSchema godoc
+// @Summary Add a schema version to an asset type
+// @Description Add a JSON Schema version to an asset type and make it current, the existing posts are not checked: use the report endpoint to find the posts failing it
+// @Tags assetTypes
+// @Accept json
+// @Produce json
+// @Param typeId path int true "Asset type ID"
+// @Param input body request.AssetTypeSchemaRequest true "JSON Schema"
+// @Success 200 {object} response.Response{data=response.AssetTypeSchemaResponse}
+// @Failure 400 {object} response.Response{} "Invalid schema"
+// @Failure 404 {object} response.Response{} "Asset type not found"
+// @Router /assetTypes/{typeId}/schemas [post]
+func (h *AssetTypeController) CreateAssetTypeSchema(c *gin.Context) {
+	db := h.DB.WithContext(c.Request.Context())
+
+	var schemaRequest request.AssetTypeSchemaRequest
+	if !bindRequest(c, &schemaRequest) {
+		return
+	}
+
+	document, responseError := compileSchemaRequest(schemaRequest.Schema)
+	if responseError != nil {
+		c.JSON(responseError.Status, response.NewErrorResponse(responseError.Status, responseError.Message))
+		return
+	}
+
+	var assetType models.AssetType
+	var schema models.AssetTypeSchema
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// locked so that concurrent versions get distinct numbers
+		err := utils.ForUpdate(tx).First(&assetType, c.Param("typeId")).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return &utils.ResponseError{Message: "Record not found!", Status: http.StatusNotFound}
+		}
+		if err != nil {
+			return err
+		}
+
+		var latest int
+		if err := tx.Model(&models.AssetTypeSchema{}).Select("COALESCE(MAX(version), 0)").
+			Where("asset_type_id = ?", assetType.ID).Scan(&latest).Error; err != nil {
+			return err
+		}
+
+		schema = models.AssetTypeSchema{AssetTypeID: assetType.ID, Version: latest + 1, Schema: document}
+		if err := tx.Create(&schema).Error; err != nil {
+			return err
+		}
+
+		assetType.CurrentVersion = schema.Version
+		return tx.Save(&assetType).Error
+	})
+	if !respondError(c, err) {
+		return
+	}
+
+	c.JSON(http.StatusOK, response.NewSuccessResponse(toAssetTypeSchemaResponse(assetType, schema)))
+}
+
+// ActivateAssetTypeSchema godoc
+// @Summary Make a schema version current
+// @Description Make a JSON Schema version of an asset type current again, such as to roll back a new version
+// @Tags assetTypes
+// @Produce json
+// @Param typeId path int true "Asset type ID"
+// @Param version path int true "Schema version"
+// @Success 200 {object} response.Response{data=response.AssetTypeSchemaResponse}
+// @Failure 404 {object} response.Response{} "Asset type or version not found"
+// @Router /assetTypes/{typeId}/schemas/{version}/activate [post]
+func (h *AssetTypeController) ActivateAssetTypeSchema(c *gin.Context) {
+	db := h.DB.WithContext(c.Request.Context())
+
+	var assetType models.AssetType
+	if err := db.First(&assetType, c.Param("typeId")).Error; err != nil {
+		c.JSON(http.StatusNotFound, response.NewErrorResponse(http.StatusNotFound, "Record not found!"))
+		return
+	}
+
+	var schema models.AssetTypeSchema
+	if err := db.First(&schema, "asset_type_id = ? AND version = ?", assetType.ID, c.Param("version")).Error; err != nil {
+		c.JSON(http.StatusNotFound, response.NewErrorResponse(http.StatusNotFound, "Record not found!"))
+		return
+	}
+
+	assetType.CurrentVersion = schema.Version
+	if err := db.Model(&assetType).Update("current_version", schema.Version).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, response.NewErrorResponse(http.StatusInternalServerError, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, response.NewSuccessResponse(toAssetTypeSchemaResponse(assetType, schema)))
+}
+
+// GetAssetTypeReport godoc
+// @Summary Report the posts failing a schema
+// @Description Check the metadata of the posts of an asset type against its current schema, or another version, and list the failing posts with their violations
+// @Tags assetTypes
+// @Produce json
+// @Param typeId path int true "Asset type ID"
+// @Param version query int false "Schema version, the current one by default"
+// @Param limit query int false "Maximum number of failing posts listed (default 100, at most 1000)"
+// @Success 200 {object} response.Response{data=response.AssetTypeReportResponse}
+// @Failure 400 {object} response.Response{} "Invalid limit"
+// @Failure 404 {object} response.Response{} "Asset type or version not found"
+// @Router /assetTypes/{typeId}/report [get]
+func (h *AssetTypeController) GetAssetTypeReport(c *gin.Context) {
+	db := h.DB.WithContext(c.Request.Context())
+
+	limit := defaultReportLimit
+	if value := c.Query("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 {
+			c.JSON(http.StatusBadRequest, response.NewErrorResponse(http.StatusBadRequest, "Invalid limit"))
+			return
+		}
+		limit = min(parsed, maxReportLimit)
+	}
+
+	var assetType models.AssetType
+	if err := db.First(&assetType, c.Param("typeId")).Error; err != nil {
+		c.JSON(http.StatusNotFound, response.NewErrorResponse(http.StatusNotFound, "Record not found!"))
+		return
+	}
+
+	version := c.DefaultQuery("version", strconv.Itoa(assetType.CurrentVersion))
+	var schema models.AssetTypeSchema
+	if err := db.First(&schema, "asset_type_id = ? AND version = ?", assetType.ID, version).Error; err != nil {
+		c.JSON(http.StatusNotFound, response.NewErrorResponse(http.StatusNotFound, "Record not found!"))
+		return
+	}
+
+	compiled, err := assettype.Compile(schema.Schema)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, response.NewErrorResponse(http.StatusInternalServerError, err.Error()))
+		return
+	}
+
+	report := response.AssetTypeReportResponse{
+		AssetTypeID: assetType.ID,
+		Version:     schema.Version,
+		Posts:       []response.AssetTypeReportPostResponse{},
+	}
+
+	var posts []models.Post
+	err = db.Select("id", "title", "metadata").Where("asset_type_id = ?", assetType.ID).
+		FindInBatches(&posts, reportBatchSize, func(tx *gorm.DB, batch int) error {
+			for _, post := range posts {
+				violations, err := compiled.Validate(post.Metadata)
+				if err != nil {
+					return err
+				}
+
+				report.CheckedPosts++
+				if len(violations) == 0 {
+					continue
+				}
+
+				report.FailingPosts++
+				if len(report.Posts) < limit {
+					report.Posts = append(report.Posts, response.AssetTypeReportPostResponse{ID: post.ID, Title: post.Title, Violations: violations})
+				}
+			}
+			return nil
+		}).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, response.NewErrorResponse(http.StatusInternalServerError, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, response.NewSuccessResponse(report))
+}
+
+// validatePostMetadata checks the metadata of a post against the current schema
+// of its asset type
+func validatePostMetadata(tx *gorm.DB, post models.Post) error {
+	if post.AssetTypeID == nil {
+		return nil
+	}
+
+	var assetType models.AssetType
+	err := tx.First(&assetType, *post.AssetTypeID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &utils.ResponseError{
+			Message: fmt.Sprintf("Asset type %d does not exist", *post.AssetTypeID),
+			Status:  http.StatusUnprocessableEntity,
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	var schema models.AssetTypeSchema
+	if err := tx.First(&schema, "asset_type_id = ? AND version = ?", assetType.ID, assetType.CurrentVersion).Error; err != nil {
+		return err
+	}
+
+	compiled, err := assettype.Compile(schema.Schema)
+	if err != nil {
+		return err
+	}
+
+	violations, err := compiled.Validate(post.Metadata)
+	if err != nil {
+		return err
+	}
+	if len(violations) > 0 {
+		return &metadataViolationError{AssetType: assetType.Name, Violations: violations}
+	}
+
+	return nil
+}
+
+// compileSchemaRequest checks that a requested schema is a valid JSON Schema and
+// returns it compacted for storage
+func compileSchemaRequest(document json.RawMessage) (string, *utils.ResponseError) {
+	var decoded interface{}
+	if err := json.Unmarshal(document, &decoded); err != nil {
+		return "", &utils.ResponseError{Message: "Invalid schema: " + err.Error(), Status: http.StatusBadRequest}
+	}
+	if _, ok := decoded.(map[string]interface{}); !ok {
+		return "", &utils.ResponseError{Message: "Invalid schema: the schema must be a JSON object", Status: http.StatusBadRequest}
+	}
+
+	compacted, err := json.Marshal(decoded)
+	if err != nil {
+		return "", &utils.ResponseError{Message: "Invalid schema: " + err.Error(), Status: http.StatusBadRequest}
+	}
+	if _, err := assettype.Compile(string(compacted)); err != nil {
+		return "", &utils.ResponseError{Message: "Invalid schema: " + err.Error(), Status: http.StatusBadRequest}
+	}
+
+	return string(compacted), nil
+}
+
+// checkAssetTypeName rejects a name used by another asset type than id
+func checkAssetTypeName(tx *gorm.DB, name string, id uint) error {
+	var count int64
+	if err := tx.Model(&models.AssetType{}).Where("name = ? AND id <> ?", name, id).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return &utils.ResponseError{Message: fmt.Sprintf("Asset type %q already exists", name), Status: http.StatusConflict}
+	}
+	return nil
+}
+
+func toAssetTypeResponse(assetType models.AssetType, document string) response.AssetTypeResponse {
+	return response.AssetTypeResponse{
+		ID:             assetType.ID,
+		Name:           assetType.Name,
+		Description:    assetType.Description,
+		CurrentVersion: assetType.CurrentVersion,
+		Schema:         json.RawMessage(document),
+		CreatedAt:      assetType.CreatedAt,
+		UpdatedAt:      assetType.UpdatedAt,
+	}
+}
+
+func toAssetTypeSchemaResponse(assetType models.AssetType, schema models.AssetTypeSchema) response.AssetTypeSchemaResponse {
+	return response.AssetTypeSchemaResponse{
+		AssetTypeID: schema.AssetTypeID,
+		Version:     schema.Version,
+		Current:     schema.Version == assetType.CurrentVersion,
+		Schema:      json.RawMessage(schema.Schema),
+		CreatedAt:   schema.CreatedAt,
+	}
+}
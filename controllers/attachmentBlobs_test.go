@@ -0,0 +1,81 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/fatah-illah/asset-finder/config"
+	"github.com/fatah-illah/asset-finder/models"
+	"github.com/fatah-illah/asset-finder/storage"
+	"github.com/fatah-illah/asset-finder/utils"
+	"github.com/fatah-illah/asset-finder/workflow"
+)
+
+func TestDeletionsReleaseSharedBlobs(t *testing.T) {
+	db := newTestDB(t)
+	store, err := storage.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	posts := NewPostController(db, utils.TagNormalizer{}, nil, store, nil)
+	attachments := NewAttachmentController(db, store, nil, utils.TagNormalizer{}, config.AttachmentsConfig{MaxSize: 1024}, nil)
+
+	router := newTestRouter()
+	router.DELETE("/posts/:postId", posts.DeletePost)
+	router.DELETE("/attachments/:attachmentId", attachments.DeleteAttachment)
+
+	hash := strings.Repeat("b", 64)
+	key := "blobs/" + hash
+	if err := store.Put(context.Background(), key, strings.NewReader("x"), 1, "text/plain"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&models.Blob{SHA256: hash, Size: 1, ContentType: "text/plain", StorageKey: key, RefCount: 3}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	first := models.Post{Title: "First", Status: workflow.StatusPublished}
+	second := models.Post{Title: "Second", Status: workflow.StatusPublished}
+	if err := db.Create(&[]*models.Post{&first, &second}).Error; err != nil {
+		t.Fatal(err)
+	}
+	shared := []*models.Attachment{
+		{PostID: first.ID, FileName: "a.txt", ContentType: "text/plain", Size: 1, SHA256: hash},
+		{PostID: first.ID, FileName: "b.txt", ContentType: "text/plain", Size: 1, SHA256: hash},
+		{PostID: second.ID, FileName: "c.txt", ContentType: "text/plain", Size: 1, SHA256: hash},
+	}
+	if err := db.Create(&shared).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if recorder := serve(router, "editor", http.MethodDelete, "/posts/"+strconv.FormatUint(uint64(first.ID), 10), ""); recorder.Code != http.StatusOK {
+		t.Fatalf("DELETE post: status = %d, body %s", recorder.Code, recorder.Body)
+	}
+	var blob models.Blob
+	if err := db.First(&blob, "sha256 = ?", hash).Error; err != nil {
+		t.Fatalf("the blob still attached to the second post was deleted: %v", err)
+	}
+	if blob.RefCount != 1 {
+		t.Errorf("ref_count = %d, want 1", blob.RefCount)
+	}
+
+	target := "/attachments/" + strconv.FormatUint(uint64(shared[2].ID), 10)
+	if recorder := serve(router, "editor", http.MethodDelete, target, ""); recorder.Code != http.StatusOK {
+		t.Fatalf("DELETE attachment: status = %d, body %s", recorder.Code, recorder.Body)
+	}
+	if recorder := serve(router, "editor", http.MethodDelete, target, ""); recorder.Code != http.StatusNotFound {
+		t.Errorf("second DELETE attachment: status = %d, want %d", recorder.Code, http.StatusNotFound)
+	}
+
+	var count int64
+	if err := db.Model(&models.Blob{}).Where("sha256 = ?", hash).Count(&count).Error; err != nil || count != 0 {
+		t.Errorf("the unreferenced blob was kept: %v", err)
+	}
+	if _, err := store.Get(context.Background(), key); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("the unreferenced content was kept: %v", err)
+	}
+}
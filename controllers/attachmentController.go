@@ -0,0 +1,717 @@
+package controllers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/fatah-illah/asset-finder/config"
+	"github.com/fatah-illah/asset-finder/data/response"
+	"github.com/fatah-illah/asset-finder/jobs"
+	"github.com/fatah-illah/asset-finder/metadata"
+	"github.com/fatah-illah/asset-finder/models"
+	"github.com/fatah-illah/asset-finder/storage"
+	"github.com/fatah-illah/asset-finder/thumbnails"
+	"github.com/fatah-illah/asset-finder/utils"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// multipartOverhead is the room left for the multipart headers and boundaries
+	// above the maximum file size
+	multipartOverhead = 1 << 20
+
+	defaultAttachmentLimit = 100
+	maxAttachmentLimit     = 1000
+
+	// kindNamespace is the namespace of the tags added from the kind of the uploads
+	kindNamespace       = "type"
+	metadataParamPrefix = "meta."
+)
+
+type AttachmentController struct {
+	DB         *gorm.DB
+	Store      storage.BlobStore
+	Thumbnails *jobs.Pool
+	Normalizer utils.TagNormalizer
+	Config     config.AttachmentsConfig
+	Namespaces map[string]config.TagNamespaceConfig
+}
+
+func NewAttachmentController(db *gorm.DB, store storage.BlobStore, thumbnailPool *jobs.Pool, normalizer utils.TagNormalizer, conf config.AttachmentsConfig, namespaces map[string]config.TagNamespaceConfig) *AttachmentController {
+	return &AttachmentController{DB: db, Store: store, Thumbnails: thumbnailPool, Normalizer: normalizer, Config: conf, Namespaces: namespaces}
+}
+
+// UploadAttachment godoc
+// @Summary Upload an attachment to a post
+// @Description Store the file of the multipart field "file", its content type is detected from its content and must be allowed by the configuration. Metadata such as image dimensions, EXIF, PDF page count or media duration is extracted, and with attachments.auto_tag the post is tagged type:<kind>.
+// @Tags attachments
+// @Accept multipart/form-data
+// @Produce json
+// @Param postId path int true "Post ID"
+// @Param file formData file true "File"
+// @Success 200 {object} response.Response{data=models.Attachment}
+// @Failure 400 {object} response.Response{} "Missing file"
+// @Failure 404 {object} response.Response{} "Post not found, or unpublished without API key"
+// @Failure 413 {object} response.Response{} "File too large"
+// @Failure 415 {object} response.Response{} "Content type not allowed"
+// @Router /posts/{postId}/attachments [post]
+func (h *AttachmentController) UploadAttachment(c *gin.Context) {
+	db := h.DB.WithContext(c.Request.Context())
+
+	var post models.Post
+	if err := db.Scopes(visiblePosts(c)).Select("id").First(&post, c.Param("postId")).Error; err != nil {
+		c.JSON(http.StatusNotFound, response.NewErrorResponse(http.StatusNotFound, "Record not found!"))
+		return
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, h.Config.MaxSize+multipartOverhead)
+
+	header, err := c.FormFile("file")
+	var maxBytesError *http.MaxBytesError
+	if errors.As(err, &maxBytesError) {
+		h.tooLarge(c)
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, response.NewErrorResponse(http.StatusBadRequest, "Missing multipart file field \"file\""))
+		return
+	}
+	if header.Size > h.Config.MaxSize {
+		h.tooLarge(c)
+		return
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, response.NewErrorResponse(http.StatusBadRequest, err.Error()))
+		return
+	}
+	defer file.Close()
+
+	hash, err := storage.Hash(file)
+	if err == nil {
+		_, err = file.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, response.NewErrorResponse(http.StatusBadRequest, err.Error()))
+		return
+	}
+
+	attachment := models.Attachment{
+		PostID:   post.ID,
+		FileName: filepath.Base(header.Filename),
+		Size:     header.Size,
+		SHA256:   hash,
+	}
+
+	// a known content is only referenced once more, a new one is stored under a
+	// fresh key so that it never collides with a blob being deleted
+	var storedKey, duplicateKey string
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var blob models.Blob
+		referenced, err := referenceBlob(tx, &blob, hash)
+		if err != nil {
+			return err
+		}
+
+		if !referenced {
+			contentType, err := metadata.Detect(file)
+			if err != nil {
+				return &utils.ResponseError{Message: err.Error(), Status: http.StatusBadRequest}
+			}
+
+			blob = models.Blob{
+				SHA256:      hash,
+				Size:        header.Size,
+				ContentType: contentType,
+				StorageKey:  fmt.Sprintf("blobs/%s/%s/%s", hash[:2], hash, newStorageID()),
+				RefCount:    1,
+			}
+			if !h.allowed(blob.ContentType) {
+				return h.notAllowed(blob.ContentType)
+			}
+
+			values, err := metadata.Extract(file, blob.Size, blob.ContentType)
+			if err != nil {
+				return err
+			}
+
+			if err := h.Store.Put(c.Request.Context(), blob.StorageKey, file, blob.Size, blob.ContentType); err != nil {
+				return err
+			}
+			storedKey = blob.StorageKey
+
+			created := tx.Clauses(clause.OnConflict{Columns: []clause.Column{{Name: "sha256"}}, DoNothing: true}).Create(&blob)
+			if created.Error != nil {
+				return created.Error
+			}
+			if created.RowsAffected == 0 {
+				// a concurrent upload of the same content stored it first, the copy
+				// stored here is dropped and the other one referenced
+				duplicateKey, storedKey = storedKey, ""
+				if referenced, err = referenceBlob(tx, &blob, hash); err != nil {
+					return err
+				}
+				if !referenced {
+					return fmt.Errorf("blob %s was deleted while being uploaded", hash)
+				}
+			} else if rows := models.NewBlobMetadata(hash, values); len(rows) > 0 {
+				if err := tx.Create(&rows).Error; err != nil {
+					return err
+				}
+			}
+		}
+		if !h.allowed(blob.ContentType) {
+			return h.notAllowed(blob.ContentType)
+		}
+
+		attachment.ContentType = blob.ContentType
+		if err := tx.Create(&attachment).Error; err != nil {
+			return err
+		}
+
+		if h.Config.AutoTag {
+			return h.tagPost(tx, post.ID, blob.ContentType)
+		}
+		return nil
+	})
+
+	if duplicateKey != "" {
+		deleteBlob(c.Request.Context(), h.Store, duplicateKey)
+	}
+	if err != nil && storedKey != "" {
+		deleteBlob(c.Request.Context(), h.Store, storedKey)
+	}
+	var responseError *utils.ResponseError
+	if errors.As(err, &responseError) {
+		c.JSON(responseError.Status, response.NewErrorResponse(responseError.Status, responseError.Message))
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, response.NewErrorResponse(http.StatusInternalServerError, err.Error()))
+		return
+	}
+
+	if storedKey != "" {
+		h.queueThumbnails(c.Request.Context(), attachment)
+	}
+
+	if err := loadAttachmentMetadata(db, []*models.Attachment{&attachment}); err != nil {
+		c.JSON(http.StatusInternalServerError, response.NewErrorResponse(http.StatusInternalServerError, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, response.NewSuccessResponse(attachment))
+}
+
+// referenceBlob counts one more reference to the blob of a known content and loads
+// it into blob, it returns false when the content is not stored yet
+func referenceBlob(tx *gorm.DB, blob *models.Blob, hash string) (bool, error) {
+	referenced := tx.Model(&models.Blob{}).Where("sha256 = ?", hash).UpdateColumn("ref_count", gorm.Expr("ref_count + 1"))
+	if referenced.Error != nil || referenced.RowsAffected == 0 {
+		return false, referenced.Error
+	}
+
+	return true, tx.First(blob, "sha256 = ?", hash).Error
+}
+
+// GetPostAttachments godoc
+// @Summary Get the attachments of a post
+// @Description Return the files uploaded to the post, the attachments of an unpublished post need an API key
+// @Tags attachments
+// @Produce json
+// @Param postId path int true "Post ID"
+// @Success 200 {object} response.Response{data=[]models.Attachment}
+// @Router /posts/{postId}/attachments [get]
+func (h *AttachmentController) GetPostAttachments(c *gin.Context) {
+	db := h.DB.WithContext(c.Request.Context())
+
+	attachments := []*models.Attachment{}
+	if err := db.Where("post_id = ? AND post_id IN (?)", c.Param("postId"), visiblePostIDs(c, db)).Order("id").Find(&attachments).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, response.NewErrorResponse(http.StatusInternalServerError, err.Error()))
+		return
+	}
+
+	if err := loadAttachmentMetadata(db, attachments); err != nil {
+		c.JSON(http.StatusInternalServerError, response.NewErrorResponse(http.StatusInternalServerError, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, response.NewSuccessResponse(attachments))
+}
+
+// GetAttachments godoc
+// @Summary Find attachments
+// @Description Get the attachments matching a content type, a kind (image, video, audio, text, document, archive or file) and meta.<key>=<value> parameters such as meta.camera_make=Canon (repeat a parameter to match any of several values), only on published posts without API key
+// @Tags attachments
+// @Produce json
+// @Param content_type query string false "Content type, such as image/jpeg"
+// @Param kind query string false "Kind of content, such as image"
+// @Param limit query int false "Maximum number of attachments (default 100, at most 1000)"
+// @Success 200 {object} response.Response{data=[]models.Attachment}
+// @Failure 400 {object} response.Response{} "Invalid limit"
+// @Router /attachments [get]
+func (h *AttachmentController) GetAttachments(c *gin.Context) {
+	db := h.DB.WithContext(c.Request.Context())
+
+	limit := defaultAttachmentLimit
+	if value := c.Query("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 {
+			c.JSON(http.StatusBadRequest, response.NewErrorResponse(http.StatusBadRequest, "Invalid limit"))
+			return
+		}
+		limit = min(parsed, maxAttachmentLimit)
+	}
+
+	query := db.Model(&models.Attachment{}).Where("attachments.post_id IN (?)", visiblePostIDs(c, db))
+	if contentType := c.Query("content_type"); contentType != "" {
+		query = query.Where("content_type = ?", contentType)
+	}
+	if kind := c.Query("kind"); kind != "" {
+		var contentTypes []string
+		if err := db.Model(&models.Attachment{}).Distinct().Pluck("content_type", &contentTypes).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, response.NewErrorResponse(http.StatusInternalServerError, err.Error()))
+			return
+		}
+		contentTypes = slices.DeleteFunc(contentTypes, func(contentType string) bool {
+			return metadata.Kind(contentType) != kind
+		})
+		query = query.Where("content_type IN ?", contentTypes)
+	}
+	query = filterAttachmentsByMetadata(query, c.Request.URL.Query())
+
+	attachments := []*models.Attachment{}
+	if err := query.Order("id").Limit(limit).Find(&attachments).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, response.NewErrorResponse(http.StatusInternalServerError, err.Error()))
+		return
+	}
+
+	if err := loadAttachmentMetadata(db, attachments); err != nil {
+		c.JSON(http.StatusInternalServerError, response.NewErrorResponse(http.StatusInternalServerError, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, response.NewSuccessResponse(attachments))
+}
+
+// GetAttachment godoc
+// @Summary Get an attachment
+// @Description Return an attachment with the metadata extracted from its content
+// @Tags attachments
+// @Produce json
+// @Param attachmentId path int true "Attachment ID"
+// @Success 200 {object} response.Response{data=models.Attachment}
+// @Failure 404 {object} response.Response{} "Attachment not found, or on an unpublished post without API key"
+// @Router /attachments/{attachmentId} [get]
+func (h *AttachmentController) GetAttachment(c *gin.Context) {
+	db := h.DB.WithContext(c.Request.Context())
+
+	var attachment models.Attachment
+	if err := db.Where("post_id IN (?)", visiblePostIDs(c, db)).First(&attachment, c.Param("attachmentId")).Error; err != nil {
+		c.JSON(http.StatusNotFound, response.NewErrorResponse(http.StatusNotFound, "Record not found!"))
+		return
+	}
+
+	if err := loadAttachmentMetadata(db, []*models.Attachment{&attachment}); err != nil {
+		c.JSON(http.StatusInternalServerError, response.NewErrorResponse(http.StatusInternalServerError, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, response.NewSuccessResponse(attachment))
+}
+
+// DownloadAttachment godoc
+// @Summary Download an attachment
+// @Description Return the content of an attachment, Range requests are supported
+// @Tags attachments
+// @Produce octet-stream
+// @Param attachmentId path int true "Attachment ID"
+// @Param inline query bool false "Display the file in the browser instead of downloading it"
+// @Success 200 {file} file
+// @Success 206 {file} file
+// @Failure 404 {object} response.Response{} "Attachment not found, or on an unpublished post without API key"
+// @Router /attachments/{attachmentId}/download [get]
+func (h *AttachmentController) DownloadAttachment(c *gin.Context) {
+	db := h.DB.WithContext(c.Request.Context())
+
+	var attachment models.Attachment
+	if err := db.Where("post_id IN (?)", visiblePostIDs(c, db)).First(&attachment, c.Param("attachmentId")).Error; err != nil {
+		c.JSON(http.StatusNotFound, response.NewErrorResponse(http.StatusNotFound, "Record not found!"))
+		return
+	}
+
+	var stored models.Blob
+	if err := db.First(&stored, "sha256 = ?", attachment.SHA256).Error; err != nil {
+		c.JSON(http.StatusNotFound, response.NewErrorResponse(http.StatusNotFound, "Attachment content not found"))
+		return
+	}
+
+	blob, err := h.Store.Get(c.Request.Context(), stored.StorageKey)
+	if errors.Is(err, storage.ErrNotFound) {
+		c.JSON(http.StatusNotFound, response.NewErrorResponse(http.StatusNotFound, "Attachment content not found"))
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, response.NewErrorResponse(http.StatusInternalServerError, err.Error()))
+		return
+	}
+	defer blob.Close()
+
+	disposition := "attachment"
+	if inline, _ := strconv.ParseBool(c.Query("inline")); inline {
+		disposition = "inline"
+	}
+
+	c.Header("Content-Type", attachment.ContentType)
+	c.Header("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": attachment.FileName}))
+	http.ServeContent(c.Writer, c.Request, attachment.FileName, blob.ModTime(), blob)
+}
+
+// GetAttachmentThumbnail godoc
+// @Summary Get the thumbnail of an image attachment
+// @Description Return a JPEG or PNG copy of a JPEG, PNG, GIF or WebP attachment scaled down to fit in a size x size box. Thumbnails are generated in the background after the upload, 404 is returned until it is done or when the image cannot be decoded.
+// @Tags attachments
+// @Produce jpeg,png
+// @Param attachmentId path int true "Attachment ID"
+// @Param size query int false "One of the configured sizes, the smallest by default"
+// @Success 200 {file} file
+// @Success 304 "Not modified"
+// @Failure 400 {object} response.Response{} "Invalid size"
+// @Failure 404 {object} response.Response{} "Attachment or thumbnail not found"
+// @Router /attachments/{attachmentId}/thumbnail [get]
+func (h *AttachmentController) GetAttachmentThumbnail(c *gin.Context) {
+	db := h.DB.WithContext(c.Request.Context())
+
+	sizes := h.Config.Thumbnails.Sizes
+	if len(sizes) == 0 {
+		c.JSON(http.StatusNotFound, response.NewErrorResponse(http.StatusNotFound, "Thumbnails are disabled"))
+		return
+	}
+
+	size := slices.Min(sizes)
+	if value := c.Query("size"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || !slices.Contains(sizes, parsed) {
+			message := fmt.Sprintf("Invalid size, must be one of %v", sizes)
+			c.JSON(http.StatusBadRequest, response.NewErrorResponse(http.StatusBadRequest, message))
+			return
+		}
+		size = parsed
+	}
+
+	var attachment models.Attachment
+	if err := db.Where("post_id IN (?)", visiblePostIDs(c, db)).First(&attachment, c.Param("attachmentId")).Error; err != nil {
+		c.JSON(http.StatusNotFound, response.NewErrorResponse(http.StatusNotFound, "Record not found!"))
+		return
+	}
+	if !thumbnails.Supports(attachment.ContentType) {
+		message := fmt.Sprintf("No thumbnail for content type %s", attachment.ContentType)
+		c.JSON(http.StatusNotFound, response.NewErrorResponse(http.StatusNotFound, message))
+		return
+	}
+
+	var thumbnail models.Thumbnail
+	if err := db.Where("sha256 = ? AND size = ?", attachment.SHA256, size).First(&thumbnail).Error; err != nil {
+		h.queueThumbnails(c.Request.Context(), attachment)
+		c.Header("Retry-After", "5")
+		c.JSON(http.StatusNotFound, response.NewErrorResponse(http.StatusNotFound, "Thumbnail is not generated yet"))
+		return
+	}
+	if thumbnail.Error != "" {
+		c.JSON(http.StatusNotFound, response.NewErrorResponse(http.StatusNotFound, "No thumbnail for this image: "+thumbnail.Error))
+		return
+	}
+
+	content, err := h.Store.Get(c.Request.Context(), thumbnail.StorageKey)
+	if errors.Is(err, storage.ErrNotFound) {
+		c.JSON(http.StatusNotFound, response.NewErrorResponse(http.StatusNotFound, "Thumbnail content not found"))
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, response.NewErrorResponse(http.StatusInternalServerError, err.Error()))
+		return
+	}
+	defer content.Close()
+
+	// the thumbnail of a content never changes
+	c.Header("Content-Type", thumbnail.ContentType)
+	c.Header("Cache-Control", "public, max-age=31536000, immutable")
+	c.Header("ETag", fmt.Sprintf(`"%s-%d"`, thumbnail.SHA256, thumbnail.Size))
+	http.ServeContent(c.Writer, c.Request, "", thumbnail.CreatedAt, content)
+}
+
+// DeleteAttachment godoc
+// @Summary Delete an attachment
+// @Description Delete an attachment, its content is deleted with the last attachment sharing it
+// @Tags attachments
+// @Produce json
+// @Param attachmentId path int true "Attachment ID"
+// @Success 200 {object} DeleteTagResponse
+// @Failure 404 {object} response.Response{} "Attachment not found, or on an unpublished post without API key"
+// @Router /attachments/{attachmentId} [delete]
+func (h *AttachmentController) DeleteAttachment(c *gin.Context) {
+	db := h.DB.WithContext(c.Request.Context())
+
+	var attachment models.Attachment
+	if err := db.Where("post_id IN (?)", visiblePostIDs(c, db)).First(&attachment, c.Param("attachmentId")).Error; err != nil {
+		c.JSON(http.StatusNotFound, response.NewErrorResponse(http.StatusNotFound, "Record not found!"))
+		return
+	}
+
+	var unreferenced []string
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// a concurrent deletion of the same attachment deletes no row here and
+		// must not release its blob a second time
+		var deleted []models.Attachment
+		if err := tx.Clauses(clause.Returning{}).Where("id = ?", attachment.ID).Delete(&deleted).Error; err != nil {
+			return err
+		}
+		if len(deleted) == 0 {
+			return &utils.ResponseError{Message: "Record not found!", Status: http.StatusNotFound}
+		}
+
+		var err error
+		unreferenced, err = releaseBlobs(tx, deleted)
+		return err
+	})
+	if !respondError(c, err) {
+		return
+	}
+
+	for _, key := range unreferenced {
+		deleteBlob(c.Request.Context(), h.Store, key)
+	}
+
+	c.JSON(http.StatusOK, DeleteTagResponse{Status: "success"})
+}
+
+// GetAttachmentsByHash godoc
+// @Summary Find a file by content
+// @Description Tell whether a content is already stored, by its SHA-256, and on which posts it is attached, the unpublished posts are only listed with an API key
+// @Tags attachments
+// @Produce json
+// @Param sha256 path string true "Hex encoded SHA-256 of the content"
+// @Success 200 {object} response.Response{data=response.BlobResponse}
+// @Failure 400 {object} response.Response{} "Invalid SHA-256"
+// @Failure 404 {object} response.Response{} "Content not found"
+// @Router /attachments/by-hash/{sha256} [get]
+func (h *AttachmentController) GetAttachmentsByHash(c *gin.Context) {
+	db := h.DB.WithContext(c.Request.Context())
+
+	hash := strings.ToLower(c.Param("sha256"))
+	if !storage.ValidHash(hash) {
+		c.JSON(http.StatusBadRequest, response.NewErrorResponse(http.StatusBadRequest, "sha256 must be 64 hexadecimal characters"))
+		return
+	}
+
+	var blob models.Blob
+	if err := db.First(&blob, "sha256 = ?", hash).Error; err != nil {
+		c.JSON(http.StatusNotFound, response.NewErrorResponse(http.StatusNotFound, "Record not found!"))
+		return
+	}
+
+	attachments := []response.BlobAttachmentResponse{}
+	err := db.Table("attachments").
+		Select("attachments.id, attachments.file_name, attachments.post_id, posts.title AS post_title").
+		Joins("JOIN posts ON posts.id = attachments.post_id").
+		Where("attachments.sha256 = ?", hash).
+		Scopes(visiblePosts(c)).
+		Order("attachments.id").
+		Scan(&attachments).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, response.NewErrorResponse(http.StatusInternalServerError, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, response.NewSuccessResponse(response.BlobResponse{
+		SHA256:      blob.SHA256,
+		Size:        blob.Size,
+		ContentType: blob.ContentType,
+		Attachments: attachments,
+	}))
+}
+
+func (h *AttachmentController) tooLarge(c *gin.Context) {
+	message := fmt.Sprintf("File is larger than %d bytes", h.Config.MaxSize)
+	c.JSON(http.StatusRequestEntityTooLarge, response.NewErrorResponse(http.StatusRequestEntityTooLarge, message))
+}
+
+func (h *AttachmentController) notAllowed(contentType string) *utils.ResponseError {
+	return &utils.ResponseError{Message: fmt.Sprintf("Content type %s is not allowed", contentType), Status: http.StatusUnsupportedMediaType}
+}
+
+func (h *AttachmentController) allowed(contentType string) bool {
+	return len(h.Config.AllowedMIMETypes) == 0 || slices.Contains(h.Config.AllowedMIMETypes, contentType)
+}
+
+// queueThumbnails asks the workers for the thumbnails of an image attachment,
+// when the queue is full they are generated by the next backfill
+func (h *AttachmentController) queueThumbnails(ctx context.Context, attachment models.Attachment) {
+	if len(h.Config.Thumbnails.Sizes) == 0 || !thumbnails.Supports(attachment.ContentType) {
+		return
+	}
+	if !h.Thumbnails.TryEnqueue(attachment.SHA256) {
+		utils.Logger(ctx).Warn().Str("sha256", attachment.SHA256).Msg("Thumbnail queue is full")
+	}
+}
+
+// tagPost adds the type:<kind> tag of an uploaded content to its post, unless
+// the tag is deprecated or the namespace rules do not allow another type tag
+func (h *AttachmentController) tagPost(tx *gorm.DB, postID uint, contentType string) error {
+	tag, err := resolveTag(tx, h.Normalizer, kindNamespace+utils.NamespaceSeparator+metadata.Kind(contentType))
+	if err != nil {
+		return err
+	}
+
+	var existing []models.Tag
+	err = tx.Where("id IN (?)", tx.Model(&models.PostTag{}).Select("tag_id").Where("post_id = ?", postID)).
+		Find(&existing).Error
+	if err != nil {
+		return err
+	}
+
+	for _, other := range existing {
+		if other.ID == tag.ID {
+			return nil
+		}
+	}
+	if tag.Deprecated || checkNamespaceRules(append(existing, tag), h.Namespaces) != nil {
+		utils.Logger(tx.Statement.Context).Debug().Uint("post_id", postID).Str("tag", tag.Label).Msg("Skipping attachment type tag")
+		return nil
+	}
+
+	return tx.Create(&models.PostTag{PostID: postID, TagID: tag.ID, Source: models.TagSourceAttachment}).Error
+}
+
+// loadAttachmentMetadata fills in the metadata of the attachments from their blobs
+func loadAttachmentMetadata(db *gorm.DB, attachments []*models.Attachment) error {
+	hashes := make([]string, 0, len(attachments))
+	for _, attachment := range attachments {
+		hashes = append(hashes, attachment.SHA256)
+	}
+	if len(hashes) == 0 {
+		return nil
+	}
+
+	var rows []models.BlobMetadata
+	if err := db.Where("sha256 IN ?", hashes).Find(&rows).Error; err != nil {
+		return err
+	}
+
+	values := make(map[string]map[string]string)
+	for _, row := range rows {
+		if values[row.SHA256] == nil {
+			values[row.SHA256] = make(map[string]string)
+		}
+		values[row.SHA256][row.Key] = row.Value
+	}
+	for _, attachment := range attachments {
+		attachment.Metadata = values[attachment.SHA256]
+	}
+
+	return nil
+}
+
+// filterAttachmentsByMetadata restricts query to the attachments having, for every
+// meta.<key> parameter, one of the given values
+func filterAttachmentsByMetadata(query *gorm.DB, params url.Values) *gorm.DB {
+	for param, values := range params {
+		key, ok := strings.CutPrefix(param, metadataParamPrefix)
+		if !ok || key == "" {
+			continue
+		}
+
+		query = query.Where(`EXISTS (SELECT 1 FROM blob_metadata WHERE blob_metadata.sha256 = attachments.sha256
+			AND blob_metadata.key = ? AND blob_metadata.value IN ?)`, key, values)
+	}
+
+	return query
+}
+
+func newStorageID() string {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(buf)
+}
+
+// releaseBlobs drops the references of deleted attachments to their blobs and
+// deletes the blobs no longer referenced, it returns their storage keys so
+// that the content is deleted once the transaction is committed
+func releaseBlobs(tx *gorm.DB, attachments []models.Attachment) ([]string, error) {
+	references := make(map[string]int64)
+	for _, attachment := range attachments {
+		if attachment.SHA256 != "" {
+			references[attachment.SHA256]++
+		}
+	}
+	if len(references) == 0 {
+		return nil, nil
+	}
+
+	// sorted to lock the blob rows in the same order as concurrent deletions
+	hashes := make([]string, 0, len(references))
+	for hash := range references {
+		hashes = append(hashes, hash)
+	}
+	slices.Sort(hashes)
+
+	for _, hash := range hashes {
+		err := tx.Model(&models.Blob{}).Where("sha256 = ?", hash).
+			UpdateColumn("ref_count", gorm.Expr("ref_count - ?", references[hash])).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var orphans []models.Blob
+	if err := tx.Where("sha256 IN ? AND ref_count <= 0", hashes).Find(&orphans).Error; err != nil {
+		return nil, err
+	}
+	if len(orphans) == 0 {
+		return nil, nil
+	}
+
+	keys := make([]string, len(orphans))
+	orphanHashes := make([]string, len(orphans))
+	for i, orphan := range orphans {
+		keys[i] = orphan.StorageKey
+		orphanHashes[i] = orphan.SHA256
+	}
+	if err := tx.Where("sha256 IN ?", orphanHashes).Delete(&models.BlobMetadata{}).Error; err != nil {
+		return nil, err
+	}
+	thumbnailKeys, err := thumbnails.Release(tx, orphanHashes)
+	if err != nil {
+		return nil, err
+	}
+	keys = append(keys, thumbnailKeys...)
+	if err := tx.Delete(&orphans).Error; err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// deleteBlob removes an unreferenced content from the blob store, a failure
+// only leaves the content behind and is logged
+func deleteBlob(ctx context.Context, store storage.BlobStore, key string) {
+	if err := store.Delete(ctx, key); err != nil {
+		utils.Logger(ctx).Warn().Err(err).Str("key", key).Msg("Error while deleting attachment content")
+	}
+}
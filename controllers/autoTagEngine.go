@@ -0,0 +1,199 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/fatah-illah/asset-finder/autotag"
+	"github.com/fatah-illah/asset-finder/config"
+	"github.com/fatah-illah/asset-finder/models"
+	"github.com/fatah-illah/asset-finder/utils"
+	"gorm.io/gorm"
+)
+
+const (
+	// autoTagLockKey keeps replicas from queuing runs of the rules at the same time
+	autoTagLockKey = 7_236_419_503
+
+	autoTagBatchSize = 500
+
+	// autoTagRunTimeout is how long a run may go without committing a batch before
+	// it is considered abandoned, e.g. by a replica which crashed
+	autoTagRunTimeout = 10 * time.Minute
+)
+
+// loadAutoTagRules returns the enabled auto-tagging rules, the highest priority first
+func loadAutoTagRules(db *gorm.DB) ([]autotag.Rule, error) {
+	var stored []models.AutoTagRule
+	if err := db.Preload("Tags").Where("enabled = ?", true).Order("priority DESC, id").Find(&stored).Error; err != nil {
+		return nil, err
+	}
+
+	rules := make([]autotag.Rule, 0, len(stored))
+	for _, rule := range stored {
+		compiled, err := autotag.NewRule(rule)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, compiled)
+	}
+
+	return rules, nil
+}
+
+// applyAutoTags syncs the auto tags of a post with the rules matching it. The tags
+// of the matching rules the post lacks are added, unless they are deprecated or
+// beyond the namespace limits, and the auto tags no rule matches anymore are
+// removed. The tags put by users are left alone.
+func applyAutoTags(tx *gorm.DB, post models.Post, rules []autotag.Rule, namespaces map[string]config.TagNamespaceConfig) (added, removed []models.Tag, err error) {
+	var current []models.PostTag
+	if err := tx.Preload("Tag").Where("post_id = ?", post.ID).Find(&current).Error; err != nil {
+		return nil, nil, err
+	}
+
+	wanted := autotag.Tags(rules, post.Title, post.Content)
+	isWanted := make(map[uint]bool, len(wanted))
+	for _, tag := range wanted {
+		isWanted[tag.ID] = true
+	}
+
+	kept := make([]models.Tag, 0, len(current)+len(wanted))
+	has := make(map[uint]bool, len(current))
+	var removedIDs []uint
+	for _, postTag := range current {
+		if postTag.Source == models.TagSourceAuto && !isWanted[postTag.TagID] {
+			removed = append(removed, postTag.Tag)
+			removedIDs = append(removedIDs, postTag.TagID)
+			continue
+		}
+		kept = append(kept, postTag.Tag)
+		has[postTag.TagID] = true
+	}
+
+	if len(removedIDs) > 0 {
+		err := tx.Where("post_id = ? AND tag_id IN ? AND source = ?", post.ID, removedIDs, models.TagSourceAuto).
+			Delete(&models.PostTag{}).Error
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	for _, tag := range wanted {
+		if has[tag.ID] || tag.Deprecated || checkNamespaceRules(append(kept, tag), namespaces) != nil {
+			continue
+		}
+
+		postTag := models.PostTag{PostID: post.ID, TagID: tag.ID, Source: models.TagSourceAuto}
+		if err := tx.Create(&postTag).Error; err != nil {
+			return nil, nil, err
+		}
+		kept = append(kept, tag)
+		has[tag.ID] = true
+		added = append(added, tag)
+	}
+
+	return added, removed, nil
+}
+
+// RunAutoTagRules re-applies the rules to every post for a queued run, a batch of
+// posts per transaction so that the tags of the posts are not locked for the
+// whole run. The run records the progress and the outcome.
+func RunAutoTagRules(ctx context.Context, db *gorm.DB, namespaces map[string]config.TagNamespaceConfig, runID uint) error {
+	start := time.Now()
+	db = db.WithContext(ctx)
+
+	run := models.AutoTagRun{ID: runID}
+	if err := db.Model(&run).Update("status", models.AutoTagRunRunning).Error; err != nil {
+		return err
+	}
+
+	err := applyAutoTagsToAll(db, namespaces, &run)
+	if err != nil {
+		// recorded even when the run is interrupted by a shutdown
+		finished := time.Now()
+		failed := map[string]interface{}{"status": models.AutoTagRunFailed, "error": err.Error(), "finished_at": &finished}
+		if updateErr := db.WithContext(context.WithoutCancel(ctx)).Model(&run).Updates(failed).Error; updateErr != nil {
+			return errors.Join(err, updateErr)
+		}
+		return err
+	}
+
+	finished := time.Now()
+	if err := db.Model(&run).Updates(map[string]interface{}{"status": models.AutoTagRunCompleted, "finished_at": &finished}).Error; err != nil {
+		return err
+	}
+
+	utils.Logger(ctx).Info().Uint("run_id", runID).Int64("posts", run.Posts).Int64("added", run.AddedTags).
+		Int64("removed", run.RemovedTags).Dur("elapsed", time.Since(start)).Msg("Auto-tagging rules applied")
+
+	return nil
+}
+
+// applyAutoTagsToAll applies the rules to the posts batch by batch, counting the
+// posts and tags of each committed batch in run
+func applyAutoTagsToAll(db *gorm.DB, namespaces map[string]config.TagNamespaceConfig, run *models.AutoTagRun) error {
+	rules, err := loadAutoTagRules(db)
+	if err != nil {
+		return err
+	}
+
+	var batch []models.Post
+	return db.Select("id", "title", "content").Order("id").FindInBatches(&batch, autoTagBatchSize, func(_ *gorm.DB, _ int) error {
+		var added, removed int64
+		err := db.Transaction(func(tx *gorm.DB) error {
+			for _, post := range batch {
+				postAdded, postRemoved, err := applyAutoTags(tx, post, rules, namespaces)
+				if err != nil {
+					return err
+				}
+				added += int64(len(postAdded))
+				removed += int64(len(postRemoved))
+			}
+
+			return tx.Model(run).Updates(map[string]interface{}{
+				"posts":        gorm.Expr("posts + ?", len(batch)),
+				"added_tags":   gorm.Expr("added_tags + ?", added),
+				"removed_tags": gorm.Expr("removed_tags + ?", removed),
+			}).Error
+		})
+		if err != nil {
+			return err
+		}
+
+		run.Posts += int64(len(batch))
+		run.AddedTags += added
+		run.RemovedTags += removed
+		return nil
+	}).Error
+}
+
+// queueAutoTagRun records a new run unless another one is active, a run not
+// updated for autoTagRunTimeout is considered abandoned
+func queueAutoTagRun(db *gorm.DB) (models.AutoTagRun, error) {
+	run := models.AutoTagRun{Status: models.AutoTagRunQueued}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if tx.Dialector.Name() == "postgres" {
+			if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", autoTagLockKey).Error; err != nil {
+				return err
+			}
+		}
+
+		var active int64
+		err := tx.Model(&models.AutoTagRun{}).
+			Where("status IN ? AND updated_at > ?", []string{models.AutoTagRunQueued, models.AutoTagRunRunning}, time.Now().Add(-autoTagRunTimeout)).
+			Count(&active).Error
+		if err != nil {
+			return err
+		}
+		if active > 0 {
+			return &utils.ResponseError{Message: "The rules are already being applied", Status: http.StatusConflict}
+		}
+
+		return tx.Create(&run).Error
+	})
+
+	return run, err
+}
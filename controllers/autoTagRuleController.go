@@ -0,0 +1,421 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/fatah-illah/asset-finder/autotag"
+	"github.com/fatah-illah/asset-finder/config"
+	"github.com/fatah-illah/asset-finder/data/request"
+	"github.com/fatah-illah/asset-finder/data/response"
+	"github.com/fatah-illah/asset-finder/jobs"
+	"github.com/fatah-illah/asset-finder/models"
+	"github.com/fatah-illah/asset-finder/utils"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultDryRunLimit = 50
+	maxDryRunLimit     = 500
+)
+
+// errDryRun rolls back the tags created to preview an unsaved rule
+var errDryRun = errors.New("dry run")
+
+type AutoTagRuleController struct {
+	DB         *gorm.DB
+	Normalizer utils.TagNormalizer
+	Namespaces map[string]config.TagNamespaceConfig
+	// Runs applies the rules to all posts in the background, see RunAutoTagRules
+	Runs *jobs.Pool
+}
+
+func NewAutoTagRuleController(db *gorm.DB, normalizer utils.TagNormalizer, namespaces map[string]config.TagNamespaceConfig, runs *jobs.Pool) *AutoTagRuleController {
+	return &AutoTagRuleController{DB: db, Normalizer: normalizer, Namespaces: namespaces, Runs: runs}
+}
+
+// GetAutoTagRules godoc
+// @Summary Get the auto-tagging rules
+// @Description Get the auto-tagging rules, the highest priority first
+// @Tags autoTagRules
+// @Produce json
+// @Success 200 {object} response.Response{data=[]models.AutoTagRule}
+// @Router /autoTagRules [get]
+func (h *AutoTagRuleController) GetAutoTagRules(c *gin.Context) {
+	db := h.DB.WithContext(c.Request.Context())
+
+	rules := []models.AutoTagRule{}
+	if err := db.Preload("Tags").Order("priority DESC, id").Find(&rules).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, response.NewErrorResponse(http.StatusInternalServerError, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, response.NewSuccessResponse(rules))
+}
+
+// GetAutoTagRule godoc
+// @Summary Get an auto-tagging rule
+// @Description Get an auto-tagging rule by its ID
+// @Tags autoTagRules
+// @Produce json
+// @Param ruleId path int true "Rule ID"
+// @Success 200 {object} response.Response{data=models.AutoTagRule}
+// @Failure 404 {object} response.Response{} "Rule not found"
+// @Router /autoTagRules/{ruleId} [get]
+func (h *AutoTagRuleController) GetAutoTagRule(c *gin.Context) {
+	db := h.DB.WithContext(c.Request.Context())
+
+	var rule models.AutoTagRule
+	if err := db.Preload("Tags").First(&rule, c.Param("ruleId")).Error; err != nil {
+		c.JSON(http.StatusNotFound, response.NewErrorResponse(http.StatusNotFound, "Record not found!"))
+		return
+	}
+
+	c.JSON(http.StatusOK, response.NewSuccessResponse(rule))
+}
+
+// CreateAutoTagRule godoc
+// @Summary Create an auto-tagging rule
+// @Description Create a rule adding tags to the posts whose title, content or either (field any) matches a regular expression or contains a keyword as a whole word, ignoring case. Rules apply when posts are created or updated; use the apply endpoint for the existing posts.
+// @Tags autoTagRules
+// @Accept json
+// @Produce json
+// @Param input body request.AutoTagRuleRequest true "Rule, enabled by default"
+// @Success 200 {object} response.Response{data=models.AutoTagRule}
+// @Failure 400 {object} response.Response{} "Invalid rule"
+// @Failure 422 {object} response.Response{} "Deprecated tag"
+// @Router /autoTagRules [post]
+func (h *AutoTagRuleController) CreateAutoTagRule(c *gin.Context) {
+	db := h.DB.WithContext(c.Request.Context())
+
+	var ruleRequest request.AutoTagRuleRequest
+	if !bindRequest(c, &ruleRequest) {
+		return
+	}
+
+	var rule models.AutoTagRule
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := h.applyRuleRequest(tx, &rule, ruleRequest); err != nil {
+			return err
+		}
+		return tx.Create(&rule).Error
+	})
+	if !respondError(c, err) {
+		return
+	}
+
+	c.JSON(http.StatusOK, response.NewSuccessResponse(rule))
+}
+
+// UpdateAutoTagRule godoc
+// @Summary Update an auto-tagging rule
+// @Description Replace an auto-tagging rule, the posts are re-tagged when they are updated or by the apply endpoint
+// @Tags autoTagRules
+// @Accept json
+// @Produce json
+// @Param ruleId path int true "Rule ID"
+// @Param input body request.AutoTagRuleRequest true "Rule, enabled by default"
+// @Success 200 {object} response.Response{data=models.AutoTagRule}
+// @Failure 400 {object} response.Response{} "Invalid rule"
+// @Failure 404 {object} response.Response{} "Rule not found"
+// @Failure 422 {object} response.Response{} "Deprecated tag"
+// @Router /autoTagRules/{ruleId} [put]
+func (h *AutoTagRuleController) UpdateAutoTagRule(c *gin.Context) {
+	db := h.DB.WithContext(c.Request.Context())
+
+	var rule models.AutoTagRule
+	if err := db.First(&rule, c.Param("ruleId")).Error; err != nil {
+		c.JSON(http.StatusNotFound, response.NewErrorResponse(http.StatusNotFound, "Record not found!"))
+		return
+	}
+
+	var ruleRequest request.AutoTagRuleRequest
+	if !bindRequest(c, &ruleRequest) {
+		return
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := h.applyRuleRequest(tx, &rule, ruleRequest); err != nil {
+			return err
+		}
+		if err := tx.Save(&rule).Error; err != nil {
+			return err
+		}
+		return tx.Model(&rule).Association("Tags").Replace(rule.Tags)
+	})
+	if !respondError(c, err) {
+		return
+	}
+
+	c.JSON(http.StatusOK, response.NewSuccessResponse(rule))
+}
+
+// DeleteAutoTagRule godoc
+// @Summary Delete an auto-tagging rule
+// @Description Delete an auto-tagging rule, the tags it added are removed by the apply endpoint or when the posts are updated
+// @Tags autoTagRules
+// @Produce json
+// @Param ruleId path int true "Rule ID"
+// @Success 200 {object} DeleteTagResponse
+// @Failure 404 {object} response.Response{} "Rule not found"
+// @Router /autoTagRules/{ruleId} [delete]
+func (h *AutoTagRuleController) DeleteAutoTagRule(c *gin.Context) {
+	db := h.DB.WithContext(c.Request.Context())
+
+	var rule models.AutoTagRule
+	if err := db.First(&rule, c.Param("ruleId")).Error; err != nil {
+		c.JSON(http.StatusNotFound, response.NewErrorResponse(http.StatusNotFound, "Record not found!"))
+		return
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&rule).Association("Tags").Clear(); err != nil {
+			return err
+		}
+		return tx.Delete(&rule).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, response.NewErrorResponse(http.StatusInternalServerError, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, DeleteTagResponse{Status: "success"})
+}
+
+// DryRunAutoTagRule godoc
+// @Summary Preview an unsaved auto-tagging rule
+// @Description Return the existing posts the rule matches and the tags it would add to them, ignoring the other rules. Nothing is saved.
+// @Tags autoTagRules
+// @Accept json
+// @Produce json
+// @Param input body request.AutoTagRuleRequest true "Rule"
+// @Param limit query int false "Maximum number of listed posts (default 50, at most 500)"
+// @Success 200 {object} response.Response{data=response.AutoTagDryRunResponse}
+// @Failure 400 {object} response.Response{} "Invalid rule"
+// @Router /autoTagRules/dry-run [post]
+func (h *AutoTagRuleController) DryRunAutoTagRule(c *gin.Context) {
+	db := h.DB.WithContext(c.Request.Context())
+
+	limit, ok := dryRunLimit(c)
+	if !ok {
+		return
+	}
+
+	var ruleRequest request.AutoTagRuleRequest
+	if !bindRequest(c, &ruleRequest) {
+		return
+	}
+
+	// the tags of the rule which do not exist yet are created and rolled back
+	var preview response.AutoTagDryRunResponse
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var rule models.AutoTagRule
+		if err := h.applyRuleRequest(tx, &rule, ruleRequest); err != nil {
+			return err
+		}
+
+		var err error
+		preview, err = dryRun(tx, rule, h.Namespaces, limit)
+		if err != nil {
+			return err
+		}
+		return errDryRun
+	})
+	if errors.Is(err, errDryRun) {
+		err = nil
+	}
+	if !respondError(c, err) {
+		return
+	}
+
+	c.JSON(http.StatusOK, response.NewSuccessResponse(preview))
+}
+
+// DryRunSavedAutoTagRule godoc
+// @Summary Preview an auto-tagging rule
+// @Description Return the existing posts the rule matches and the tags it would add to them, ignoring the other rules and whether it is enabled
+// @Tags autoTagRules
+// @Produce json
+// @Param ruleId path int true "Rule ID"
+// @Param limit query int false "Maximum number of listed posts (default 50, at most 500)"
+// @Success 200 {object} response.Response{data=response.AutoTagDryRunResponse}
+// @Failure 404 {object} response.Response{} "Rule not found"
+// @Router /autoTagRules/{ruleId}/dry-run [get]
+func (h *AutoTagRuleController) DryRunSavedAutoTagRule(c *gin.Context) {
+	db := h.DB.WithContext(c.Request.Context())
+
+	limit, ok := dryRunLimit(c)
+	if !ok {
+		return
+	}
+
+	var rule models.AutoTagRule
+	if err := db.Preload("Tags").First(&rule, c.Param("ruleId")).Error; err != nil {
+		c.JSON(http.StatusNotFound, response.NewErrorResponse(http.StatusNotFound, "Record not found!"))
+		return
+	}
+
+	preview, err := dryRun(db, rule, h.Namespaces, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, response.NewErrorResponse(http.StatusInternalServerError, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, response.NewSuccessResponse(preview))
+}
+
+// ApplyAutoTagRules godoc
+// @Summary Re-apply the auto-tagging rules to all posts
+// @Description Queue a run adding the tags of the enabled rules matching every post and removing the auto tags no rule matches anymore, the tags put by users are left alone. The posts are processed in the background a batch at a time, poll the run for its progress.
+// @Tags autoTagRules
+// @Produce json
+// @Success 200 {object} response.Response{data=models.AutoTagRun}
+// @Failure 409 {object} response.Response{} "The rules are already being applied"
+// @Failure 503 {object} response.Response{} "No worker available"
+// @Router /autoTagRules/apply [post]
+func (h *AutoTagRuleController) ApplyAutoTagRules(c *gin.Context) {
+	db := h.DB.WithContext(c.Request.Context())
+
+	run, err := queueAutoTagRun(db)
+	if !respondError(c, err) {
+		return
+	}
+
+	if !h.Runs.TryEnqueue(strconv.FormatUint(uint64(run.ID), 10)) {
+		// a run left queued blocks the next ones until it times out
+		err := db.Model(&run).Updates(map[string]interface{}{"status": models.AutoTagRunFailed, "error": "not queued"}).Error
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, response.NewErrorResponse(http.StatusInternalServerError, "Run not queued and not marked failed: "+err.Error()))
+			return
+		}
+		c.JSON(http.StatusServiceUnavailable, response.NewErrorResponse(http.StatusServiceUnavailable, "No worker available, please retry later"))
+		return
+	}
+
+	c.JSON(http.StatusOK, response.NewSuccessResponse(run))
+}
+
+// GetAutoTagRun godoc
+// @Summary Get a run of the auto-tagging rules
+// @Description Get the status of a run queued by POST /autoTagRules/apply and the posts and tags it processed so far
+// @Tags autoTagRules
+// @Produce json
+// @Param runId path int true "Run ID"
+// @Success 200 {object} response.Response{data=models.AutoTagRun}
+// @Failure 404 {object} response.Response{} "Run not found"
+// @Router /autoTagRules/apply/{runId} [get]
+func (h *AutoTagRuleController) GetAutoTagRun(c *gin.Context) {
+	db := h.DB.WithContext(c.Request.Context())
+
+	var run models.AutoTagRun
+	if err := db.First(&run, c.Param("runId")).Error; err != nil {
+		c.JSON(http.StatusNotFound, response.NewErrorResponse(http.StatusNotFound, "Record not found!"))
+		return
+	}
+
+	c.JSON(http.StatusOK, response.NewSuccessResponse(run))
+}
+
+// applyRuleRequest validates the pattern of a rule request and copies it to rule,
+// resolving its tags
+func (h *AutoTagRuleController) applyRuleRequest(tx *gorm.DB, rule *models.AutoTagRule, ruleRequest request.AutoTagRuleRequest) error {
+	if _, err := autotag.Compile(ruleRequest.MatchType, ruleRequest.Pattern); err != nil {
+		return &utils.ResponseError{Message: "Invalid pattern: " + err.Error(), Status: http.StatusBadRequest}
+	}
+
+	labels := make([]models.Tag, len(ruleRequest.Tags))
+	for i, label := range ruleRequest.Tags {
+		labels[i] = models.Tag{Label: label}
+	}
+	tags, err := resolveTags(tx, h.Normalizer, labels)
+	if err != nil {
+		return err
+	}
+	if err := checkDeprecatedTags(tx, tags); err != nil {
+		return err
+	}
+
+	rule.Name = ruleRequest.Name
+	rule.Field = ruleRequest.Field
+	rule.MatchType = ruleRequest.MatchType
+	rule.Pattern = ruleRequest.Pattern
+	rule.Priority = ruleRequest.Priority
+	rule.Enabled = ruleRequest.Enabled == nil || *ruleRequest.Enabled
+	rule.Tags = tags
+
+	return nil
+}
+
+func dryRunLimit(c *gin.Context) (int, bool) {
+	limit := defaultDryRunLimit
+	if value := c.Query("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			c.JSON(http.StatusBadRequest, response.NewErrorResponse(http.StatusBadRequest, "Invalid limit"))
+			return 0, false
+		}
+		limit = min(parsed, maxDryRunLimit)
+	}
+	return limit, true
+}
+
+// dryRun matches a rule against all posts, listing at most limit of the matched
+// posts with the tags of the rule applyAutoTags would add: the ones they lack,
+// unless deprecated or beyond the namespace limits
+func dryRun(db *gorm.DB, rule models.AutoTagRule, namespaces map[string]config.TagNamespaceConfig, limit int) (response.AutoTagDryRunResponse, error) {
+	preview := response.AutoTagDryRunResponse{Posts: []response.AutoTagDryRunPostResponse{}}
+
+	compiled, err := autotag.NewRule(rule)
+	if err != nil {
+		return preview, err
+	}
+
+	var batch []models.Post
+	err = db.Select("id", "title", "content").FindInBatches(&batch, autoTagBatchSize, func(tx *gorm.DB, _ int) error {
+		var matched []models.Post
+		var matchedIDs []uint
+		for _, post := range batch {
+			if compiled.Matches(post.Title, post.Content) {
+				matched = append(matched, post)
+				matchedIDs = append(matchedIDs, post.ID)
+			}
+		}
+		if len(matched) == 0 {
+			return nil
+		}
+
+		var postTags []models.PostTag
+		if err := db.Preload("Tag").Where("post_id IN ?", matchedIDs).Find(&postTags).Error; err != nil {
+			return err
+		}
+		current := make(map[uint][]models.Tag, len(matched))
+		for _, postTag := range postTags {
+			current[postTag.PostID] = append(current[postTag.PostID], postTag.Tag)
+		}
+
+		for _, post := range matched {
+			preview.MatchedPosts++
+			if len(preview.Posts) >= limit {
+				continue
+			}
+
+			kept := current[post.ID]
+			added := []string{}
+			for _, tag := range rule.Tags {
+				if slices.ContainsFunc(kept, func(t models.Tag) bool { return t.ID == tag.ID }) ||
+					tag.Deprecated || checkNamespaceRules(append(kept, tag), namespaces) != nil {
+					continue
+				}
+				kept = append(kept, tag)
+				added = append(added, tag.Label)
+			}
+			preview.Posts = append(preview.Posts, response.AutoTagDryRunPostResponse{ID: post.ID, Title: post.Title, AddedTags: added})
+		}
+		return nil
+	}).Error
+
+	return preview, err
+}
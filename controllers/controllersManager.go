@@ -1,6 +1,10 @@
 package controllers
 
 import (
+	"github.com/fatah-illah/asset-finder/config"
+	"github.com/fatah-illah/asset-finder/jobs"
+	"github.com/fatah-illah/asset-finder/storage"
+	"github.com/fatah-illah/asset-finder/utils"
 	"gorm.io/gorm"
 )
 
@@ -8,12 +12,20 @@ type ManagerControllers struct {
 	PostController
 	TagController
 	PostTagController
+	AttachmentController
+	AutoTagRuleController
+	AssetTypeController
+	HealthController
 }
 
-func NewManagerControllers(dbInstance *gorm.DB) *ManagerControllers {
+func NewManagerControllers(dbInstance *gorm.DB, conf *config.Config, normalizer utils.TagNormalizer, blobStore storage.BlobStore, thumbnailPool, autoTagPool *jobs.Pool) *ManagerControllers {
 	return &ManagerControllers{
-		*NewPostController(dbInstance),
-		*NewTagController(dbInstance),
+		*NewPostController(dbInstance, normalizer, conf.Tags.Namespaces, blobStore, conf.Workflow.Permissions),
+		*NewTagController(dbInstance, normalizer, conf.Tags),
 		*NewPostTagsController(dbInstance),
+		*NewAttachmentController(dbInstance, blobStore, thumbnailPool, normalizer, conf.Attachments, conf.Tags.Namespaces),
+		*NewAutoTagRuleController(dbInstance, normalizer, conf.Tags.Namespaces, autoTagPool),
+		*NewAssetTypeController(dbInstance),
+		*NewHealthController(dbInstance),
 	}
 }
@@ -0,0 +1,152 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/fatah-illah/asset-finder/migrations"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	readinessTimeout = 2 * time.Second
+
+	// a ping slower than this reports the database as degraded
+	degradedPingLatency = 500 * time.Millisecond
+)
+
+const (
+	HealthStatusUp       = "up"
+	HealthStatusDegraded = "degraded"
+	HealthStatusDown     = "down"
+)
+
+type HealthController struct {
+	DB           *gorm.DB
+	shuttingDown *atomic.Bool
+}
+
+func NewHealthController(db *gorm.DB) *HealthController {
+	return &HealthController{DB: db, shuttingDown: &atomic.Bool{}}
+}
+
+// HealthCheck represents the state of a single dependency
+type HealthCheck struct {
+	Status    string      `json:"status"`
+	LatencyMs int64       `json:"latency_ms,omitempty"`
+	Error     string      `json:"error,omitempty"`
+	Details   interface{} `json:"details,omitempty"`
+}
+
+// HealthResponse represents the response format for Liveness and Readiness
+type HealthResponse struct {
+	Status string                 `json:"status"`
+	Checks map[string]HealthCheck `json:"checks,omitempty"`
+}
+
+// MarkShuttingDown makes readiness fail so traffic is drained before shutdown
+func (h *HealthController) MarkShuttingDown() {
+	h.shuttingDown.Store(true)
+}
+
+// Liveness godoc
+// @Summary Liveness probe
+// @Description Report that the process is alive
+// @Tags health
+// @Produce json
+// @Success 200 {object} HealthResponse
+// @Router /healthz [get]
+func (h *HealthController) Liveness(c *gin.Context) {
+	c.JSON(http.StatusOK, HealthResponse{Status: HealthStatusUp})
+}
+
+// Readiness godoc
+// @Summary Readiness probe
+// @Description Check the database and the schema version, and fail while shutting down
+// @Tags health
+// @Produce json
+// @Success 200 {object} HealthResponse
+// @Failure 503 {object} HealthResponse
+// @Router /readyz [get]
+func (h *HealthController) Readiness(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), readinessTimeout)
+	defer cancel()
+
+	checks := map[string]HealthCheck{
+		"database":   h.checkDatabase(ctx),
+		"migrations": h.checkMigrations(ctx),
+	}
+
+	if h.shuttingDown.Load() {
+		checks["shutdown"] = HealthCheck{Status: HealthStatusDown, Error: "server is shutting down"}
+	}
+
+	status := HealthStatusUp
+	for _, check := range checks {
+		if check.Status == HealthStatusDown {
+			status = HealthStatusDown
+			break
+		}
+		if check.Status == HealthStatusDegraded {
+			status = HealthStatusDegraded
+		}
+	}
+
+	code := http.StatusOK
+	if status == HealthStatusDown {
+		code = http.StatusServiceUnavailable
+	}
+
+	c.JSON(code, HealthResponse{Status: status, Checks: checks})
+}
+
+func (h *HealthController) checkDatabase(ctx context.Context) HealthCheck {
+	sqlDB, err := h.DB.DB()
+	if err != nil {
+		return HealthCheck{Status: HealthStatusDown, Error: err.Error()}
+	}
+
+	start := time.Now()
+	err = sqlDB.PingContext(ctx)
+	latency := time.Since(start)
+
+	if err != nil {
+		return HealthCheck{Status: HealthStatusDown, LatencyMs: latency.Milliseconds(), Error: err.Error()}
+	}
+
+	stats := sqlDB.Stats()
+	check := HealthCheck{
+		Status:    HealthStatusUp,
+		LatencyMs: latency.Milliseconds(),
+		Details: gin.H{
+			"open_connections": stats.OpenConnections,
+			"in_use":           stats.InUse,
+			"idle":             stats.Idle,
+			"wait_count":       stats.WaitCount,
+		},
+	}
+
+	poolExhausted := stats.MaxOpenConnections > 0 && stats.InUse >= stats.MaxOpenConnections
+	if latency > degradedPingLatency || poolExhausted {
+		check.Status = HealthStatusDegraded
+	}
+
+	return check
+}
+
+func (h *HealthController) checkMigrations(ctx context.Context) HealthCheck {
+	current, err := migrations.Current(ctx, h.DB)
+	if err != nil {
+		return HealthCheck{Status: HealthStatusDown, Error: err.Error()}
+	}
+
+	details := gin.H{"current": current, "expected": migrations.Latest()}
+	if current < migrations.Latest() {
+		return HealthCheck{Status: HealthStatusDown, Error: "schema is behind the expected version", Details: details}
+	}
+
+	return HealthCheck{Status: HealthStatusUp, Details: details}
+}
@@ -1,37 +1,70 @@
 package controllers
 
 import (
+	"errors"
 	"net/http"
+	"slices"
 
+	"github.com/fatah-illah/asset-finder/config"
+	"github.com/fatah-illah/asset-finder/data/request"
 	"github.com/fatah-illah/asset-finder/data/response"
 	"github.com/fatah-illah/asset-finder/models"
+	"github.com/fatah-illah/asset-finder/storage"
 	"github.com/fatah-illah/asset-finder/utils"
+	"github.com/fatah-illah/asset-finder/workflow"
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type PostController struct {
-	DB *gorm.DB
+	DB          *gorm.DB
+	Normalizer  utils.TagNormalizer
+	Namespaces  map[string]config.TagNamespaceConfig
+	Store       storage.BlobStore
+	Permissions map[string][]string
 }
 
-func NewPostController(db *gorm.DB) *PostController {
-	return &PostController{DB: db}
+func NewPostController(db *gorm.DB, normalizer utils.TagNormalizer, namespaces map[string]config.TagNamespaceConfig, store storage.BlobStore, permissions map[string][]string) *PostController {
+	return &PostController{DB: db, Normalizer: normalizer, Namespaces: namespaces, Store: store, Permissions: permissions}
 }
 
 // GetPosts godoc
-// @Summary Get a post by ID
-// @Description Get a post by its ID with tags
+// @Summary Get posts
+// @Description Get the published posts with their tags, or the posts of other statuses with an API key, optionally matching a boolean tag expression such as linux AND (prod OR staging) AND NOT deprecated over tag labels, slugs or aliases, with tag.<namespace>=<value> parameters such as tag.env=prod (repeat a parameter to match any of several values), and with metadata filters such as meta.vendor=lenovo or meta.price[lt]=1000 (operators eq, ne, lt, lte, gt and gte)
 // @Tags posts
 // @Accept json
 // @Produce json
-// @Param postId path int true "Post ID"
-// @Success 200 {object} models.Post
-// @Failure 404 {string} string "Post not found"
-// @Router /posts/{postId} [get]
+// @Param tags query string false "Tag expression with AND, OR, NOT and parentheses"
+// @Param status query []string false "Statuses (draft, in_review, published, archived or all), published by default" collectionFormat(multi)
+// @Success 200 {object} response.Response{data=[]models.Post}
+// @Failure 400 {object} response.Response{} "Invalid or too large tag expression, with its position, or invalid metadata filter or status"
+// @Failure 401 {object} response.Response{} "Unpublished posts listed without API key"
+// @Router /posts [get]
 func (h *PostController) GetPosts(c *gin.Context) {
+	db := h.DB.WithContext(c.Request.Context())
 	var posts []models.Post
 
-	if err := h.DB.Preload("Tags").Find(&posts).Error; err != nil {
+	query := db.Preload("Tags")
+	if expression := c.Query("tags"); expression != "" {
+		filtered, err := filterPostsByTags(query, h.Normalizer, expression)
+		if err != nil {
+			c.JSON(err.Status, response.NewErrorResponse(err.Status, err.Message))
+			return
+		}
+		query = filtered
+	}
+	query = filterPostsByNamespaces(query, h.Normalizer, c.Request.URL.Query())
+	query, filterErr := filterPostsByMetadata(query, c.Request.URL.Query())
+	if filterErr == nil {
+		query, filterErr = filterPostsByStatus(c, query)
+	}
+	if filterErr != nil {
+		c.JSON(filterErr.Status, response.NewErrorResponse(filterErr.Status, filterErr.Message))
+		return
+	}
+
+	if err := query.Find(&posts).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, &utils.ResponseError{
 			Message: err.Error(),
 			Status:  http.StatusInternalServerError,
@@ -47,18 +80,19 @@ func (h *PostController) GetPosts(c *gin.Context) {
 
 // GetPost godoc
 // @Summary Get a post by ID
-// @Description Get a post by its ID with tags
+// @Description Get a post by its ID with tags, an unpublished post needs an API key
 // @Tags posts
 // @Accept json
 // @Produce json
 // @Param postId path int true "Post ID"
 // @Success 200 {object} models.Post
-// @Failure 404 {string} string "Post not found"
+// @Failure 404 {string} string "Post not found, or unpublished without API key"
 // @Router /posts/{postId} [get]
 func (h *PostController) GetPost(c *gin.Context) {
+	db := h.DB.WithContext(c.Request.Context())
 	postId := c.Param("postId")
 	var post models.Post
-	if err := h.DB.Preload("Tags").First(&post, postId).Error; err != nil {
+	if err := db.Scopes(visiblePosts(c)).Preload("Tags").First(&post, postId).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Record not found!"})
 		return
 	}
@@ -67,72 +101,242 @@ func (h *PostController) GetPost(c *gin.Context) {
 
 // CreatePost godoc
 // @Summary Create a new post
-// @Description Create a new post with tags
+// @Description Create a new draft post with tags, the metadata of a post with an asset type must match the current schema of the type. Setting publish_at or unpublish_at schedules its publication or archival and needs a role allowed to approve or archive posts.
 // @Tags posts
 // @Accept json
 // @Produce json
-// @Param input body models.Post true "Post object to create"
+// @Param input body request.PostRequest true "Post object to create"
 // @Success 200 {object} models.Post
 // @Failure 400 {string} string "Bad request"
+// @Failure 403 {string} string "Publication schedule changed without the permission"
+// @Failure 422 {string} string "Deprecated tag, unknown asset type or metadata failing the schema, with the violations"
 // @Router /posts [post]
 func (h *PostController) CreatePost(c *gin.Context) {
+	db := h.DB.WithContext(c.Request.Context())
+	var postRequest request.PostRequest
+	if !bindRequest(c, &postRequest) {
+		return
+	}
+
 	var post models.Post
-	if err := c.BindJSON(&post); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	applyPostRequest(&post, postRequest)
+	// posts are published through the workflow transitions
+	post.Status = workflow.StatusDraft
+	if err := h.checkSchedule(c, models.Post{}, post); err != nil {
+		c.JSON(err.Status, gin.H{"error": err.Message})
 		return
 	}
 
-	for i, tag := range post.Tags {
-		var existingTag models.Tag
-		if err := h.DB.Where("label = ?", tag.Label).First(&existingTag).Error; err != nil {
-			h.DB.Create(&post.Tags[i])
-		} else {
-			post.Tags[i] = existingTag
+	// the tags created for a rejected post are rolled back with it
+	err := db.Transaction(func(tx *gorm.DB) error {
+		tags, err := h.resolvePostTags(tx, post.ID, post.Tags)
+		if err != nil {
+			return err
 		}
-	}
+		post.Tags = tags
+
+		if err := validatePostMetadata(tx, post); err != nil {
+			return err
+		}
+		if err := tx.Create(&post).Error; err != nil {
+			return err
+		}
+		return h.autoTag(tx, &post)
+	})
 
-	if err := h.DB.Create(&post).Error; err != nil {
+	var violationError *metadataViolationError
+	if errors.As(err, &violationError) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": violationError.Error(), "violations": violationError.Violations})
+		return
+	}
+	var responseError *utils.ResponseError
+	if errors.As(err, &responseError) {
+		c.JSON(responseError.Status, gin.H{"error": responseError.Message})
+		return
+	}
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 	c.JSON(http.StatusOK, post)
 }
 
+// applyPostRequest copies the fields of a request to post, its tags are resolved
+// by label when the post is saved
+func applyPostRequest(post *models.Post, postRequest request.PostRequest) {
+	post.Title = postRequest.Title
+	post.Content = postRequest.Content
+	post.AssetTypeID = postRequest.AssetTypeID
+	post.Metadata = postRequest.Metadata
+	post.PublishAt = postRequest.PublishAt
+	post.UnpublishAt = postRequest.UnpublishAt
+
+	post.Tags = make([]models.Tag, len(postRequest.Tags))
+	for i, tag := range postRequest.Tags {
+		post.Tags[i] = models.Tag{Label: tag.Label}
+	}
+}
+
+// resolvePostTags resolves the tags of a post, rejects the deprecated tags the
+// post does not have yet and checks the namespace rules against the resolved tags
+// and the tags the post already has, updates only add tags
+func (h *PostController) resolvePostTags(tx *gorm.DB, postID uint, tags []models.Tag) ([]models.Tag, error) {
+	resolved, err := resolveTags(tx, h.Normalizer, tags)
+	if err != nil {
+		return nil, err
+	}
+
+	var existing []models.Tag
+	if postID != 0 {
+		err := tx.Where("id IN (?)", tx.Model(&models.PostTag{}).Select("tag_id").Where("post_id = ?", postID)).
+			Find(&existing).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	has := make(map[uint]bool, len(existing))
+	for _, tag := range existing {
+		has[tag.ID] = true
+	}
+
+	added := make([]models.Tag, 0, len(resolved))
+	for _, tag := range resolved {
+		if !has[tag.ID] {
+			added = append(added, tag)
+		}
+	}
+
+	if err := checkDeprecatedTags(tx, added); err != nil {
+		return nil, err
+	}
+	if err := checkNamespaceRules(append(existing, added...), h.Namespaces); err != nil {
+		return nil, err
+	}
+	return resolved, nil
+}
+
+// autoTag applies the auto-tagging rules to a saved post and updates its tags
+func (h *PostController) autoTag(tx *gorm.DB, post *models.Post) error {
+	rules, err := loadAutoTagRules(tx)
+	if err != nil || len(rules) == 0 {
+		return err
+	}
+
+	added, removed, err := applyAutoTags(tx, *post, rules, h.Namespaces)
+	if err != nil {
+		return err
+	}
+
+	removedIDs := make(map[uint]bool, len(removed))
+	for _, tag := range removed {
+		removedIDs[tag.ID] = true
+	}
+	post.Tags = slices.DeleteFunc(post.Tags, func(tag models.Tag) bool { return removedIDs[tag.ID] })
+	post.Tags = append(post.Tags, added...)
+
+	return nil
+}
+
 // UpdatePost godoc
 // @Summary Update a post by ID
-// @Description Update a post by its ID with tags
+// @Description Update a post by its ID with tags, the metadata of a post with an asset type must match the current schema of the type. Changing publish_at or unpublish_at needs a role allowed to approve or archive posts.
 // @Tags posts
 // @Accept json
 // @Produce json
 // @Param postId path int true "Post ID"
-// @Param input body models.Post true "Post object to update"
+// @Param input body request.PostRequest true "Post object to update, the missing fields are kept"
 // @Success 200 {object} models.Post
 // @Failure 400 {string} string "Bad request"
-// @Failure 404 {string} string "Post not found"
+// @Failure 403 {string} string "Publication schedule changed without the permission"
+// @Failure 422 {string} string "Deprecated tag, unknown asset type or metadata failing the schema, with the violations"
+// @Failure 404 {string} string "Post not found, or unpublished without API key"
 // @Router /posts/{postId} [put]
 func (h *PostController) UpdatePost(c *gin.Context) {
+	db := h.DB.WithContext(c.Request.Context())
 	postId := c.Param("postId")
 	var post models.Post
-	if err := h.DB.First(&post, postId).Error; err != nil {
+	if err := db.Scopes(visiblePosts(c)).First(&post, postId).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Record not found!"})
 		return
 	}
 
-	if err := c.BindJSON(&post); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	// the fields missing from the update keep their stored value, except the metadata
+	// sent with the update which replaces the stored one rather than merging into it
+	// the decoding writes through the pointers, they are copied
+	stored := post
+	postRequest := request.PostRequest{
+		Title:       post.Title,
+		Content:     post.Content,
+		AssetTypeID: cloneID(post.AssetTypeID),
+		PublishAt:   cloneTime(post.PublishAt),
+		UnpublishAt: cloneTime(post.UnpublishAt),
+	}
+	if !bindRequest(c, &postRequest) {
 		return
 	}
 
-	for i, tag := range post.Tags {
-		var existingTag models.Tag
-		if err := h.DB.Where("label = ?", tag.Label).First(&existingTag).Error; err != nil {
-			h.DB.Create(&post.Tags[i])
-		} else {
-			post.Tags[i] = existingTag
-		}
+	applyPostRequest(&post, postRequest)
+	if post.Metadata == nil {
+		post.Metadata = stored.Metadata
 	}
 
-	if err := h.DB.Session(&gorm.Session{FullSaveAssociations: true}).Updates(&post).Error; err != nil {
+	if err := h.checkSchedule(c, stored, post); err != nil {
+		c.JSON(err.Status, gin.H{"error": err.Message})
+		return
+	}
+
+	// the tags created for a rejected post are rolled back with it
+	err := db.Transaction(func(tx *gorm.DB) error {
+		tags, err := h.resolvePostTags(tx, post.ID, post.Tags)
+		if err != nil {
+			return err
+		}
+		post.Tags = tags
+
+		if err := validatePostMetadata(tx, post); err != nil {
+			return err
+		}
+		if err := tx.Session(&gorm.Session{FullSaveAssociations: true}).Updates(&post).Error; err != nil {
+			return err
+		}
+		// Updates skips the nil fields, the nullable ones set to null are cleared here
+		err = tx.Model(&post).Updates(map[string]interface{}{
+			"asset_type_id": post.AssetTypeID,
+			"publish_at":    post.PublishAt,
+			"unpublish_at":  post.UnpublishAt,
+		}).Error
+		if err != nil {
+			return err
+		}
+
+		// the auto tags a user puts on the post are kept whatever the rules
+		if len(tags) > 0 {
+			tagIDs := make([]uint, len(tags))
+			for i, tag := range tags {
+				tagIDs[i] = tag.ID
+			}
+			err := tx.Model(&models.PostTag{}).Where("post_id = ? AND tag_id IN ?", post.ID, tagIDs).
+				Update("source", models.TagSourceManual).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		return h.autoTag(tx, &post)
+	})
+
+	var violationError *metadataViolationError
+	if errors.As(err, &violationError) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": violationError.Error(), "violations": violationError.Violations})
+		return
+	}
+	var responseError *utils.ResponseError
+	if errors.As(err, &responseError) {
+		c.JSON(responseError.Status, gin.H{"error": responseError.Message})
+		return
+	}
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -154,26 +358,62 @@ type DeletePostResponse struct {
 // @Produce json
 // @Param postId path int true "Post ID"
 // @Success 200 {object} DeletePostResponse
-// @Failure 404 {string} string "Post not found"
+// @Failure 404 {string} string "Post not found, or unpublished without API key"
 // @Router /posts/{postId} [delete]
 func (h *PostController) DeletePost(c *gin.Context) {
+	db := h.DB.WithContext(c.Request.Context())
 	postId := c.Param("postId")
 
 	var post models.Post
-	if err := h.DB.Preload("Tags").First(&post, postId).Error; err != nil {
+	if err := db.Scopes(visiblePosts(c)).Preload("Tags").First(&post, postId).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Record not found!"})
 		return
 	}
 
-	err := h.DB.Model(&post).Association("Tags").Clear()
-	if err != nil {
+	var unreferenced []string
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// the lock keeps uploads from attaching files to the post until it is
+		// deleted, and concurrent deletions from releasing its attachments twice
+		if err := utils.ForUpdate(tx).Select("id").First(&models.Post{}, post.ID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return &utils.ResponseError{Message: "Record not found!", Status: http.StatusNotFound}
+			}
+			return err
+		}
+
+		if err := tx.Model(&post).Association("Tags").Clear(); err != nil {
+			return err
+		}
+
+		// only the attachments deleted here are released
+		var attachments []models.Attachment
+		if err := tx.Clauses(clause.Returning{}).Where("post_id = ?", post.ID).Delete(&attachments).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("post_id = ?", post.ID).Delete(&models.PostTransition{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&post).Error; err != nil {
+			return err
+		}
+
+		var err error
+		unreferenced, err = releaseBlobs(tx, attachments)
+		return err
+	})
+	var responseError *utils.ResponseError
+	if errors.As(err, &responseError) {
+		c.JSON(responseError.Status, gin.H{"error": responseError.Message})
 		return
 	}
-
-	if err := h.DB.Delete(&post).Error; err != nil {
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
+	for _, key := range unreferenced {
+		deleteBlob(c.Request.Context(), h.Store, key)
+	}
+
 	c.JSON(http.StatusOK, DeletePostResponse{Status: "success"})
 }
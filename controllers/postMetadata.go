@@ -0,0 +1,168 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/fatah-illah/asset-finder/utils"
+	"gorm.io/gorm"
+)
+
+// metadataKeyPattern restricts the metadata keys of the filters, they end up in
+// JSON paths on SQLite
+var metadataKeyPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// metadataOperators maps the meta.<key>[<operator>] operators to SQL comparisons,
+// a parameter without operator is an equality
+var metadataOperators = map[string]string{
+	"eq":  "=",
+	"ne":  "<>",
+	"lt":  "<",
+	"lte": "<=",
+	"gt":  ">",
+	"gte": ">=",
+}
+
+// filterPostsByMetadata restricts query to the posts whose metadata match every
+// meta.<key> parameter: meta.vendor=lenovo matches one of the given values and
+// meta.price[lt]=1000 compares numbers, or strings when the value is not a number
+func filterPostsByMetadata(query *gorm.DB, params url.Values) (*gorm.DB, *utils.ResponseError) {
+	postgres := query.Dialector.Name() == "postgres"
+
+	for param, values := range params {
+		filter, ok := strings.CutPrefix(param, metadataParamPrefix)
+		if !ok {
+			continue
+		}
+
+		key, operator := filter, "eq"
+		if name, rest, found := strings.Cut(filter, "["); found {
+			op, closed := strings.CutSuffix(rest, "]")
+			if !closed {
+				return nil, invalidMetadataFilter(param)
+			}
+			key, operator = name, op
+		}
+		if !metadataKeyPattern.MatchString(key) {
+			return nil, invalidMetadataFilter(param)
+		}
+		if _, ok := metadataOperators[operator]; !ok {
+			return nil, invalidMetadataFilter(param)
+		}
+
+		switch operator {
+		case "eq", "ne":
+			condition, args, err := metadataEquals(postgres, key, values)
+			if err != nil {
+				return nil, &utils.ResponseError{Message: err.Error(), Status: http.StatusBadRequest}
+			}
+			if operator == "eq" {
+				query = query.Where(condition, args...)
+			} else {
+				query = query.Not(condition, args...)
+			}
+		default:
+			for _, value := range values {
+				condition, args := metadataCompare(postgres, key, metadataOperators[operator], value)
+				query = query.Where(condition, args...)
+			}
+		}
+	}
+
+	return query, nil
+}
+
+// metadataEquals matches the posts having one of values under key, a value also
+// matches the JSON number or boolean it spells. On Postgres the containment
+// operator is served by the GIN index on the metadata.
+func metadataEquals(postgres bool, key string, values []string) (string, []interface{}, error) {
+	var conditions []string
+	var args []interface{}
+
+	for _, value := range values {
+		for _, candidate := range metadataCandidates(value) {
+			if postgres {
+				document, err := json.Marshal(map[string]interface{}{key: candidate})
+				if err != nil {
+					return "", nil, err
+				}
+				conditions = append(conditions, "posts.metadata @> ?::jsonb")
+				args = append(args, string(document))
+				continue
+			}
+
+			// SQLite extracts the JSON booleans as 1 and 0, a missing key does not
+			// match rather than yielding NULL so that meta.<key>[ne] keeps the post
+			if b, ok := candidate.(bool); ok {
+				candidate = 0
+				if b {
+					candidate = 1
+				}
+			}
+			conditions = append(conditions, "COALESCE(json_extract(posts.metadata, ?) = ?, 0)")
+			args = append(args, sqliteMetadataPath(key), candidate)
+		}
+	}
+
+	return "(" + strings.Join(conditions, " OR ") + ")", args, nil
+}
+
+// metadataCompare compares the value under key with value, as numbers when value
+// is a number and as strings otherwise. Values of another JSON type never match.
+func metadataCompare(postgres bool, key, operator, value string) (string, []interface{}) {
+	number, numeric := metadataNumber(value)
+
+	switch {
+	case postgres && numeric:
+		return fmt.Sprintf("(CASE WHEN jsonb_typeof(posts.metadata -> ?::text) = 'number' THEN (posts.metadata ->> ?::text)::numeric END) %s ?", operator),
+			[]interface{}{key, key, number}
+	case postgres:
+		return fmt.Sprintf("(CASE WHEN jsonb_typeof(posts.metadata -> ?::text) = 'string' THEN posts.metadata ->> ?::text END) %s ?", operator),
+			[]interface{}{key, key, value}
+	case numeric:
+		return fmt.Sprintf("json_type(posts.metadata, ?) IN ('integer', 'real') AND json_extract(posts.metadata, ?) %s ?", operator),
+			[]interface{}{sqliteMetadataPath(key), sqliteMetadataPath(key), number}
+	default:
+		return fmt.Sprintf("json_type(posts.metadata, ?) = 'text' AND json_extract(posts.metadata, ?) %s ?", operator),
+			[]interface{}{sqliteMetadataPath(key), sqliteMetadataPath(key), value}
+	}
+}
+
+// metadataCandidates returns the JSON values a query parameter value may stand for
+func metadataCandidates(value string) []interface{} {
+	candidates := []interface{}{value}
+	if number, ok := metadataNumber(value); ok {
+		candidates = append(candidates, number)
+	}
+	if value == "true" || value == "false" {
+		candidates = append(candidates, value == "true")
+	}
+	return candidates
+}
+
+// metadataNumber parses a query parameter value standing for a JSON number, JSON
+// has no NaN or infinities although ParseFloat accepts "nan" and "inf"
+func metadataNumber(value string) (float64, bool) {
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil || math.IsNaN(number) || math.IsInf(number, 0) {
+		return 0, false
+	}
+	return number, true
+}
+
+func sqliteMetadataPath(key string) string {
+	return `$."` + key + `"`
+}
+
+func invalidMetadataFilter(param string) *utils.ResponseError {
+	return &utils.ResponseError{
+		Message: fmt.Sprintf("Invalid metadata filter %q, expected meta.<key>=<value> or meta.<key>[eq|ne|lt|lte|gt|gte]=<value>", param),
+		Status:  http.StatusBadRequest,
+	}
+}
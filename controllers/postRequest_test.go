@@ -0,0 +1,60 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/fatah-illah/asset-finder/models"
+)
+
+func TestPostRequestMetadata(t *testing.T) {
+	db := newTestDB(t)
+	posts := NewPostController(db, testNormalizer, nil, nil, nil)
+
+	router := newTestRouter()
+	router.POST("/posts", posts.CreatePost)
+	router.PUT("/posts/:postId", posts.UpdatePost)
+
+	recorder := serve(router, "editor", http.MethodPost, "/posts",
+		`{"title":"Laptop","content":"14 inch","metadata":{"vendor":"lenovo","price":900},"tags":[{"label":"Hardware"}]}`)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("POST: status = %d, body %s", recorder.Code, recorder.Body)
+	}
+	var created models.Post
+	if err := json.Unmarshal(recorder.Body.Bytes(), &created); err != nil {
+		t.Fatal(err)
+	}
+	if created.Metadata["vendor"] != "lenovo" || len(created.Tags) != 1 || created.Tags[0].Label != "Hardware" {
+		t.Errorf("created post = %+v, want the metadata and the tag of the request", created)
+	}
+
+	target := fmt.Sprintf("/posts/%d", created.ID)
+	if recorder := serve(router, "editor", http.MethodPut, target, `{"content":"15 inch"}`); recorder.Code != http.StatusOK {
+		t.Fatalf("PUT: status = %d, body %s", recorder.Code, recorder.Body)
+	}
+	var stored models.Post
+	if err := db.First(&stored, created.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if stored.Title != "Laptop" || stored.Content != "15 inch" || stored.Metadata["vendor"] != "lenovo" {
+		t.Errorf("updated post = %+v, want the missing fields kept", stored)
+	}
+
+	keys := make([]string, 101)
+	for i := range keys {
+		keys[i] = fmt.Sprintf(`"key%d":%d`, i, i)
+	}
+	tooMany := `{"title":"Desk","content":"oak","metadata":{` + strings.Join(keys, ",") + `}}`
+	if recorder := serve(router, "editor", http.MethodPost, "/posts", tooMany); recorder.Code != http.StatusBadRequest {
+		t.Errorf("POST with 101 metadata keys: status = %d, want %d", recorder.Code, http.StatusBadRequest)
+	}
+	if recorder := serve(router, "editor", http.MethodPut, target, tooMany); recorder.Code != http.StatusBadRequest {
+		t.Errorf("PUT with 101 metadata keys: status = %d, want %d", recorder.Code, http.StatusBadRequest)
+	}
+	if recorder := serve(router, "editor", http.MethodPost, "/posts", `{"content":"untitled"}`); recorder.Code != http.StatusBadRequest {
+		t.Errorf("POST without title: status = %d, want %d", recorder.Code, http.StatusBadRequest)
+	}
+}
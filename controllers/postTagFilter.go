@@ -0,0 +1,30 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/fatah-illah/asset-finder/tagexpr"
+	"github.com/fatah-illah/asset-finder/utils"
+	"gorm.io/gorm"
+)
+
+// postHasTagSQL matches the posts tagged with the tag whose normalized label,
+// slug or alias is the term
+const postHasTagSQL = `EXISTS (SELECT 1 FROM post_tags JOIN tags ON tags.id = post_tags.tag_id
+	WHERE post_tags.post_id = posts.id AND (tags.normalized_label = ? OR tags.slug = ?
+	OR tags.id IN (SELECT tag_id FROM tag_aliases WHERE normalized_alias = ?)))`
+
+// filterPostsByTags restricts query to the posts matching a boolean tag expression
+func filterPostsByTags(query *gorm.DB, normalizer utils.TagNormalizer, expression string) (*gorm.DB, *utils.ResponseError) {
+	node, err := tagexpr.Parse(expression)
+	if err != nil {
+		return nil, &utils.ResponseError{Message: "Invalid tags expression: " + err.Error(), Status: http.StatusBadRequest}
+	}
+
+	sql, args := tagexpr.SQL(node, func(tag tagexpr.Tag) (string, []interface{}) {
+		key := normalizer.Key(tag.Name)
+		return postHasTagSQL, []interface{}{key, tag.Name, key}
+	})
+
+	return query.Where(sql, args...), nil
+}
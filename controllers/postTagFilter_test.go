@@ -0,0 +1,35 @@
+package controllers
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/fatah-illah/asset-finder/tagexpr"
+)
+
+func TestTagExpressionTooLarge(t *testing.T) {
+	posts := NewPostController(newTestDB(t), testNormalizer, nil, nil, nil)
+
+	router := newTestRouter()
+	router.GET("/posts", posts.GetPosts)
+
+	terms := make([]string, tagexpr.MaxTerms+1)
+	for i := range terms {
+		terms[i] = "linux"
+	}
+	for _, expression := range []string{
+		strings.Join(terms, " OR "),
+		strings.Repeat("(", tagexpr.MaxDepth+1) + "linux" + strings.Repeat(")", tagexpr.MaxDepth+1),
+	} {
+		recorder := serve(router, "", http.MethodGet, "/posts?tags="+url.QueryEscape(expression), "")
+		if recorder.Code != http.StatusBadRequest {
+			t.Errorf("expression of %d characters: status = %d, want %d", len(expression), recorder.Code, http.StatusBadRequest)
+		}
+	}
+
+	if recorder := serve(router, "", http.MethodGet, "/posts?tags="+url.QueryEscape(strings.Join(terms[:tagexpr.MaxTerms], " OR ")), ""); recorder.Code != http.StatusOK {
+		t.Errorf("expression of %d tags: status = %d, body %s", tagexpr.MaxTerms, recorder.Code, recorder.Body)
+	}
+}
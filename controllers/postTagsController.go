@@ -19,15 +19,16 @@ func NewPostTagsController(db *gorm.DB) *PostTagController {
 
 // GetPostTags godoc
 // @Summary Get all post tags
-// @Description Get all post tags
+// @Description Get all post tags, the tags of unpublished posts need an API key
 // @Tags postTags
 // @Accept json
 // @Produce json
 // @Success 200 {array} models.PostTag
 // @Router /postTags [get]
 func (h *PostTagController) GetPostTags(c *gin.Context) {
+	db := h.DB.WithContext(c.Request.Context())
 	var postTags []models.PostTag
-	if err := h.DB.Find(&postTags).Error; err != nil {
+	if err := db.Where("post_id IN (?)", visiblePostIDs(c, db)).Find(&postTags).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -37,7 +38,7 @@ func (h *PostTagController) GetPostTags(c *gin.Context) {
 
 // GetPostTagsByPostID godoc
 // @Summary Get post tags by post ID
-// @Description Get post tags by post ID
+// @Description Get post tags by post ID, the tags of an unpublished post need an API key
 // @Tags postTags
 // @Accept json
 // @Produce json
@@ -46,6 +47,7 @@ func (h *PostTagController) GetPostTags(c *gin.Context) {
 // @Failure 400 {string} string "Invalid PostID"
 // @Router /postTags/byPost/{postId} [get]
 func (h *PostTagController) GetPostTagsByPostID(c *gin.Context) {
+	db := h.DB.WithContext(c.Request.Context())
 	postID, err := strconv.ParseUint(c.Param("postId"), 10, 64)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid PostID"})
@@ -53,7 +55,7 @@ func (h *PostTagController) GetPostTagsByPostID(c *gin.Context) {
 	}
 
 	var postTags []models.PostTag
-	if err := h.DB.Where("post_id = ?", postID).Find(&postTags).Error; err != nil {
+	if err := db.Where("post_id = ? AND post_id IN (?)", postID, visiblePostIDs(c, db)).Find(&postTags).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -63,23 +65,27 @@ func (h *PostTagController) GetPostTagsByPostID(c *gin.Context) {
 
 // GetPostTagsByTagID godoc
 // @Summary Get post tags by tag ID
-// @Description Get post tags by tag ID
+// @Description Get post tags by tag ID, including the descendant tags when include_descendants is true, the tags of unpublished posts need an API key
 // @Tags postTags
 // @Accept json
 // @Produce json
 // @Param tagId path int true "Tag ID"
+// @Param include_descendants query bool false "Include the descendant tags"
 // @Success 200 {array} models.PostTag
 // @Failure 400 {string} string "Invalid TagID"
 // @Router /postTags/byTag/{tagId} [get]
 func (h *PostTagController) GetPostTagsByTagID(c *gin.Context) {
+	db := h.DB.WithContext(c.Request.Context())
 	tagID, err := strconv.ParseUint(c.Param("tagId"), 10, 64)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid TagID"})
 		return
 	}
 
+	includeDescendants, _ := strconv.ParseBool(c.Query("include_descendants"))
+
 	var postTags []models.PostTag
-	if err := h.DB.Where("tag_id = ?", tagID).Find(&postTags).Error; err != nil {
+	if err := db.Where("tag_id IN (?) AND post_id IN (?)", tagIDsQuery(db, uint(tagID), includeDescendants), visiblePostIDs(c, db)).Find(&postTags).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -96,7 +102,7 @@ type DeletePostTagsResponse struct {
 
 // DeletePostTagsByPostID godoc
 // @Summary Delete post tags by post ID
-// @Description Delete post tags by post ID
+// @Description Delete post tags by post ID, the tags of an unpublished post need an API key
 // @Tags postTags
 // @Accept json
 // @Produce json
@@ -105,13 +111,14 @@ type DeletePostTagsResponse struct {
 // @Failure 400 {string} string "Invalid PostID"
 // @Router /postTags/byPost/{postId} [delete]
 func (h *PostTagController) DeletePostTagsByPostID(c *gin.Context) {
+	db := h.DB.WithContext(c.Request.Context())
 	postID, err := strconv.ParseUint(c.Param("postId"), 10, 64)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid PostID"})
 		return
 	}
 
-	if err := h.DB.Where("post_id = ?", postID).Delete(&models.PostTag{}).Error; err != nil {
+	if err := db.Where("post_id = ? AND post_id IN (?)", postID, visiblePostIDs(c, db)).Delete(&models.PostTag{}).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -121,7 +128,7 @@ func (h *PostTagController) DeletePostTagsByPostID(c *gin.Context) {
 
 // DeletePostTagsByTagID godoc
 // @Summary Delete post tags by tag ID
-// @Description Delete post tags by tag ID
+// @Description Delete post tags by tag ID, the tags of unpublished posts are only deleted with an API key
 // @Tags postTags
 // @Accept json
 // @Produce json
@@ -130,13 +137,14 @@ func (h *PostTagController) DeletePostTagsByPostID(c *gin.Context) {
 // @Failure 400 {string} string "Invalid TagID"
 // @Router /postTags/byTag/{tagId} [delete]
 func (h *PostTagController) DeletePostTagsByTagID(c *gin.Context) {
+	db := h.DB.WithContext(c.Request.Context())
 	tagID, err := strconv.ParseUint(c.Param("tagId"), 10, 64)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid TagID"})
 		return
 	}
 
-	if err := h.DB.Where("tag_id = ?", tagID).Delete(&models.PostTag{}).Error; err != nil {
+	if err := db.Where("tag_id = ? AND post_id IN (?)", tagID, visiblePostIDs(c, db)).Delete(&models.PostTag{}).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
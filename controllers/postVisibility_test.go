@@ -0,0 +1,90 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/fatah-illah/asset-finder/config"
+	"github.com/fatah-illah/asset-finder/models"
+	"github.com/fatah-illah/asset-finder/storage"
+	"github.com/fatah-illah/asset-finder/utils"
+	"github.com/fatah-illah/asset-finder/workflow"
+)
+
+func TestUnpublishedPostsHiddenFromAnonymousCallers(t *testing.T) {
+	db := newTestDB(t)
+	store, err := storage.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	posts := NewPostController(db, utils.TagNormalizer{}, nil, store, nil)
+	attachments := NewAttachmentController(db, store, nil, utils.TagNormalizer{}, config.AttachmentsConfig{MaxSize: 1024}, nil)
+
+	router := newTestRouter()
+	router.GET("/posts/:postId", posts.GetPost)
+	router.PUT("/posts/:postId", posts.UpdatePost)
+	router.DELETE("/posts/:postId", posts.DeletePost)
+	router.POST("/posts/:postId/attachments", attachments.UploadAttachment)
+	router.GET("/attachments/:attachmentId", attachments.GetAttachment)
+	router.DELETE("/attachments/:attachmentId", attachments.DeleteAttachment)
+
+	hash := strings.Repeat("a", 64)
+	draft := models.Post{Title: "Draft", Content: "unreleased", Status: workflow.StatusDraft}
+	if err := db.Create(&draft).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&models.Blob{SHA256: hash, Size: 1, ContentType: "text/plain", StorageKey: "blobs/" + hash, RefCount: 1}).Error; err != nil {
+		t.Fatal(err)
+	}
+	attachment := models.Attachment{PostID: draft.ID, FileName: "notes.txt", ContentType: "text/plain", Size: 1, SHA256: hash}
+	if err := db.Create(&attachment).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	postURL := "/posts/" + strconv.FormatUint(uint64(draft.ID), 10)
+	attachmentURL := "/attachments/" + strconv.FormatUint(uint64(attachment.ID), 10)
+
+	requests := []struct{ method, target, body string }{
+		{http.MethodGet, postURL, ""},
+		{http.MethodPut, postURL, `{}`},
+		{http.MethodPut, postURL, `{"content":"changed"}`},
+		{http.MethodPost, postURL + "/attachments", ""},
+		{http.MethodGet, attachmentURL, ""},
+		{http.MethodDelete, attachmentURL, ""},
+		{http.MethodDelete, postURL, ""},
+	}
+	for _, request := range requests {
+		recorder := serve(router, "", request.method, request.target, request.body)
+		if recorder.Code != http.StatusNotFound {
+			t.Errorf("anonymous %s %s: status = %d, want %d", request.method, request.target, recorder.Code, http.StatusNotFound)
+		}
+		if strings.Contains(recorder.Body.String(), draft.Content) {
+			t.Errorf("anonymous %s %s: the draft content is returned", request.method, request.target)
+		}
+	}
+
+	var stored models.Post
+	if err := db.First(&stored, draft.ID).Error; err != nil {
+		t.Fatalf("the draft was deleted: %v", err)
+	}
+	if stored.Content != draft.Content {
+		t.Errorf("content = %q, want the draft unchanged", stored.Content)
+	}
+	var count int64
+	if err := db.Model(&models.Attachment{}).Where("id = ?", attachment.ID).Count(&count).Error; err != nil || count != 1 {
+		t.Errorf("the attachment was deleted: %v", err)
+	}
+
+	if recorder := serve(router, "editor", http.MethodGet, postURL, ""); recorder.Code != http.StatusOK {
+		t.Errorf("authenticated GET: status = %d, want %d", recorder.Code, http.StatusOK)
+	}
+	if recorder := serve(router, "editor", http.MethodDelete, attachmentURL, ""); recorder.Code != http.StatusOK {
+		t.Errorf("authenticated DELETE attachment: status = %d, want %d", recorder.Code, http.StatusOK)
+	}
+	if recorder := serve(router, "editor", http.MethodDelete, postURL, ""); recorder.Code != http.StatusOK {
+		t.Errorf("authenticated DELETE post: status = %d, want %d", recorder.Code, http.StatusOK)
+	}
+}
@@ -0,0 +1,298 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fatah-illah/asset-finder/data/request"
+	"github.com/fatah-illah/asset-finder/data/response"
+	"github.com/fatah-illah/asset-finder/middleware"
+	"github.com/fatah-illah/asset-finder/models"
+	"github.com/fatah-illah/asset-finder/utils"
+	"github.com/fatah-illah/asset-finder/workflow"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// statusAll lists the posts of every status
+const statusAll = "all"
+
+const (
+	defaultScheduledLimit = 100
+	maxScheduledLimit     = 1000
+)
+
+// TransitionPost godoc
+// @Summary Change the publication status of a post
+// @Description Apply a workflow transition to a post: submit a draft for review, approve or reject a post in review, or archive a post. Each transition is allowed to the roles configured in workflow.permissions and recorded in the history of the post; a rejection needs a comment.
+// @Tags posts
+// @Accept json
+// @Produce json
+// @Param postId path int true "Post ID"
+// @Param transition path string true "Transition" Enums(submit, approve, reject, archive)
+// @Param input body request.PostTransitionRequest false "Comment"
+// @Success 200 {object} response.Response{data=models.PostTransition}
+// @Failure 400 {object} response.Response{} "Unknown transition or missing comment"
+// @Failure 401 {object} response.Response{} "Missing or invalid API key"
+// @Failure 403 {object} response.Response{} "Transition not allowed to the role"
+// @Failure 404 {object} response.Response{} "Post not found"
+// @Failure 409 {object} response.Response{} "Transition not allowed from the status of the post"
+// @Router /posts/{postId}/transitions/{transition} [post]
+func (h *PostController) TransitionPost(c *gin.Context) {
+	db := h.DB.WithContext(c.Request.Context())
+
+	transition, ok := workflow.Lookup(c.Param("transition"))
+	if !ok || transition.Scheduled {
+		message := fmt.Sprintf("Unknown transition %q, expected one of %s", c.Param("transition"), strings.Join(workflow.Names(), ", "))
+		c.JSON(http.StatusBadRequest, response.NewErrorResponse(http.StatusBadRequest, message))
+		return
+	}
+
+	user, role := middleware.Identity(c)
+	if user == "" {
+		c.JSON(http.StatusUnauthorized, response.NewErrorResponse(http.StatusUnauthorized, "An API key is required"))
+		return
+	}
+	if !slices.Contains(h.Permissions[transition.Name], role) {
+		message := fmt.Sprintf("The %s role is not allowed to %s posts", role, transition.Name)
+		c.JSON(http.StatusForbidden, response.NewErrorResponse(http.StatusForbidden, message))
+		return
+	}
+
+	var transitionRequest request.PostTransitionRequest
+	if c.Request.ContentLength != 0 && !bindRequest(c, &transitionRequest) {
+		return
+	}
+	if transition.Name == workflow.TransitionReject && strings.TrimSpace(transitionRequest.Comment) == "" {
+		c.JSON(http.StatusBadRequest, response.NewErrorResponse(http.StatusBadRequest, "A comment is required to reject a post"))
+		return
+	}
+
+	record := models.PostTransition{Actor: user, Role: role, Comment: transitionRequest.Comment}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var post models.Post
+		err := utils.ForUpdate(tx).Select("id", "status").First(&post, c.Param("postId")).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return &utils.ResponseError{Message: "Record not found!", Status: http.StatusNotFound}
+		}
+		if err != nil {
+			return err
+		}
+
+		return transitionPost(tx, post, transition, &record)
+	})
+	if !respondError(c, err) {
+		return
+	}
+
+	c.JSON(http.StatusOK, response.NewSuccessResponse(record))
+}
+
+// GetPostTransitions godoc
+// @Summary Get the publication history of a post
+// @Description Get the workflow transitions applied to a post, the oldest first
+// @Tags posts
+// @Produce json
+// @Param postId path int true "Post ID"
+// @Success 200 {object} response.Response{data=[]models.PostTransition}
+// @Failure 404 {object} response.Response{} "Post not found, or unpublished without API key"
+// @Router /posts/{postId}/transitions [get]
+func (h *PostController) GetPostTransitions(c *gin.Context) {
+	db := h.DB.WithContext(c.Request.Context())
+
+	var post models.Post
+	if err := db.Scopes(visiblePosts(c)).Select("id").First(&post, c.Param("postId")).Error; err != nil {
+		c.JSON(http.StatusNotFound, response.NewErrorResponse(http.StatusNotFound, "Record not found!"))
+		return
+	}
+
+	transitions := []models.PostTransition{}
+	if err := db.Where("post_id = ?", post.ID).Order("id").Find(&transitions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, response.NewErrorResponse(http.StatusInternalServerError, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, response.NewSuccessResponse(transitions))
+}
+
+// GetScheduledPosts godoc
+// @Summary Get the scheduled publication changes
+// @Description List the upcoming publications (publish_at) and archivals (unpublish_at) of posts, the earliest first. The due changes are applied by the scheduler every workflow.scheduler_interval.
+// @Tags posts
+// @Produce json
+// @Param limit query int false "Maximum number of changes (default 100, at most 1000)"
+// @Success 200 {object} response.Response{data=[]response.ScheduledPostResponse}
+// @Failure 400 {object} response.Response{} "Invalid limit"
+// @Failure 401 {object} response.Response{} "Missing or invalid API key"
+// @Router /posts/scheduled [get]
+func (h *PostController) GetScheduledPosts(c *gin.Context) {
+	db := h.DB.WithContext(c.Request.Context())
+
+	if user, _ := middleware.Identity(c); user == "" {
+		c.JSON(http.StatusUnauthorized, response.NewErrorResponse(http.StatusUnauthorized, "An API key is required"))
+		return
+	}
+
+	limit := defaultScheduledLimit
+	if value := c.Query("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 {
+			c.JSON(http.StatusBadRequest, response.NewErrorResponse(http.StatusBadRequest, "Invalid limit"))
+			return
+		}
+		limit = min(parsed, maxScheduledLimit)
+	}
+
+	publish, _ := workflow.Lookup(workflow.TransitionPublish)
+	unpublish, _ := workflow.Lookup(workflow.TransitionUnpublish)
+
+	var publications, archivals []models.Post
+	err := db.Select("id", "title", "status", "publish_at").
+		Where("publish_at IS NOT NULL AND status IN ?", publish.From).
+		Order("publish_at, id").Limit(limit).Find(&publications).Error
+	if err == nil {
+		// the posts still to be published are listed too, they are archived once published
+		err = db.Select("id", "title", "status", "unpublish_at").
+			Where("unpublish_at IS NOT NULL AND status IN ?", append(slices.Clone(unpublish.From), publish.From...)).
+			Order("unpublish_at, id").Limit(limit).Find(&archivals).Error
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, response.NewErrorResponse(http.StatusInternalServerError, err.Error()))
+		return
+	}
+
+	scheduled := make([]response.ScheduledPostResponse, 0, len(publications)+len(archivals))
+	for _, post := range publications {
+		scheduled = append(scheduled, response.ScheduledPostResponse{PostID: post.ID, Title: post.Title, Status: post.Status, Transition: publish.Name, At: *post.PublishAt})
+	}
+	for _, post := range archivals {
+		scheduled = append(scheduled, response.ScheduledPostResponse{PostID: post.ID, Title: post.Title, Status: post.Status, Transition: unpublish.Name, At: *post.UnpublishAt})
+	}
+	slices.SortStableFunc(scheduled, func(a, b response.ScheduledPostResponse) int { return a.At.Compare(b.At) })
+	if len(scheduled) > limit {
+		scheduled = scheduled[:limit]
+	}
+
+	c.JSON(http.StatusOK, response.NewSuccessResponse(scheduled))
+}
+
+// checkSchedule rejects the changes of the publication times of a post by the
+// callers whose role may not approve (publish_at) or archive (unpublish_at) posts
+func (h *PostController) checkSchedule(c *gin.Context, stored, post models.Post) *utils.ResponseError {
+	if post.PublishAt != nil && post.UnpublishAt != nil && !post.UnpublishAt.After(*post.PublishAt) {
+		return &utils.ResponseError{Message: "unpublish_at must be after publish_at", Status: http.StatusBadRequest}
+	}
+
+	_, role := middleware.Identity(c)
+	for _, change := range []struct {
+		field      string
+		transition string
+		changed    bool
+	}{
+		{"publish_at", workflow.TransitionApprove, !sameTime(stored.PublishAt, post.PublishAt)},
+		{"unpublish_at", workflow.TransitionArchive, !sameTime(stored.UnpublishAt, post.UnpublishAt)},
+	} {
+		if change.changed && !slices.Contains(h.Permissions[change.transition], role) {
+			return &utils.ResponseError{
+				Message: fmt.Sprintf("Changing %s needs an API key whose role is allowed to %s posts", change.field, change.transition),
+				Status:  http.StatusForbidden,
+			}
+		}
+	}
+
+	return nil
+}
+
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
+
+func cloneTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	clone := *t
+	return &clone
+}
+
+func cloneID(id *uint) *uint {
+	if id == nil {
+		return nil
+	}
+	clone := *id
+	return &clone
+}
+
+// transitionPost moves a post locked by the caller to the status of the
+// transition and records it, completing record
+func transitionPost(tx *gorm.DB, post models.Post, transition workflow.Transition, record *models.PostTransition) error {
+	status, err := transition.Apply(post.Status)
+	if err != nil {
+		return &utils.ResponseError{Message: err.Error(), Status: http.StatusConflict}
+	}
+
+	record.PostID = post.ID
+	record.Transition = transition.Name
+	record.FromStatus = post.Status
+	record.ToStatus = status
+
+	if err := tx.Model(&post).Update("status", status).Error; err != nil {
+		return err
+	}
+	return tx.Create(record).Error
+}
+
+// filterPostsByStatus restricts query to the published posts, or to the statuses
+// of the status parameters (all for every status) which need an authenticated caller
+func filterPostsByStatus(c *gin.Context, query *gorm.DB) (*gorm.DB, *utils.ResponseError) {
+	statuses := c.QueryArray("status")
+	if len(statuses) == 0 {
+		return query.Where("posts.status = ?", workflow.StatusPublished), nil
+	}
+
+	for _, status := range statuses {
+		if status != statusAll && !slices.Contains(workflow.Statuses, status) {
+			return nil, &utils.ResponseError{
+				Message: fmt.Sprintf("Invalid status %q, expected one of %s or %s", status, strings.Join(workflow.Statuses, ", "), statusAll),
+				Status:  http.StatusBadRequest,
+			}
+		}
+	}
+
+	if user, _ := middleware.Identity(c); user == "" && slices.ContainsFunc(statuses, func(status string) bool {
+		return status != workflow.StatusPublished
+	}) {
+		return nil, &utils.ResponseError{Message: "An API key is required to list unpublished posts", Status: http.StatusUnauthorized}
+	}
+
+	if slices.Contains(statuses, statusAll) {
+		return query, nil
+	}
+	return query.Where("posts.status IN ?", statuses), nil
+}
+
+// visiblePosts is the scope of the posts a caller may see: the published ones
+// without an API key, every post otherwise
+func visiblePosts(c *gin.Context) func(*gorm.DB) *gorm.DB {
+	user, _ := middleware.Identity(c)
+	return func(query *gorm.DB) *gorm.DB {
+		if user != "" {
+			return query
+		}
+		return query.Where("posts.status = ?", workflow.StatusPublished)
+	}
+}
+
+// visiblePostIDs selects the IDs of the posts visible to the caller, to restrict
+// the rows belonging to posts
+func visiblePostIDs(c *gin.Context, db *gorm.DB) *gorm.DB {
+	return db.Model(&models.Post{}).Select("posts.id").Scopes(visiblePosts(c))
+}
@@ -0,0 +1,59 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"regexp"
+
+	"github.com/fatah-illah/asset-finder/data/response"
+	"github.com/fatah-illah/asset-finder/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+// rgbColorPattern matches the #RGB and #RRGGBB colors, which fit the 7 characters
+// of the color columns unlike the #RRGGBBAA accepted by hexcolor
+var rgbColorPattern = regexp.MustCompile(`^#(?:[0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+
+var validate = newValidator()
+
+func newValidator() *validator.Validate {
+	v := validator.New()
+	if err := v.RegisterValidation("rgbcolor", func(fl validator.FieldLevel) bool {
+		return rgbColorPattern.MatchString(fl.Field().String())
+	}); err != nil {
+		panic(err)
+	}
+	return v
+}
+
+// bindRequest decodes the JSON body into req and checks its validate tags,
+// answering 400 and returning false when the request is invalid.
+func bindRequest(c *gin.Context, req interface{}) bool {
+	if err := c.ShouldBindJSON(req); err != nil {
+		c.JSON(http.StatusBadRequest, response.NewErrorResponse(http.StatusBadRequest, err.Error()))
+		return false
+	}
+
+	if err := validate.Struct(req); err != nil {
+		c.JSON(http.StatusBadRequest, response.NewErrorResponse(http.StatusBadRequest, err.Error()))
+		return false
+	}
+
+	return true
+}
+
+// respondError answers the error of a request, with its status when it is a
+// *utils.ResponseError, and returns whether there was none
+func respondError(c *gin.Context, err error) bool {
+	var responseError *utils.ResponseError
+	if errors.As(err, &responseError) {
+		c.JSON(responseError.Status, response.NewErrorResponse(responseError.Status, responseError.Message))
+		return false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, response.NewErrorResponse(http.StatusInternalServerError, err.Error()))
+		return false
+	}
+	return true
+}
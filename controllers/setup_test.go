@@ -0,0 +1,76 @@
+package controllers
+
+import (
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fatah-illah/asset-finder/middleware"
+	"github.com/fatah-illah/asset-finder/migrations"
+	"github.com/fatah-illah/asset-finder/models"
+	"github.com/fatah-illah/asset-finder/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// testUserHeader names the user of a test request, standing for the API key
+// checked by the authenticator
+const testUserHeader = "X-Test-User"
+
+var testNormalizer = utils.TagNormalizer{Trim: true, NFC: true, CaseFold: true, CollapseWhitespace: true}
+
+// newTestDB opens a SQLite database with the tables of the models, migrated
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "test.db")
+	db, err := gorm.Open(sqlite.Open(path+"?_pragma=foreign_keys(1)"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := models.SetupJoinTables(db); err != nil {
+		t.Fatal(err)
+	}
+	err = db.AutoMigrate(&models.Post{}, &models.Tag{}, &models.PostTag{}, &models.TagAlias{}, &models.AutoTagRule{},
+		&models.AssetType{}, &models.AssetTypeSchema{}, &models.PostTransition{}, &models.Blob{}, &models.BlobMetadata{},
+		&models.Thumbnail{}, &models.Attachment{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the unique indexes of the tags are created by the migrations
+	if err := migrations.Run(db, migrations.Options{TagNormalizer: testNormalizer}); err != nil {
+		t.Fatal(err)
+	}
+
+	return db
+}
+
+// newTestRouter returns a router identifying the caller by testUserHeader
+func newTestRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		if user := c.GetHeader(testUserHeader); user != "" {
+			c.Set(middleware.ContextUserKey, user)
+			c.Set(middleware.ContextRoleKey, "editor")
+		}
+	})
+	return r
+}
+
+// serve sends a JSON request to router, as user unless it is empty
+func serve(router *gin.Engine, user, method, target, body string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(method, target, strings.NewReader(body))
+	request.Header.Set("Content-Type", "application/json")
+	if user != "" {
+		request.Header.Set(testUserHeader, user)
+	}
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	return recorder
+}
@@ -0,0 +1,92 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/fatah-illah/asset-finder/data/response"
+	"github.com/fatah-illah/asset-finder/models"
+	"github.com/fatah-illah/asset-finder/workflow"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultSimilarLimit = 10
+	maxSimilarLimit     = 50
+)
+
+// similarPostsSQL ranks the posts sharing a tag with a post by weighted Jaccard
+// similarity, among the published posts: the weight of the shared tags over the weight of all the tags of
+// both posts. A tag weighs its inverse document frequency ln(1 + posts / posts
+// with the tag), so that rare tags count more.
+const similarPostsSQL = `WITH mine AS (
+	SELECT tag_id FROM post_tags WHERE post_id = @post
+), candidates AS (
+	SELECT DISTINCT post_id FROM post_tags WHERE tag_id IN (SELECT tag_id FROM mine) AND post_id <> @post
+), total AS (
+	SELECT COUNT(*) AS posts FROM posts
+), idf AS (
+	SELECT post_tags.tag_id, LN(1.0 + total.posts * 1.0 / COUNT(*)) AS weight
+	FROM post_tags CROSS JOIN total
+	WHERE post_tags.tag_id IN (
+		SELECT tag_id FROM post_tags WHERE post_id = @post OR post_id IN (SELECT post_id FROM candidates)
+	)
+	GROUP BY post_tags.tag_id, total.posts
+), weights AS (
+	SELECT post_tags.post_id,
+		SUM(idf.weight) AS total_weight,
+		SUM(CASE WHEN post_tags.tag_id IN (SELECT tag_id FROM mine) THEN idf.weight ELSE 0 END) AS shared_weight,
+		SUM(CASE WHEN post_tags.tag_id IN (SELECT tag_id FROM mine) THEN 1 ELSE 0 END) AS shared_tags
+	FROM post_tags JOIN idf ON idf.tag_id = post_tags.tag_id
+	WHERE post_tags.post_id IN (SELECT post_id FROM candidates)
+	GROUP BY post_tags.post_id
+), mine_weight AS (
+	SELECT SUM(idf.weight) AS weight FROM mine JOIN idf ON idf.tag_id = mine.tag_id
+)
+SELECT posts.id, posts.title, weights.shared_tags,
+	weights.shared_weight / (mine_weight.weight + weights.total_weight - weights.shared_weight) AS similarity
+FROM weights
+JOIN posts ON posts.id = weights.post_id AND posts.status = @status
+CROSS JOIN mine_weight
+ORDER BY similarity DESC, posts.id
+LIMIT @limit`
+
+// GetSimilarPosts godoc
+// @Summary Get the posts similar to a post
+// @Description Rank the published posts sharing tags with the post by IDF weighted Jaccard similarity of their tags, rare tags counting more
+// @Tags posts
+// @Produce json
+// @Param postId path int true "Post ID"
+// @Param limit query int false "Maximum number of posts (default 10, at most 50)"
+// @Success 200 {object} response.Response{data=[]response.SimilarPostResponse}
+// @Failure 400 {object} response.Response{} "Invalid limit"
+// @Failure 404 {object} response.Response{} "Post not found, or unpublished without API key"
+// @Router /posts/{postId}/similar [get]
+func (h *PostController) GetSimilarPosts(c *gin.Context) {
+	db := h.DB.WithContext(c.Request.Context())
+
+	var post models.Post
+	if err := db.Scopes(visiblePosts(c)).Select("id").First(&post, c.Param("postId")).Error; err != nil {
+		c.JSON(http.StatusNotFound, response.NewErrorResponse(http.StatusNotFound, "Record not found!"))
+		return
+	}
+
+	limit := defaultSimilarLimit
+	if value := c.Query("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			c.JSON(http.StatusBadRequest, response.NewErrorResponse(http.StatusBadRequest, "Invalid limit"))
+			return
+		}
+		limit = min(parsed, maxSimilarLimit)
+	}
+
+	similar := []response.SimilarPostResponse{}
+	err := db.Raw(similarPostsSQL, map[string]interface{}{"post": post.ID, "status": workflow.StatusPublished, "limit": limit}).Scan(&similar).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, response.NewErrorResponse(http.StatusInternalServerError, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, response.NewSuccessResponse(similar))
+}
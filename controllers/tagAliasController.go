@@ -0,0 +1,274 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/fatah-illah/asset-finder/data/request"
+	"github.com/fatah-illah/asset-finder/data/response"
+	"github.com/fatah-illah/asset-finder/models"
+	"github.com/fatah-illah/asset-finder/utils"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// MergeTags godoc
+// @Summary Merge tags into a target tag
+// @Description Re-point the post associations of the source tags to the target, keep their labels as aliases and delete them
+// @Tags tags
+// @Accept json
+// @Produce json
+// @Param tagId path int true "Target tag ID"
+// @Param input body request.TagMergeRequest true "Source tags"
+// @Success 200 {object} response.Response{data=response.TagMergeResponse}
+// @Failure 404 {object} response.Response{} "Tag not found"
+// @Failure 422 {object} response.Response{} "Invalid source tags"
+// @Router /tags/{tagId}/merge [post]
+func (h *TagController) MergeTags(c *gin.Context) {
+	db := h.DB.WithContext(c.Request.Context())
+
+	targetID, err := strconv.ParseUint(c.Param("tagId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, response.NewErrorResponse(http.StatusBadRequest, "Invalid TagID"))
+		return
+	}
+
+	var mergeRequest request.TagMergeRequest
+	if !bindRequest(c, &mergeRequest) {
+		return
+	}
+
+	var result response.TagMergeResponse
+	err = db.Transaction(func(tx *gorm.DB) error {
+		merged, err := mergeTags(tx, h.Normalizer, uint(targetID), mergeRequest.SourceIDs)
+		result = merged
+		return err
+	})
+
+	var responseError *utils.ResponseError
+	if errors.As(err, &responseError) {
+		c.JSON(responseError.Status, response.NewErrorResponse(responseError.Status, responseError.Message))
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, response.NewErrorResponse(http.StatusInternalServerError, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, response.NewSuccessResponse(result))
+}
+
+func mergeTags(tx *gorm.DB, normalizer utils.TagNormalizer, targetID uint, sourceIDs []uint) (response.TagMergeResponse, error) {
+	result := response.TagMergeResponse{TagID: targetID, MergedTagIDs: sourceIDs, AliasesCreated: []string{}}
+
+	if err := lockTagHierarchy(tx); err != nil {
+		return result, err
+	}
+
+	var target models.Tag
+	if err := utils.ForUpdate(tx).First(&target, targetID).Error; err != nil {
+		return result, &utils.ResponseError{Message: "Target tag not found", Status: http.StatusNotFound}
+	}
+
+	isSource := make(map[uint]bool, len(sourceIDs))
+	for _, id := range sourceIDs {
+		if id == targetID {
+			return result, &utils.ResponseError{Message: "A tag cannot be merged into itself", Status: http.StatusUnprocessableEntity}
+		}
+		isSource[id] = true
+	}
+
+	var sources []models.Tag
+	if err := utils.ForUpdate(tx).Where("id IN ?", sourceIDs).Find(&sources).Error; err != nil {
+		return result, err
+	}
+	if len(sources) != len(isSource) {
+		return result, &utils.ResponseError{Message: "Source tag not found", Status: http.StatusNotFound}
+	}
+
+	// the target takes the place of the highest source it is nested under, so that
+	// the children of the sources moving below the target cannot form a cycle
+	ancestors, err := ancestorTags(tx, targetID)
+	if err != nil {
+		return result, err
+	}
+	for _, ancestor := range ancestors {
+		if isSource[ancestor.ID] {
+			if err := tx.Model(&target).Update("parent_id", ancestor.ParentID).Error; err != nil {
+				return result, err
+			}
+		}
+	}
+	if err := tx.Model(&models.Tag{}).Where("parent_id IN ? AND id <> ?", sourceIDs, targetID).Update("parent_id", targetID).Error; err != nil {
+		return result, err
+	}
+
+	// posts tagged with both a source and the target keep a single association,
+	// the composite primary key of post_tags forbids duplicates. It is manual when
+	// one of the merged associations is, the sources sort that way.
+	moved := tx.Exec(`INSERT INTO post_tags (tag_id, post_id, created_at, source)
+		SELECT ?, post_id, MIN(created_at), MAX(source) FROM post_tags
+		WHERE tag_id IN ? AND post_id NOT IN (SELECT post_id FROM post_tags WHERE tag_id = ?)
+		GROUP BY post_id`,
+		targetID, sourceIDs, targetID)
+	if moved.Error != nil {
+		return result, moved.Error
+	}
+	result.AssociationsMoved = moved.RowsAffected
+
+	// posts that already had the target keep it as manual when a merged association
+	// is, the auto-tagger must not remove it later
+	manualSources := tx.Model(&models.PostTag{}).Select("post_id").Where("tag_id IN ? AND source = ?", sourceIDs, models.TagSourceManual)
+	err = tx.Model(&models.PostTag{}).Where("tag_id = ? AND source <> ? AND post_id IN (?)", targetID, models.TagSourceManual, manualSources).
+		Update("source", models.TagSourceManual).Error
+	if err != nil {
+		return result, err
+	}
+
+	if err := tx.Where("tag_id IN ?", sourceIDs).Delete(&models.PostTag{}).Error; err != nil {
+		return result, err
+	}
+
+	if err := tx.Model(&models.TagAlias{}).Where("tag_id IN ?", sourceIDs).Update("tag_id", targetID).Error; err != nil {
+		return result, err
+	}
+
+	// deprecated tags replaced by a source are now replaced by the target
+	if err := tx.Model(&models.Tag{}).Where("replacement_tag_id IN ? AND id <> ?", sourceIDs, targetID).Update("replacement_tag_id", targetID).Error; err != nil {
+		return result, err
+	}
+	if target.ReplacementTagID != nil && isSource[*target.ReplacementTagID] {
+		if err := tx.Model(&target).Update("replacement_tag_id", nil).Error; err != nil {
+			return result, err
+		}
+	}
+
+	for _, source := range sources {
+		key := normalizer.Key(source.Label)
+		if key == normalizer.Key(target.Label) {
+			continue
+		}
+
+		// an existing alias of the label is kept
+		alias := models.TagAlias{Alias: source.Label, NormalizedAlias: key, TagID: targetID}
+		created := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&alias)
+		if created.Error != nil {
+			return result, created.Error
+		}
+		if created.RowsAffected > 0 {
+			result.AliasesCreated = append(result.AliasesCreated, source.Label)
+		}
+	}
+
+	if err := tx.Delete(&models.Tag{}, sourceIDs).Error; err != nil {
+		return result, err
+	}
+
+	return result, nil
+}
+
+// GetTagAliases godoc
+// @Summary Get the aliases of a tag
+// @Description Return the alternative labels resolving to the tag
+// @Tags tags
+// @Produce json
+// @Param tagId path int true "Tag ID"
+// @Success 200 {object} response.Response{data=[]models.TagAlias}
+// @Router /tags/{tagId}/aliases [get]
+func (h *TagController) GetTagAliases(c *gin.Context) {
+	db := h.DB.WithContext(c.Request.Context())
+
+	var aliases []models.TagAlias
+	if err := db.Where("tag_id = ?", c.Param("tagId")).Order("alias").Find(&aliases).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, response.NewErrorResponse(http.StatusInternalServerError, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, response.NewSuccessResponse(aliases))
+}
+
+// CreateTagAlias godoc
+// @Summary Add an alias to a tag
+// @Description Make a label resolve to the tag when posts are created or updated
+// @Tags tags
+// @Accept json
+// @Produce json
+// @Param tagId path int true "Tag ID"
+// @Param input body request.TagAliasRequest true "Alias"
+// @Success 200 {object} response.Response{data=models.TagAlias}
+// @Failure 404 {object} response.Response{} "Tag not found"
+// @Failure 409 {object} response.Response{} "Alias already used"
+// @Router /tags/{tagId}/aliases [post]
+func (h *TagController) CreateTagAlias(c *gin.Context) {
+	db := h.DB.WithContext(c.Request.Context())
+
+	var tag models.Tag
+	if err := db.First(&tag, c.Param("tagId")).Error; err != nil {
+		c.JSON(http.StatusNotFound, response.NewErrorResponse(http.StatusNotFound, "Record not found!"))
+		return
+	}
+
+	var aliasRequest request.TagAliasRequest
+	if !bindRequest(c, &aliasRequest) {
+		return
+	}
+
+	key := h.Normalizer.Key(aliasRequest.Alias)
+	if key == "" {
+		c.JSON(http.StatusBadRequest, response.NewErrorResponse(http.StatusBadRequest, "Alias must not be empty"))
+		return
+	}
+
+	var conflicts int64
+	if err := db.Model(&models.Tag{}).Where("normalized_label = ?", key).Count(&conflicts).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, response.NewErrorResponse(http.StatusInternalServerError, err.Error()))
+		return
+	}
+	if conflicts > 0 {
+		c.JSON(http.StatusConflict, response.NewErrorResponse(http.StatusConflict, "Alias is already used as a tag label or alias"))
+		return
+	}
+
+	// the unique indexes of the aliases reject an alias already used, even by a
+	// concurrent request
+	alias := models.TagAlias{Alias: h.Normalizer.Label(aliasRequest.Alias), NormalizedAlias: key, TagID: tag.ID}
+	err := db.Create(&alias).Error
+	if utils.IsUniqueViolation(db, err) {
+		c.JSON(http.StatusConflict, response.NewErrorResponse(http.StatusConflict, "Alias is already used as a tag label or alias"))
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, response.NewErrorResponse(http.StatusInternalServerError, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, response.NewSuccessResponse(alias))
+}
+
+// DeleteTagAlias godoc
+// @Summary Delete an alias of a tag
+// @Description Delete an alias of a tag
+// @Tags tags
+// @Produce json
+// @Param tagId path int true "Tag ID"
+// @Param aliasId path int true "Alias ID"
+// @Success 200 {object} DeleteTagResponse
+// @Failure 404 {object} response.Response{} "Alias not found"
+// @Router /tags/{tagId}/aliases/{aliasId} [delete]
+func (h *TagController) DeleteTagAlias(c *gin.Context) {
+	db := h.DB.WithContext(c.Request.Context())
+
+	result := db.Where("tag_id = ?", c.Param("tagId")).Delete(&models.TagAlias{}, c.Param("aliasId"))
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, response.NewErrorResponse(http.StatusInternalServerError, result.Error.Error()))
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, response.NewErrorResponse(http.StatusNotFound, "Record not found!"))
+		return
+	}
+
+	c.JSON(http.StatusOK, DeleteTagResponse{Status: "success"})
+}
@@ -0,0 +1,61 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/fatah-illah/asset-finder/config"
+	"github.com/fatah-illah/asset-finder/models"
+)
+
+func TestMergeTagsKeepsManualSource(t *testing.T) {
+	db := newTestDB(t)
+
+	target := models.Tag{Label: "Golang", NormalizedLabel: "golang", Slug: "golang"}
+	source := models.Tag{Label: "Go", NormalizedLabel: "go", Slug: "go"}
+	post := models.Post{Title: "Generics", Content: "type parameters"}
+	for _, value := range []interface{}{&target, &source, &post} {
+		if err := db.Create(value).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the auto-tagger put the target, a user put the source
+	associations := []models.PostTag{
+		{PostID: post.ID, TagID: target.ID, Source: models.TagSourceAuto},
+		{PostID: post.ID, TagID: source.ID, Source: models.TagSourceManual},
+	}
+	if err := db.Create(&associations).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	tags := NewTagController(db, testNormalizer, config.TagsConfig{})
+	router := newTestRouter()
+	router.POST("/tags/:tagId/merge", tags.MergeTags)
+	router.POST("/tags/:tagId/aliases", tags.CreateTagAlias)
+
+	body := fmt.Sprintf(`{"source_ids":[%d]}`, source.ID)
+	if recorder := serve(router, "editor", http.MethodPost, fmt.Sprintf("/tags/%d/merge", target.ID), body); recorder.Code != http.StatusOK {
+		t.Fatalf("merge: status = %d, body %s", recorder.Code, recorder.Body)
+	}
+
+	var kept []models.PostTag
+	if err := db.Where("post_id = ?", post.ID).Find(&kept).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(kept) != 1 || kept[0].TagID != target.ID || kept[0].Source != models.TagSourceManual {
+		t.Errorf("associations after the merge = %+v, want the target as manual", kept)
+	}
+
+	// the merge created the alias "go"
+	aliases := fmt.Sprintf("/tags/%d/aliases", target.ID)
+	if recorder := serve(router, "editor", http.MethodPost, aliases, `{"alias":" GO "}`); recorder.Code != http.StatusConflict {
+		t.Errorf("duplicate alias: status = %d, want %d", recorder.Code, http.StatusConflict)
+	}
+	if recorder := serve(router, "editor", http.MethodPost, aliases, `{"alias":"golang"}`); recorder.Code != http.StatusConflict {
+		t.Errorf("alias of a tag label: status = %d, want %d", recorder.Code, http.StatusConflict)
+	}
+	if recorder := serve(router, "editor", http.MethodPost, aliases, `{"alias":"go-lang"}`); recorder.Code != http.StatusOK {
+		t.Errorf("new alias: status = %d, body %s", recorder.Code, recorder.Body)
+	}
+}
@@ -2,30 +2,45 @@ package controllers
 
 import (
 	"net/http"
+	"strconv"
 
+	"github.com/fatah-illah/asset-finder/config"
+	"github.com/fatah-illah/asset-finder/data/request"
 	"github.com/fatah-illah/asset-finder/data/response"
 	"github.com/fatah-illah/asset-finder/models"
+	"github.com/fatah-illah/asset-finder/utils"
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 )
 
 type TagController struct {
-	DB *gorm.DB
+	DB           *gorm.DB
+	Normalizer   utils.TagNormalizer
+	Cooccurrence config.CooccurrenceConfig
+	Namespaces   map[string]config.TagNamespaceConfig
+	trigram      bool
 }
 
-func NewTagController(db *gorm.DB) *TagController {
-	return &TagController{DB: db}
+func NewTagController(db *gorm.DB, normalizer utils.TagNormalizer, tags config.TagsConfig) *TagController {
+	return &TagController{
+		DB:           db,
+		Normalizer:   normalizer,
+		Cooccurrence: tags.Cooccurrence,
+		Namespaces:   tags.Namespaces,
+		trigram:      supportsTrigram(db),
+	}
 }
 
 // GetTags 			godoc
 // @Summary			Get All tags.
-// @Description		Return list of tags.
+// @Description		Return list of tags with their published posts, or all their posts with an API key.
 // @Tags			tag
 // @Success			200 {object} response.Response{}
 // @Router			/tags [get]
 func (h *TagController) GetTags(c *gin.Context) {
+	db := h.DB.WithContext(c.Request.Context())
 	var tags []models.Tag
-	if err := h.DB.Preload("Posts").Find(&tags).Error; err != nil {
+	if err := db.Preload("Posts", visiblePosts(c)).Find(&tags).Error; err != nil {
 		webResponse := response.NewErrorResponse(http.StatusInternalServerError, err.Error())
 		c.JSON(http.StatusInternalServerError, webResponse)
 		return
@@ -39,90 +54,186 @@ func (h *TagController) GetTags(c *gin.Context) {
 // GetTag 				godoc
 // @Summary				Get Single tag by id.
 // @Param				tagId path string true "update tag by id"
-// @Description			Return the tag who's tagId value matches id.
+// @Description			Return the tag who's tagId value matches id, with its published posts or all its posts with an API key.
 // @Produce				application/json
 // @Tags				tag
 // @Success				200 {object} response.Response{}
 // @Router				/tags/{tagId} [get]
 func (h *TagController) GetTag(c *gin.Context) {
+	db := h.DB.WithContext(c.Request.Context())
 	tagId := c.Param("tagId")
 	var tag models.Tag
-	if err := h.DB.Preload("Posts").First(&tag, tagId).Error; err != nil {
+	if err := db.Preload("Posts", visiblePosts(c)).First(&tag, tagId).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Record not found!"})
 		return
 	}
 	c.JSON(http.StatusOK, tag)
 }
 
+// GetTagBySlug godoc
+// @Summary Get a tag by slug
+// @Description Return the tag whose URL-safe slug matches, with its published posts or all its posts with an API key
+// @Tags tags
+// @Produce json
+// @Param slug path string true "Tag slug"
+// @Success 200 {object} response.Response{data=models.Tag}
+// @Failure 404 {object} response.Response{} "Tag not found"
+// @Router /tags/by-slug/{slug} [get]
+func (h *TagController) GetTagBySlug(c *gin.Context) {
+	db := h.DB.WithContext(c.Request.Context())
+
+	var tag models.Tag
+	if err := db.Preload("Posts", visiblePosts(c)).Where("slug = ?", c.Param("slug")).First(&tag).Error; err != nil {
+		c.JSON(http.StatusNotFound, response.NewErrorResponse(http.StatusNotFound, "Record not found!"))
+		return
+	}
+
+	c.JSON(http.StatusOK, response.NewSuccessResponse(tag))
+}
+
 // CreateTag		godoc
 // @Summary			Create tag
-// @Description		Save tag data in Db.
+// @Description		Save tag data in Db, the posts are given by title and must exist.
+// @Accept			json
 // @Produce			application/json
 // @Tags			tags
-// @Success			200 {object} response.Response{}
+// @Param			input body request.TagRequest true "Tag"
+// @Success			200 {object} response.Response{data=response.TagResponse}
+// @Failure			400 {object} response.Response{} "Invalid tag or unknown post"
+// @Failure			409 {object} response.Response{} "Label already used"
+// @Failure			422 {object} response.Response{} "Invalid parent or replacement tag"
 // @Router			/tags [post]
 func (h *TagController) CreateTag(c *gin.Context) {
+	db := h.DB.WithContext(c.Request.Context())
+
+	var tagRequest request.TagRequest
+	if !bindRequest(c, &tagRequest) {
+		return
+	}
+
 	var tag models.Tag
-	if err := c.BindJSON(&tag); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	applyTagRequest(&tag, tagRequest)
+
+	if err := h.validateTag(db, &tag); err != nil {
+		c.JSON(err.Status, response.NewErrorResponse(err.Status, err.Message))
 		return
 	}
 
-	for i, post := range tag.Posts {
-		var existingPost models.Post
-		if err := h.DB.Where("title = ?", post.Title).First(&existingPost).Error; err != nil {
-			h.DB.Create(&tag.Posts[i])
-		} else {
-			tag.Posts[i] = existingPost
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// the replacement is checked again under the hierarchy lock, it may be
+		// deprecated concurrently
+		if tag.Deprecated {
+			if err := lockTagHierarchy(tx); err != nil {
+				return err
+			}
+			if err := validateTagReplacement(tx, &tag); err != nil {
+				return err
+			}
 		}
-	}
 
-	if err := h.DB.Create(&tag).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		posts, err := resolvePostsByTitle(c, tx, tagRequest.Posts)
+		if err != nil {
+			return err
+		}
+		tag.Posts = posts
+
+		err = saveTag(tx, &tag, func(tx *gorm.DB) error { return tx.Create(&tag).Error })
+		if err != nil {
+			return err
+		}
+		// the existing posts given by title may not be visible to the caller
+		return tx.Preload("Posts", visiblePosts(c)).First(&tag, tag.ID).Error
+	})
+	if !respondError(c, err) {
 		return
 	}
-	c.JSON(http.StatusOK, tag)
+
+	c.JSON(http.StatusOK, response.NewSuccessResponse(toTagResponse(tag)))
 }
 
 // UpdateTag godoc
 // @Summary Update a tag by ID
-// @Description Update a tag by its ID with associated posts
+// @Description Replace the label and metadata of a tag and add the given posts to it. The parent is only changed when parent_id is given, use the move endpoint to make it a root tag.
 // @Tags tags
 // @Accept json
 // @Produce json
 // @Param tagId path int true "Tag ID"
-// @Param input body models.Tag true "Tag object to update"
-// @Success 200 {object} models.Tag
-// @Failure 400 {string} string "Bad request"
-// @Failure 404 {string} string "Tag not found"
+// @Param input body request.TagRequest true "Tag"
+// @Success 200 {object} response.Response{data=response.TagResponse}
+// @Failure 400 {object} response.Response{} "Invalid tag or unknown post"
+// @Failure 404 {object} response.Response{} "Tag not found"
+// @Failure 409 {object} response.Response{} "Label already used"
+// @Failure 422 {object} response.Response{} "Invalid parent or replacement tag"
 // @Router /tags/{tagId} [put]
 func (h *TagController) UpdateTag(c *gin.Context) {
-	tagId := c.Param("tagId")
+	db := h.DB.WithContext(c.Request.Context())
+
 	var tag models.Tag
-	if err := h.DB.First(&tag, tagId).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Record not found!"})
+	if err := db.First(&tag, c.Param("tagId")).Error; err != nil {
+		c.JSON(http.StatusNotFound, response.NewErrorResponse(http.StatusNotFound, "Record not found!"))
 		return
 	}
 
-	if err := c.BindJSON(&tag); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	var tagRequest request.TagRequest
+	if !bindRequest(c, &tagRequest) {
 		return
 	}
+	applyTagRequest(&tag, tagRequest)
 
-	for i, post := range tag.Posts {
-		var existingPost models.Post
-		if err := h.DB.Where("title = ?", post.Title).First(&existingPost).Error; err != nil {
-			h.DB.Create(&tag.Posts[i])
-		} else {
-			tag.Posts[i] = existingPost
-		}
+	if err := h.validateTag(db, &tag); err != nil {
+		c.JSON(err.Status, response.NewErrorResponse(err.Status, err.Message))
+		return
 	}
 
-	if err := h.DB.Session(&gorm.Session{FullSaveAssociations: true}).Updates(&tag).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// the parent and the replacement are checked again under the hierarchy
+		// lock, see MoveTag
+		if tag.ParentID != nil || tag.Deprecated {
+			if err := lockTagHierarchy(tx); err != nil {
+				return err
+			}
+			if err := validateTagParent(tx, tag.ID, tag.ParentID); err != nil {
+				return err
+			}
+			if err := validateTagReplacement(tx, &tag); err != nil {
+				return err
+			}
+		}
+
+		err := saveTag(tx, &tag, func(tx *gorm.DB) error { return tx.Model(&tag).Select(tagColumns).Updates(&tag).Error })
+		if err != nil {
+			return err
+		}
+
+		posts, err := resolvePostsByTitle(c, tx, tagRequest.Posts)
+		if err != nil {
+			return err
+		}
+		if len(posts) > 0 {
+			if err := tx.Model(&tag).Association("Posts").Append(posts); err != nil {
+				return err
+			}
+		}
+
+		return tx.Preload("Posts", visiblePosts(c)).First(&tag, tag.ID).Error
+	})
+	if !respondError(c, err) {
 		return
 	}
-	c.JSON(http.StatusOK, tag)
+
+	c.JSON(http.StatusOK, response.NewSuccessResponse(toTagResponse(tag)))
+}
+
+// validateTag normalizes the label of a new or updated tag and checks its parent
+// and replacement
+func (h *TagController) validateTag(db *gorm.DB, tag *models.Tag) *utils.ResponseError {
+	if err := normalizeTag(db, h.Normalizer, tag); err != nil {
+		return err
+	}
+	if err := validateTagParent(db, tag.ID, tag.ParentID); err != nil {
+		return err
+	}
+	return validateTagReplacement(db, tag)
 }
 
 // DeleteTagResponse represents the response format for DeleteTag
@@ -143,23 +254,183 @@ type DeleteTagResponse struct {
 // @Failure 404 {string} string "Tag not found"
 // @Router /tags/{tagId} [delete]
 func (h *TagController) DeleteTag(c *gin.Context) {
+	db := h.DB.WithContext(c.Request.Context())
 	tagId := c.Param("tagId")
 
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := lockTagHierarchy(tx); err != nil {
+			return err
+		}
+
+		// the parent is read under the lock, a concurrent move may have changed it
+		var tag models.Tag
+		if err := utils.ForUpdate(tx).First(&tag, tagId).Error; err != nil {
+			return &utils.ResponseError{Message: "Record not found!", Status: http.StatusNotFound}
+		}
+
+		if err := tx.Model(&tag).Association("Posts").Clear(); err != nil {
+			return err
+		}
+
+		// the children move up to the parent of the deleted tag
+		if err := tx.Model(&models.Tag{}).Where("parent_id = ?", tag.ID).Update("parent_id", tag.ParentID).Error; err != nil {
+			return err
+		}
+
+		return tx.Delete(&tag).Error
+	})
+
+	if !respondError(c, err) {
+		return
+	}
+
+	c.JSON(http.StatusOK, DeleteTagResponse{Status: "success"})
+}
+
+// MoveTag godoc
+// @Summary Move a tag and its subtree
+// @Description Set the parent of a tag, or make it a root tag with a null parent_id
+// @Tags tags
+// @Accept json
+// @Produce json
+// @Param tagId path int true "Tag ID"
+// @Param input body request.TagMoveRequest true "New parent"
+// @Success 200 {object} response.Response{}
+// @Failure 404 {object} response.Response{} "Tag not found"
+// @Failure 409 {object} response.Response{} "Move would create a cycle"
+// @Router /tags/{tagId}/move [put]
+func (h *TagController) MoveTag(c *gin.Context) {
+	db := h.DB.WithContext(c.Request.Context())
+
 	var tag models.Tag
-	if err := h.DB.Preload("Posts").First(&tag, tagId).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Record not found!"})
+	if err := db.First(&tag, c.Param("tagId")).Error; err != nil {
+		c.JSON(http.StatusNotFound, response.NewErrorResponse(http.StatusNotFound, "Record not found!"))
+		return
+	}
+
+	var moveRequest request.TagMoveRequest
+	if err := c.ShouldBindJSON(&moveRequest); err != nil {
+		c.JSON(http.StatusBadRequest, response.NewErrorResponse(http.StatusBadRequest, err.Error()))
+		return
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := lockTagHierarchy(tx); err != nil {
+			return err
+		}
+		if err := validateTagParent(tx, tag.ID, moveRequest.ParentID); err != nil {
+			return err
+		}
+		return tx.Model(&tag).Update("parent_id", moveRequest.ParentID).Error
+	})
+	if !respondError(c, err) {
+		return
+	}
+
+	c.JSON(http.StatusOK, response.NewSuccessResponse(tag))
+}
+
+// GetTagTree godoc
+// @Summary Get the tag tree
+// @Description Return the tags nested under their parents, optionally only the subtree of a root tag
+// @Tags tags
+// @Produce json
+// @Param root query int false "Root tag ID"
+// @Success 200 {object} response.Response{data=[]response.TagTreeResponse}
+// @Failure 404 {object} response.Response{} "Tag not found"
+// @Router /tags/tree [get]
+func (h *TagController) GetTagTree(c *gin.Context) {
+	db := h.DB.WithContext(c.Request.Context())
+	query := db.Model(&models.Tag{}).Select("id", "label", "parent_id").Order("label")
+
+	var rootID uint
+	if root := c.Query("root"); root != "" {
+		id, err := strconv.ParseUint(root, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, response.NewErrorResponse(http.StatusBadRequest, "Invalid root"))
+			return
+		}
+		rootID = uint(id)
+		query = query.Where("id IN (?)", tagIDsQuery(db, rootID, true))
+	}
+
+	var tags []models.Tag
+	if err := query.Find(&tags).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, response.NewErrorResponse(http.StatusInternalServerError, err.Error()))
+		return
+	}
+
+	if rootID != 0 && len(tags) == 0 {
+		c.JSON(http.StatusNotFound, response.NewErrorResponse(http.StatusNotFound, "Record not found!"))
 		return
 	}
 
-	err := h.DB.Model(&tag).Association("Posts").Clear()
+	nodes := make(map[uint]*response.TagTreeResponse, len(tags))
+	for _, tag := range tags {
+		nodes[tag.ID] = &response.TagTreeResponse{
+			ID:       tag.ID,
+			Label:    tag.Label,
+			ParentID: tag.ParentID,
+			Children: []*response.TagTreeResponse{},
+		}
+	}
+
+	roots := []*response.TagTreeResponse{}
+	for _, tag := range tags {
+		node := nodes[tag.ID]
+		if tag.ParentID != nil && tag.ID != rootID {
+			if parent, ok := nodes[*tag.ParentID]; ok {
+				parent.Children = append(parent.Children, node)
+				continue
+			}
+		}
+		roots = append(roots, node)
+	}
+
+	c.JSON(http.StatusOK, response.NewSuccessResponse(roots))
+}
+
+// GetTagPosts godoc
+// @Summary Get the posts of a tag
+// @Description Return the published posts, or the posts of other statuses with an API key, tagged with the tag, or with any tag below it when include_descendants is true, optionally matching metadata filters such as meta.vendor=lenovo or meta.price[lt]=1000
+// @Tags tags
+// @Produce json
+// @Param tagId path int true "Tag ID"
+// @Param include_descendants query bool false "Include the posts of descendant tags"
+// @Param status query []string false "Statuses (draft, in_review, published, archived or all), published by default" collectionFormat(multi)
+// @Success 200 {object} response.Response{data=[]models.Post}
+// @Failure 400 {object} response.Response{} "Invalid TagID, metadata filter or status"
+// @Failure 401 {object} response.Response{} "Unpublished posts listed without API key"
+// @Router /tags/{tagId}/posts [get]
+func (h *TagController) GetTagPosts(c *gin.Context) {
+	db := h.DB.WithContext(c.Request.Context())
+
+	tagID, err := strconv.ParseUint(c.Param("tagId"), 10, 64)
 	if err != nil {
+		c.JSON(http.StatusBadRequest, response.NewErrorResponse(http.StatusBadRequest, "Invalid TagID"))
 		return
 	}
 
-	if err := h.DB.Delete(&tag).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	includeDescendants, _ := strconv.ParseBool(c.Query("include_descendants"))
+
+	postIDs := db.Model(&models.PostTag{}).
+		Select("post_id").
+		Where("tag_id IN (?)", tagIDsQuery(db, uint(tagID), includeDescendants))
+
+	query, filterErr := filterPostsByMetadata(db.Preload("Tags").Where("id IN (?)", postIDs), c.Request.URL.Query())
+	if filterErr == nil {
+		query, filterErr = filterPostsByStatus(c, query)
+	}
+	if filterErr != nil {
+		c.JSON(filterErr.Status, response.NewErrorResponse(filterErr.Status, filterErr.Message))
 		return
 	}
 
-	c.JSON(http.StatusOK, DeleteTagResponse{Status: "success"})
+	var posts []models.Post
+	if err := query.Find(&posts).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, response.NewErrorResponse(http.StatusInternalServerError, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, response.NewSuccessResponse(posts))
 }
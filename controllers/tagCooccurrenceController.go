@@ -0,0 +1,118 @@
+package controllers
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/fatah-illah/asset-finder/analytics"
+	"github.com/fatah-illah/asset-finder/data/response"
+	"github.com/fatah-illah/asset-finder/models"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultRelatedLimit = 10
+	maxRelatedLimit     = 100
+)
+
+// GetRelatedTags godoc
+// @Summary Get the tags related to a tag
+// @Description Return the tags most often used together with the tag, from the co-occurrence snapshot. Lift is P(a,b) / (P(a) P(b)) and PMI its base 2 logarithm, so both rank alike.
+// @Tags tags
+// @Produce json
+// @Param tagId path int true "Tag ID"
+// @Param sort query string false "lift (default), pmi or support"
+// @Param min_support query int false "Minimum number of shared posts, at least the configured minimum"
+// @Param limit query int false "Maximum number of related tags (default 10, at most 100)"
+// @Success 200 {object} response.Response{data=response.RelatedTagsResponse}
+// @Failure 400 {object} response.Response{} "Invalid parameter"
+// @Failure 404 {object} response.Response{} "Tag not found"
+// @Router /tags/{tagId}/related [get]
+func (h *TagController) GetRelatedTags(c *gin.Context) {
+	db := h.DB.WithContext(c.Request.Context())
+
+	var tag models.Tag
+	if err := db.Select("id").First(&tag, c.Param("tagId")).Error; err != nil {
+		c.JSON(http.StatusNotFound, response.NewErrorResponse(http.StatusNotFound, "Record not found!"))
+		return
+	}
+
+	var order string
+	switch c.DefaultQuery("sort", "lift") {
+	case "lift", "pmi":
+		order = "tag_cooccurrences.lift DESC, tag_cooccurrences.support DESC"
+	case "support":
+		order = "tag_cooccurrences.support DESC, tag_cooccurrences.lift DESC"
+	default:
+		c.JSON(http.StatusBadRequest, response.NewErrorResponse(http.StatusBadRequest, "sort must be lift, pmi or support"))
+		return
+	}
+
+	minSupport := h.Cooccurrence.MinSupport
+	if value := c.Query("min_support"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 {
+			c.JSON(http.StatusBadRequest, response.NewErrorResponse(http.StatusBadRequest, "Invalid min_support"))
+			return
+		}
+		minSupport = max(parsed, minSupport)
+	}
+
+	limit := defaultRelatedLimit
+	if value := c.Query("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			c.JSON(http.StatusBadRequest, response.NewErrorResponse(http.StatusBadRequest, "Invalid limit"))
+			return
+		}
+		limit = min(parsed, maxRelatedLimit)
+	}
+
+	result := response.RelatedTagsResponse{TagID: tag.ID, Related: []response.RelatedTagResponse{}}
+
+	err := db.Model(&models.TagCooccurrence{}).
+		Select("tags.id, tags.label, tag_cooccurrences.support, tag_cooccurrences.lift").
+		Joins("JOIN tags ON tags.id = tag_cooccurrences.related_tag_id").
+		Where("tag_cooccurrences.tag_id = ? AND tag_cooccurrences.support >= ?", tag.ID, minSupport).
+		Order(order + ", tags.label").
+		Limit(limit).
+		Scan(&result.Related).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, response.NewErrorResponse(http.StatusInternalServerError, err.Error()))
+		return
+	}
+
+	for i := range result.Related {
+		result.Related[i].PMI = math.Log2(result.Related[i].Lift)
+	}
+
+	var snapshot models.TagCooccurrence
+	if db.Select("refreshed_at").Limit(1).Find(&snapshot).RowsAffected > 0 {
+		result.RefreshedAt = &snapshot.RefreshedAt
+	}
+
+	c.JSON(http.StatusOK, response.NewSuccessResponse(result))
+}
+
+// RefreshTagCooccurrences godoc
+// @Summary Refresh the tag co-occurrence snapshot
+// @Description Recount the tags used together now instead of waiting for the periodic refresh
+// @Tags tags
+// @Produce json
+// @Success 200 {object} response.Response{data=response.CooccurrenceRefreshResponse}
+// @Failure 409 {object} response.Response{} "A refresh is already running"
+// @Router /tags/cooccurrences/refresh [post]
+func (h *TagController) RefreshTagCooccurrences(c *gin.Context) {
+	pairs, err := analytics.RefreshCooccurrences(c.Request.Context(), h.DB, h.Cooccurrence.MinSupport)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, response.NewErrorResponse(http.StatusInternalServerError, err.Error()))
+		return
+	}
+	if pairs < 0 {
+		c.JSON(http.StatusConflict, response.NewErrorResponse(http.StatusConflict, "A refresh is already running"))
+		return
+	}
+
+	c.JSON(http.StatusOK, response.NewSuccessResponse(response.CooccurrenceRefreshResponse{Pairs: pairs}))
+}
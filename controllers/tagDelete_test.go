@@ -0,0 +1,56 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/fatah-illah/asset-finder/config"
+	"github.com/fatah-illah/asset-finder/models"
+)
+
+func TestDeleteTagReparentsChildren(t *testing.T) {
+	db := newTestDB(t)
+
+	root := models.Tag{Label: "Hardware", NormalizedLabel: "hardware", Slug: "hardware"}
+	if err := db.Create(&root).Error; err != nil {
+		t.Fatal(err)
+	}
+	middle := models.Tag{Label: "Laptops", NormalizedLabel: "laptops", Slug: "laptops", ParentID: &root.ID}
+	if err := db.Create(&middle).Error; err != nil {
+		t.Fatal(err)
+	}
+	leaf := models.Tag{Label: "Ultrabooks", NormalizedLabel: "ultrabooks", Slug: "ultrabooks", ParentID: &middle.ID}
+	post := models.Post{Title: "X1 Carbon", Content: "14 inch", Tags: []models.Tag{middle}}
+	for _, value := range []interface{}{&leaf, &post} {
+		if err := db.Create(value).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tags := NewTagController(db, testNormalizer, config.TagsConfig{})
+	router := newTestRouter()
+	router.DELETE("/tags/:tagId", tags.DeleteTag)
+
+	target := fmt.Sprintf("/tags/%d", middle.ID)
+	if recorder := serve(router, "editor", http.MethodDelete, target, ""); recorder.Code != http.StatusOK {
+		t.Fatalf("DELETE: status = %d, body %s", recorder.Code, recorder.Body)
+	}
+	if recorder := serve(router, "editor", http.MethodDelete, target, ""); recorder.Code != http.StatusNotFound {
+		t.Errorf("second DELETE: status = %d, want %d", recorder.Code, http.StatusNotFound)
+	}
+
+	if err := db.First(&leaf, leaf.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if leaf.ParentID == nil || *leaf.ParentID != root.ID {
+		t.Errorf("parent of the child = %v, want %d", leaf.ParentID, root.ID)
+	}
+	var associations int64
+	if err := db.Model(&models.PostTag{}).Where("tag_id = ?", middle.ID).Count(&associations).Error; err != nil {
+		t.Fatal(err)
+	}
+	if associations != 0 {
+		t.Errorf("associations of the deleted tag = %d, want 0", associations)
+	}
+}
@@ -0,0 +1,96 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/fatah-illah/asset-finder/models"
+	"github.com/fatah-illah/asset-finder/utils"
+	"gorm.io/gorm"
+)
+
+// tagHierarchyLockKey serializes the changes of the tag parents, two concurrent
+// moves checked against the same tree could otherwise form a cycle together
+const tagHierarchyLockKey = 7_236_419_504
+
+// descendantTagIDsSQL selects a tag and all the tags below it. UNION rather than
+// UNION ALL stops the recursion should a cycle ever reach the table.
+const descendantTagIDsSQL = `WITH RECURSIVE descendants AS (
+	SELECT id FROM tags WHERE id = ?
+	UNION
+	SELECT tags.id FROM tags JOIN descendants ON tags.parent_id = descendants.id
+) SELECT id FROM descendants`
+
+// ancestorTagsSQL selects the ancestors of a tag, nearest first
+const ancestorTagsSQL = `WITH RECURSIVE ancestors AS (
+	SELECT id, parent_id, 0 AS depth FROM tags WHERE id = ?
+	UNION
+	SELECT tags.id, tags.parent_id, ancestors.depth + 1 FROM tags JOIN ancestors ON tags.id = ancestors.parent_id
+	WHERE ancestors.depth < 1000
+) SELECT id, parent_id FROM ancestors WHERE depth > 0 ORDER BY depth`
+
+// lockTagHierarchy holds the tag hierarchy lock until the end of the transaction
+func lockTagHierarchy(tx *gorm.DB) error {
+	if tx.Dialector.Name() != "postgres" {
+		return nil
+	}
+	return tx.Exec("SELECT pg_advisory_xact_lock(?)", tagHierarchyLockKey).Error
+}
+
+// tagIDsQuery returns a subquery selecting the tag, and its descendants when asked
+func tagIDsQuery(db *gorm.DB, tagID uint, includeDescendants bool) *gorm.DB {
+	if includeDescendants {
+		return db.Raw(descendantTagIDsSQL, tagID)
+	}
+	return db.Model(&models.Tag{}).Select("id").Where("id = ?", tagID)
+}
+
+// descendantTagIDs returns the ids of the tag and all the tags below it
+func descendantTagIDs(db *gorm.DB, tagID uint) ([]uint, error) {
+	var ids []uint
+	err := db.Raw(descendantTagIDsSQL, tagID).Scan(&ids).Error
+	return ids, err
+}
+
+// ancestorTags returns the ids and parent ids of the ancestors of a tag, nearest first
+func ancestorTags(db *gorm.DB, tagID uint) ([]models.Tag, error) {
+	var ancestors []models.Tag
+	err := db.Raw(ancestorTagsSQL, tagID).Scan(&ancestors).Error
+	return ancestors, err
+}
+
+// validateTagParent checks that parentID exists and is neither the tag itself nor
+// one of its descendants, which would create a cycle. tagID is 0 for a new tag.
+func validateTagParent(db *gorm.DB, tagID uint, parentID *uint) *utils.ResponseError {
+	if parentID == nil {
+		return nil
+	}
+
+	var parent models.Tag
+	if err := db.Select("id").First(&parent, *parentID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return &utils.ResponseError{Message: "Parent tag not found", Status: http.StatusUnprocessableEntity}
+		}
+		return &utils.ResponseError{Message: err.Error(), Status: http.StatusInternalServerError}
+	}
+
+	if tagID == 0 {
+		return nil
+	}
+
+	descendants, err := descendantTagIDs(db, tagID)
+	if err != nil {
+		return &utils.ResponseError{Message: err.Error(), Status: http.StatusInternalServerError}
+	}
+
+	for _, id := range descendants {
+		if id == *parentID {
+			return &utils.ResponseError{
+				Message: "A tag cannot be moved below itself or one of its descendants",
+				Status:  http.StatusConflict,
+			}
+		}
+	}
+
+	return nil
+}
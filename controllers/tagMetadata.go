@@ -0,0 +1,131 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/fatah-illah/asset-finder/data/request"
+	"github.com/fatah-illah/asset-finder/data/response"
+	"github.com/fatah-illah/asset-finder/models"
+	"github.com/fatah-illah/asset-finder/utils"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// tagColumns are the columns set from a request.TagRequest
+var tagColumns = []string{
+	"label", "normalized_label", "slug", "namespace", "value", "parent_id",
+	"description", "color", "icon", "deprecated", "replacement_tag_id",
+}
+
+// applyTagRequest copies the fields of a request to tag, the parent is only
+// changed when given, MoveTag detaches a tag from its parent
+func applyTagRequest(tag *models.Tag, tagRequest request.TagRequest) {
+	tag.Label = tagRequest.Label
+	if tagRequest.ParentID != nil {
+		tag.ParentID = tagRequest.ParentID
+	}
+	tag.Description = tagRequest.Description
+	tag.Color = strings.ToLower(tagRequest.Color)
+	tag.Icon = tagRequest.Icon
+	tag.Deprecated = tagRequest.Deprecated
+	tag.ReplacementTagID = tagRequest.ReplacementTagID
+}
+
+// validateTagReplacement checks that the replacement of a deprecated tag exists,
+// is another tag and is not deprecated itself, and that a deprecated tag is not
+// the replacement of other tags, so that replacements never chain
+func validateTagReplacement(db *gorm.DB, tag *models.Tag) *utils.ResponseError {
+	if tag.Deprecated && tag.ID != 0 {
+		var replaced int64
+		if err := db.Model(&models.Tag{}).Where("replacement_tag_id = ?", tag.ID).Count(&replaced).Error; err != nil {
+			return &utils.ResponseError{Message: err.Error(), Status: http.StatusInternalServerError}
+		}
+		if replaced > 0 {
+			return &utils.ResponseError{Message: "The tag is the replacement of deprecated tags, change their replacement first", Status: http.StatusUnprocessableEntity}
+		}
+	}
+
+	replacementID := tag.ReplacementTagID
+	if replacementID == nil {
+		return nil
+	}
+	if *replacementID == tag.ID {
+		return &utils.ResponseError{Message: "A tag cannot be its own replacement", Status: http.StatusUnprocessableEntity}
+	}
+
+	var replacement models.Tag
+	if err := db.Select("id", "deprecated").First(&replacement, *replacementID).Error; err != nil {
+		return &utils.ResponseError{Message: "Replacement tag not found", Status: http.StatusUnprocessableEntity}
+	}
+	if replacement.Deprecated {
+		return &utils.ResponseError{Message: "The replacement tag is deprecated", Status: http.StatusUnprocessableEntity}
+	}
+
+	return nil
+}
+
+// resolvePostsByTitle returns the posts visible to the caller with the given
+// titles, a missing one is a bad request
+func resolvePostsByTitle(c *gin.Context, db *gorm.DB, titles []string) ([]models.Post, error) {
+	posts := make([]models.Post, 0, len(titles))
+
+	for _, title := range titles {
+		var post models.Post
+		err := db.Scopes(visiblePosts(c)).Where("title = ?", title).First(&post).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, &utils.ResponseError{Message: fmt.Sprintf("Post %q not found", title), Status: http.StatusBadRequest}
+		}
+		if err != nil {
+			return nil, err
+		}
+		posts = append(posts, post)
+	}
+
+	return posts, nil
+}
+
+// checkDeprecatedTags rejects new uses of deprecated tags, pointing to their replacement
+func checkDeprecatedTags(db *gorm.DB, tags []models.Tag) error {
+	for _, tag := range tags {
+		if !tag.Deprecated {
+			continue
+		}
+
+		message := fmt.Sprintf("Tag %q is deprecated", tag.Label)
+		if tag.ReplacementTagID != nil {
+			var replacement models.Tag
+			if err := db.Select("id", "label").First(&replacement, *tag.ReplacementTagID).Error; err == nil {
+				message += fmt.Sprintf(", use %q (id %d) instead", replacement.Label, replacement.ID)
+			}
+		}
+
+		return &utils.ResponseError{Message: message, Status: http.StatusUnprocessableEntity}
+	}
+
+	return nil
+}
+
+func toTagResponse(tag models.Tag) response.TagResponse {
+	posts := make([]response.PostResponse, 0, len(tag.Posts))
+	for _, post := range tag.Posts {
+		posts = append(posts, response.PostResponse{ID: post.ID, Title: post.Title, Content: post.Content, Metadata: post.Metadata})
+	}
+
+	return response.TagResponse{
+		ID:               tag.ID,
+		Label:            tag.Label,
+		Slug:             tag.Slug,
+		Namespace:        tag.Namespace,
+		Value:            tag.Value,
+		ParentID:         tag.ParentID,
+		Description:      tag.Description,
+		Color:            tag.Color,
+		Icon:             tag.Icon,
+		Deprecated:       tag.Deprecated,
+		ReplacementTagID: tag.ReplacementTagID,
+		Posts:            posts,
+	}
+}
@@ -0,0 +1,79 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/fatah-illah/asset-finder/config"
+	"github.com/fatah-illah/asset-finder/models"
+	"github.com/fatah-illah/asset-finder/workflow"
+)
+
+func TestDeprecatedReplacementsDoNotChain(t *testing.T) {
+	db := newTestDB(t)
+
+	current := models.Tag{Label: "Kubernetes", NormalizedLabel: "kubernetes", Slug: "kubernetes"}
+	if err := db.Create(&current).Error; err != nil {
+		t.Fatal(err)
+	}
+	old := models.Tag{Label: "K8s", NormalizedLabel: "k8s", Slug: "k8s", Deprecated: true, ReplacementTagID: &current.ID}
+	if err := db.Create(&old).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	tags := NewTagController(db, testNormalizer, config.TagsConfig{})
+	router := newTestRouter()
+	router.PUT("/tags/:tagId", tags.UpdateTag)
+
+	target := fmt.Sprintf("/tags/%d", current.ID)
+	if recorder := serve(router, "editor", http.MethodPut, target, `{"label":"Kubernetes","deprecated":true}`); recorder.Code != http.StatusUnprocessableEntity {
+		t.Errorf("deprecating a replacement: status = %d, want %d", recorder.Code, http.StatusUnprocessableEntity)
+	}
+	body := fmt.Sprintf(`{"label":"Kubernetes","deprecated":true,"replacement_tag_id":%d}`, old.ID)
+	if recorder := serve(router, "editor", http.MethodPut, target, body); recorder.Code != http.StatusUnprocessableEntity {
+		t.Errorf("replacing a tag by the tag it replaces: status = %d, want %d", recorder.Code, http.StatusUnprocessableEntity)
+	}
+
+	if err := db.First(&current, current.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if current.Deprecated {
+		t.Error("the replacement was deprecated")
+	}
+}
+
+func TestTagPostsMustExist(t *testing.T) {
+	db := newTestDB(t)
+
+	draft := models.Post{Title: "Roadmap", Content: "next quarter", Status: workflow.StatusDraft}
+	if err := db.Create(&draft).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	tags := NewTagController(db, testNormalizer, config.TagsConfig{})
+	router := newTestRouter()
+	router.POST("/tags", tags.CreateTag)
+
+	if recorder := serve(router, "editor", http.MethodPost, "/tags", `{"label":"Linux","posts":["Missing"]}`); recorder.Code != http.StatusBadRequest {
+		t.Errorf("unknown post: status = %d, want %d", recorder.Code, http.StatusBadRequest)
+	}
+	if recorder := serve(router, "", http.MethodPost, "/tags", `{"label":"Linux","posts":["Roadmap"]}`); recorder.Code != http.StatusBadRequest {
+		t.Errorf("post hidden from the caller: status = %d, want %d", recorder.Code, http.StatusBadRequest)
+	}
+
+	var posts, created int64
+	if err := db.Model(&models.Post{}).Count(&posts).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Model(&models.Tag{}).Count(&created).Error; err != nil {
+		t.Fatal(err)
+	}
+	if posts != 1 || created != 0 {
+		t.Errorf("posts = %d, tags = %d, want 1 and 0", posts, created)
+	}
+
+	if recorder := serve(router, "editor", http.MethodPost, "/tags", `{"label":"Linux","posts":["Roadmap"]}`); recorder.Code != http.StatusOK {
+		t.Errorf("existing post: status = %d, body %s", recorder.Code, recorder.Body)
+	}
+}
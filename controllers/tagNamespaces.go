@@ -0,0 +1,105 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/fatah-illah/asset-finder/config"
+	"github.com/fatah-illah/asset-finder/data/response"
+	"github.com/fatah-illah/asset-finder/models"
+	"github.com/fatah-illah/asset-finder/utils"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// namespaceParamPrefix prefixes the query parameters filtering the posts by
+// namespaced tag, e.g. ?tag.env=prod
+const namespaceParamPrefix = "tag."
+
+// GetTagNamespaces godoc
+// @Summary Get the tag namespaces
+// @Description Return the namespaces of the namespaced tags such as env:prod, with their number of tags and posts and their cardinality rule
+// @Tags tags
+// @Produce json
+// @Success 200 {object} response.Response{data=[]response.TagNamespaceResponse}
+// @Router /tags/namespaces [get]
+func (h *TagController) GetTagNamespaces(c *gin.Context) {
+	db := h.DB.WithContext(c.Request.Context())
+
+	var namespaces []response.TagNamespaceResponse
+	err := db.Table("tags").
+		Select("tags.namespace, COUNT(DISTINCT tags.id) AS tag_count, COUNT(DISTINCT post_tags.post_id) AS post_count").
+		Joins("LEFT JOIN post_tags ON post_tags.tag_id = tags.id").
+		Where("tags.namespace <> ''").
+		Group("tags.namespace").
+		Scan(&namespaces).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, response.NewErrorResponse(http.StatusInternalServerError, err.Error()))
+		return
+	}
+
+	// the namespaces having a rule are listed even before they are used
+	listed := make(map[string]bool, len(namespaces))
+	for i, namespace := range namespaces {
+		listed[namespace.Namespace] = true
+		namespaces[i].MaxPerPost = h.Namespaces[namespace.Namespace].MaxPerPost
+	}
+	for namespace, rule := range h.Namespaces {
+		if !listed[namespace] {
+			namespaces = append(namespaces, response.TagNamespaceResponse{Namespace: namespace, MaxPerPost: rule.MaxPerPost})
+		}
+	}
+
+	sort.Slice(namespaces, func(i, j int) bool {
+		return namespaces[i].Namespace < namespaces[j].Namespace
+	})
+
+	c.JSON(http.StatusOK, response.NewSuccessResponse(namespaces))
+}
+
+// checkNamespaceRules rejects the tags of a post exceeding the number of tags
+// allowed per post in their namespace
+func checkNamespaceRules(tags []models.Tag, rules map[string]config.TagNamespaceConfig) *utils.ResponseError {
+	perNamespace := make(map[string]int)
+
+	for _, tag := range tags {
+		if tag.Namespace == "" {
+			continue
+		}
+		perNamespace[tag.Namespace]++
+
+		rule := rules[tag.Namespace]
+		if rule.MaxPerPost > 0 && perNamespace[tag.Namespace] > rule.MaxPerPost {
+			return &utils.ResponseError{
+				Message: fmt.Sprintf("A post can have at most %d %s%s tag(s)", rule.MaxPerPost, tag.Namespace, utils.NamespaceSeparator),
+				Status:  http.StatusUnprocessableEntity,
+			}
+		}
+	}
+
+	return nil
+}
+
+// filterPostsByNamespaces restricts query to the posts having, for every tag.<namespace>
+// parameter, one of the given values in that namespace
+func filterPostsByNamespaces(query *gorm.DB, normalizer utils.TagNormalizer, params url.Values) *gorm.DB {
+	for param, values := range params {
+		namespace, ok := strings.CutPrefix(param, namespaceParamPrefix)
+		if !ok || namespace == "" {
+			continue
+		}
+
+		keys := make([]string, 0, len(values))
+		for _, value := range values {
+			keys = append(keys, normalizer.Key(namespace+utils.NamespaceSeparator+value))
+		}
+
+		query = query.Where(`EXISTS (SELECT 1 FROM post_tags JOIN tags ON tags.id = post_tags.tag_id
+			WHERE post_tags.post_id = posts.id AND tags.normalized_label IN ?)`, keys)
+	}
+
+	return query
+}
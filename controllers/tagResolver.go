@@ -0,0 +1,170 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/fatah-illah/asset-finder/models"
+	"github.com/fatah-illah/asset-finder/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// resolveTag returns the tag with the given label, the canonical tag when the label
+// is an alias, or a newly created tag. Labels are compared by their normalized key.
+func resolveTag(db *gorm.DB, normalizer utils.TagNormalizer, label string) (models.Tag, error) {
+	var tag models.Tag
+
+	key := normalizer.Key(label)
+	if key == "" {
+		return tag, &utils.ResponseError{Message: "Tag label must not be empty", Status: http.StatusBadRequest}
+	}
+
+	err := db.Where("normalized_label = ?", key).First(&tag).Error
+	if err == nil {
+		return tag, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return tag, err
+	}
+
+	var alias models.TagAlias
+	err = db.Preload("Tag").Where("normalized_alias = ?", key).First(&alias).Error
+	if err == nil {
+		return alias.Tag, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return tag, err
+	}
+
+	tag = models.Tag{Label: label}
+	if err := normalizeTag(db, normalizer, &tag); err != nil {
+		return tag, err
+	}
+
+	// a concurrent request may create the same tag first, the unique index on the
+	// normalized label then skips the insert and the tag is read back
+	created := false
+	err = saveTag(db, &tag, func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.OnConflict{Columns: []clause.Column{{Name: "normalized_label"}}, DoNothing: true}).Create(&tag)
+		created = result.RowsAffected > 0
+		return result.Error
+	})
+	var conflict *utils.ResponseError
+	if errors.As(err, &conflict) && conflict.Status == http.StatusConflict {
+		err = nil
+	}
+	if err != nil || created {
+		return tag, err
+	}
+
+	tag = models.Tag{}
+	err = db.Where("normalized_label = ?", key).First(&tag).Error
+	return tag, err
+}
+
+// resolveTags resolves the labels of tags, dropping the labels resolving to a tag
+// already in the list, e.g. a label and its alias.
+func resolveTags(db *gorm.DB, normalizer utils.TagNormalizer, tags []models.Tag) ([]models.Tag, error) {
+	resolved := make([]models.Tag, 0, len(tags))
+	seen := make(map[uint]bool, len(tags))
+
+	for _, tag := range tags {
+		resolvedTag, err := resolveTag(db, normalizer, tag.Label)
+		if err != nil {
+			return nil, err
+		}
+
+		if seen[resolvedTag.ID] {
+			continue
+		}
+		seen[resolvedTag.ID] = true
+		resolved = append(resolved, resolvedTag)
+	}
+
+	return resolved, nil
+}
+
+// normalizeTag cleans up the label of a new or renamed tag, fills in its normalized
+// label and gives it a slug when it has none or its label changed. It fails when the
+// label is empty or another tag or alias already uses the same normalized label.
+func normalizeTag(db *gorm.DB, normalizer utils.TagNormalizer, tag *models.Tag) *utils.ResponseError {
+	key := normalizer.Key(tag.Label)
+	if key == "" {
+		return &utils.ResponseError{Message: "Tag label must not be empty", Status: http.StatusBadRequest}
+	}
+
+	var conflicts int64
+	if err := db.Model(&models.Tag{}).Where("normalized_label = ? AND id <> ?", key, tag.ID).Count(&conflicts).Error; err != nil {
+		return &utils.ResponseError{Message: err.Error(), Status: http.StatusInternalServerError}
+	}
+	if conflicts == 0 {
+		if err := db.Model(&models.TagAlias{}).Where("normalized_alias = ? AND tag_id <> ?", key, tag.ID).Count(&conflicts).Error; err != nil {
+			return &utils.ResponseError{Message: err.Error(), Status: http.StatusInternalServerError}
+		}
+	}
+	if conflicts > 0 {
+		return &utils.ResponseError{Message: "Tag label is already used by another tag or alias", Status: http.StatusConflict}
+	}
+
+	labelChanged := key != tag.NormalizedLabel
+	tag.Label = normalizer.Label(tag.Label)
+	tag.NormalizedLabel = key
+	tag.Namespace, tag.Value = normalizer.Split(tag.Label)
+
+	if tag.Slug == "" || labelChanged {
+		slug, err := uniqueSlug(db, utils.Slugify(tag.Label), tag.ID)
+		if err != nil {
+			return &utils.ResponseError{Message: err.Error(), Status: http.StatusInternalServerError}
+		}
+		tag.Slug = slug
+	}
+
+	return nil
+}
+
+// maxTagSaveAttempts bounds the retries of a tag write losing the race for its slug
+const maxTagSaveAttempts = 5
+
+// saveTag runs save, which inserts or updates tag, in a savepoint. The slug given
+// by normalizeTag may be taken by a concurrent write in the meantime, the write is
+// then retried with the next free slug. A concurrent write taking the normalized
+// label answers 409.
+func saveTag(db *gorm.DB, tag *models.Tag, save func(tx *gorm.DB) error) error {
+	for attempt := 1; ; attempt++ {
+		err := db.Transaction(save)
+		if err == nil || !utils.IsUniqueViolation(db, err) || attempt == maxTagSaveAttempts {
+			return err
+		}
+
+		var labelUsed int64
+		if err := db.Model(&models.Tag{}).Where("normalized_label = ? AND id <> ?", tag.NormalizedLabel, tag.ID).Count(&labelUsed).Error; err != nil {
+			return err
+		}
+		if labelUsed > 0 {
+			return &utils.ResponseError{Message: "Tag label is already used by another tag or alias", Status: http.StatusConflict}
+		}
+
+		slug, err := uniqueSlug(db, utils.Slugify(tag.Label), tag.ID)
+		if err != nil {
+			return err
+		}
+		tag.Slug = slug
+	}
+}
+
+// uniqueSlug returns slug, or slug suffixed with -2, -3... when another tag has it
+func uniqueSlug(db *gorm.DB, slug string, tagID uint) (string, error) {
+	candidate := slug
+	for n := 2; ; n++ {
+		var used int64
+		if err := db.Model(&models.Tag{}).Where("slug = ? AND id <> ?", candidate, tagID).Count(&used).Error; err != nil {
+			return "", err
+		}
+		if used == 0 {
+			return candidate, nil
+		}
+		candidate = fmt.Sprintf("%s-%d", slug, n)
+	}
+}
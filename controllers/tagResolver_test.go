@@ -0,0 +1,77 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/fatah-illah/asset-finder/models"
+	"github.com/fatah-illah/asset-finder/utils"
+	"gorm.io/gorm"
+)
+
+func TestSaveTagRetriesTakenSlug(t *testing.T) {
+	db := newTestDB(t)
+
+	tag := models.Tag{Label: "Go Lang"}
+	if err := normalizeTag(db, testNormalizer, &tag); err != nil {
+		t.Fatal(err)
+	}
+
+	// a concurrent request takes the slug between the check and the insert
+	if err := db.Create(&models.Tag{Label: "go-lang", NormalizedLabel: "go-lang", Slug: tag.Slug}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := saveTag(db, &tag, func(tx *gorm.DB) error { return tx.Create(&tag).Error }); err != nil {
+		t.Fatalf("saveTag: %v", err)
+	}
+	if tag.Slug != "go-lang-2" {
+		t.Errorf("slug = %q, want go-lang-2", tag.Slug)
+	}
+}
+
+func TestSaveTagTakenLabel(t *testing.T) {
+	db := newTestDB(t)
+
+	tag := models.Tag{Label: "Linux"}
+	if err := normalizeTag(db, testNormalizer, &tag); err != nil {
+		t.Fatal(err)
+	}
+
+	// a concurrent request creates the same tag between the check and the insert
+	if err := db.Create(&models.Tag{Label: "LINUX", NormalizedLabel: tag.NormalizedLabel, Slug: "linux-1"}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	err := saveTag(db, &tag, func(tx *gorm.DB) error { return tx.Create(&tag).Error })
+	var responseError *utils.ResponseError
+	if !errors.As(err, &responseError) || responseError.Status != http.StatusConflict {
+		t.Fatalf("saveTag = %v, want a 409", err)
+	}
+
+	resolved, err := resolveTag(db, testNormalizer, "linux")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resolved.Label != "LINUX" {
+		t.Errorf("resolveTag = %q, want the existing tag", resolved.Label)
+	}
+}
+
+func TestNormalizedAliasesUnique(t *testing.T) {
+	db := newTestDB(t)
+
+	tag := models.Tag{Label: "Kubernetes", NormalizedLabel: "kubernetes", Slug: "kubernetes"}
+	if err := db.Create(&tag).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&models.TagAlias{Alias: "k8s", NormalizedAlias: "k8s", TagID: tag.ID}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	err := db.Create(&models.TagAlias{Alias: "K8S", NormalizedAlias: "k8s", TagID: tag.ID}).Error
+	if !utils.IsUniqueViolation(db, err) {
+		t.Errorf("duplicate normalized alias: err = %v, want a unique violation", err)
+	}
+}
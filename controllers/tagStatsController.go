@@ -0,0 +1,159 @@
+package controllers
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/fatah-illah/asset-finder/data/response"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultCloudBuckets = 5
+	maxCloudBuckets     = 10
+)
+
+// tagStatsSorts maps the sort parameter of GetTagStats to its column
+var tagStatsSorts = map[string]string{
+	"count":      "post_count",
+	"label":      "label",
+	"first_used": "first_used_at",
+	"last_used":  "last_used_at",
+}
+
+// tagStatsQuery counts the posts of every tag along with when it was first and
+// last put on a post
+func tagStatsQuery(db *gorm.DB) *gorm.DB {
+	return db.Table("tags").
+		Select("tags.id, tags.label, tags.slug, COUNT(post_tags.post_id) AS post_count, " +
+			"MIN(post_tags.created_at) AS first_used_at, MAX(post_tags.created_at) AS last_used_at").
+		Joins("LEFT JOIN post_tags ON post_tags.tag_id = tags.id").
+		Group("tags.id, tags.label, tags.slug")
+}
+
+// GetTagStats godoc
+// @Summary Get tag usage statistics
+// @Description Return the post count and the first and last use of every tag having at least min_count posts, and the orphan tags without posts. With format=cloud, return the tags weighted for a tag cloud with sizes from 1 to buckets.
+// @Tags tags
+// @Produce json
+// @Param sort query string false "count (default), label, first_used or last_used"
+// @Param order query string false "asc or desc, default desc for count and asc otherwise"
+// @Param min_count query int false "Minimum number of posts (default 1)"
+// @Param format query string false "list (default) or cloud"
+// @Param buckets query int false "Number of tag cloud sizes (default 5, at most 10)"
+// @Success 200 {object} response.Response{data=response.TagStatsResponse}
+// @Failure 400 {object} response.Response{} "Invalid parameter"
+// @Router /tags/stats [get]
+func (h *TagController) GetTagStats(c *gin.Context) {
+	db := h.DB.WithContext(c.Request.Context())
+
+	sort := c.DefaultQuery("sort", "count")
+	column, ok := tagStatsSorts[sort]
+	if !ok {
+		c.JSON(http.StatusBadRequest, response.NewErrorResponse(http.StatusBadRequest, "sort must be count, label, first_used or last_used"))
+		return
+	}
+
+	order := "ASC"
+	if sort == "count" {
+		order = "DESC"
+	}
+	switch c.Query("order") {
+	case "":
+	case "asc":
+		order = "ASC"
+	case "desc":
+		order = "DESC"
+	default:
+		c.JSON(http.StatusBadRequest, response.NewErrorResponse(http.StatusBadRequest, "order must be asc or desc"))
+		return
+	}
+
+	minCount := 1
+	if value := c.Query("min_count"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 {
+			c.JSON(http.StatusBadRequest, response.NewErrorResponse(http.StatusBadRequest, "Invalid min_count"))
+			return
+		}
+		minCount = parsed
+	}
+
+	stats := []response.TagStatResponse{}
+	err := tagStatsQuery(db).
+		Having("COUNT(post_tags.post_id) >= ?", minCount).
+		Order(column + " " + order + ", label").
+		Scan(&stats).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, response.NewErrorResponse(http.StatusInternalServerError, err.Error()))
+		return
+	}
+
+	switch c.DefaultQuery("format", "list") {
+	case "list":
+	case "cloud":
+		buckets := defaultCloudBuckets
+		if value := c.Query("buckets"); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed < 1 {
+				c.JSON(http.StatusBadRequest, response.NewErrorResponse(http.StatusBadRequest, "Invalid buckets"))
+				return
+			}
+			buckets = min(parsed, maxCloudBuckets)
+		}
+
+		c.JSON(http.StatusOK, response.NewSuccessResponse(tagCloud(stats, buckets)))
+		return
+	default:
+		c.JSON(http.StatusBadRequest, response.NewErrorResponse(http.StatusBadRequest, "format must be list or cloud"))
+		return
+	}
+
+	orphans := []response.TagStatResponse{}
+	err = tagStatsQuery(db).
+		Having("COUNT(post_tags.post_id) = 0").
+		Order("label").
+		Scan(&orphans).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, response.NewErrorResponse(http.StatusInternalServerError, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, response.NewSuccessResponse(response.TagStatsResponse{Tags: stats, Orphans: orphans}))
+}
+
+// tagCloud weights the tags on a logarithmic scale, so that a few very popular
+// tags do not shrink all the others, and buckets the weights into sizes
+func tagCloud(stats []response.TagStatResponse, buckets int) []response.TagCloudResponse {
+	cloud := make([]response.TagCloudResponse, 0, len(stats))
+	if len(stats) == 0 {
+		return cloud
+	}
+
+	lowest, highest := stats[0].PostCount, stats[0].PostCount
+	for _, stat := range stats {
+		lowest = min(lowest, stat.PostCount)
+		highest = max(highest, stat.PostCount)
+	}
+	spread := math.Log(float64(highest)) - math.Log(float64(lowest))
+
+	for _, stat := range stats {
+		weight := 1.0
+		if spread > 0 {
+			weight = (math.Log(float64(stat.PostCount)) - math.Log(float64(lowest))) / spread
+		}
+
+		cloud = append(cloud, response.TagCloudResponse{
+			ID:        stat.ID,
+			Label:     stat.Label,
+			Slug:      stat.Slug,
+			PostCount: stat.PostCount,
+			Weight:    weight,
+			Size:      1 + int(math.Round(weight*float64(buckets-1))),
+		})
+	}
+
+	return cloud
+}
@@ -0,0 +1,94 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/fatah-illah/asset-finder/data/response"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	defaultSuggestLimit = 10
+	maxSuggestLimit     = 50
+
+	tagUsageCountSQL = "(SELECT COUNT(*) FROM post_tags WHERE post_tags.tag_id = tags.id)"
+)
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// supportsTrigram reports whether the pg_trgm extension is installed
+func supportsTrigram(db *gorm.DB) bool {
+	if db.Dialector.Name() != "postgres" {
+		return false
+	}
+
+	var installed bool
+	if err := db.Raw("SELECT EXISTS (SELECT 1 FROM pg_extension WHERE extname = 'pg_trgm')").Scan(&installed).Error; err != nil {
+		return false
+	}
+	return installed
+}
+
+// SuggestTags godoc
+// @Summary Suggest tags for autocomplete
+// @Description Return the tags matching q, prefix matches first then fuzzy matches (trigram similarity on Postgres with pg_trgm, substring matches elsewhere)
+// @Tags tags
+// @Produce json
+// @Param q query string true "Typed text"
+// @Param limit query int false "Maximum number of suggestions (default 10, at most 50)"
+// @Success 200 {object} response.Response{data=[]response.TagSuggestionResponse}
+// @Failure 400 {object} response.Response{} "Invalid limit"
+// @Router /tags/suggest [get]
+func (h *TagController) SuggestTags(c *gin.Context) {
+	db := h.DB.WithContext(c.Request.Context())
+
+	limit := defaultSuggestLimit
+	if value := c.Query("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			c.JSON(http.StatusBadRequest, response.NewErrorResponse(http.StatusBadRequest, "Invalid limit"))
+			return
+		}
+		limit = min(parsed, maxSuggestLimit)
+	}
+
+	suggestions := []response.TagSuggestionResponse{}
+
+	key := h.Normalizer.Key(c.Query("q"))
+	if key == "" {
+		c.JSON(http.StatusOK, response.NewSuccessResponse(suggestions))
+		return
+	}
+
+	escaped := likeEscaper.Replace(key)
+	prefix := escaped + "%"
+
+	query := db.Table("tags").
+		Select("id, label, "+tagUsageCountSQL+" AS usage_count, "+
+			`CASE WHEN normalized_label LIKE ? ESCAPE '\' THEN 0 ELSE 1 END AS match_rank`, prefix).
+		Order("match_rank")
+
+	if h.trigram {
+		query = query.
+			Where(`normalized_label LIKE ? ESCAPE '\' OR normalized_label % ?`, prefix, key).
+			Order(clause.OrderBy{Expression: clause.Expr{SQL: "similarity(normalized_label, ?) DESC", Vars: []interface{}{key}}})
+	} else {
+		query = query.Where(`normalized_label LIKE ? ESCAPE '\'`, "%"+escaped+"%")
+	}
+
+	err := query.
+		Order("usage_count DESC").
+		Order("label").
+		Limit(limit).
+		Scan(&suggestions).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, response.NewErrorResponse(http.StatusInternalServerError, err.Error()))
+		return
+	}
+
+	c.JSON(http.StatusOK, response.NewSuccessResponse(suggestions))
+}
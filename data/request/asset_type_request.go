@@ -0,0 +1,18 @@
+package request
+
+import "encoding/json"
+
+type AssetTypeRequest struct {
+	Name        string          `validate:"required,min=1,max=64" json:"name"`
+	Description string          `validate:"max=1000" json:"description"`
+	Schema      json.RawMessage `validate:"required" json:"schema"`
+}
+
+type AssetTypeUpdateRequest struct {
+	Name        string `validate:"required,min=1,max=64" json:"name"`
+	Description string `validate:"max=1000" json:"description"`
+}
+
+type AssetTypeSchemaRequest struct {
+	Schema json.RawMessage `validate:"required" json:"schema"`
+}
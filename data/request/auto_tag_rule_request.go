@@ -0,0 +1,11 @@
+package request
+
+type AutoTagRuleRequest struct {
+	Name      string   `validate:"max=255" json:"name"`
+	Field     string   `validate:"required,oneof=title content any" json:"field"`
+	MatchType string   `validate:"required,oneof=regex keyword" json:"match_type"`
+	Pattern   string   `validate:"required,max=1000" json:"pattern"`
+	Tags      []string `validate:"required,min=1,max=20,dive,min=1,max=255" json:"tags"`
+	Priority  int      `json:"priority"`
+	Enabled   *bool    `json:"enabled"`
+}
@@ -1,7 +1,18 @@
 package request
 
+import "time"
+
 type PostRequest struct {
-	Title   string   `validate:"required,min=1,max=255" json:"title"`
-	Content string   `validate:"required" json:"content"`
-	Tags    []string `json:"tags"`
+	Title       string                 `validate:"required,min=1,max=255" json:"title"`
+	Content     string                 `validate:"required" json:"content"`
+	AssetTypeID *uint                  `json:"asset_type_id"`
+	Metadata    map[string]interface{} `validate:"max=100" json:"metadata"`
+	PublishAt   *time.Time             `json:"publish_at"`
+	UnpublishAt *time.Time             `json:"unpublish_at"`
+	Tags        []PostTagRequest       `validate:"dive" json:"tags"`
+}
+
+// PostTagRequest names a tag of a post by label, slug or alias
+type PostTagRequest struct {
+	Label string `validate:"required,min=1,max=255" json:"label"`
 }
@@ -0,0 +1,5 @@
+package request
+
+type PostTransitionRequest struct {
+	Comment string `validate:"max=1000" json:"comment"`
+}
@@ -0,0 +1,5 @@
+package request
+
+type TagAliasRequest struct {
+	Alias string `validate:"required,min=1,max=255" json:"alias"`
+}
@@ -0,0 +1,5 @@
+package request
+
+type TagMergeRequest struct {
+	SourceIDs []uint `validate:"required,min=1,dive,required" json:"source_ids"`
+}
@@ -0,0 +1,5 @@
+package request
+
+type TagMoveRequest struct {
+	ParentID *uint `json:"parent_id"`
+}
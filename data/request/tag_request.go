@@ -1,6 +1,13 @@
 package request
 
 type TagRequest struct {
-	Label string   `validate:"required,min=1,max=255" json:"label"`
-	Posts []string `json:"posts"`
+	Label    string   `validate:"required,min=1,max=255" json:"label"`
+	ParentID *uint    `json:"parent_id"`
+	Posts    []string `validate:"dive,min=1,max=255" json:"posts"`
+
+	Description      string `validate:"max=1000" json:"description"`
+	Color            string `validate:"omitempty,rgbcolor" json:"color"`
+	Icon             string `validate:"max=64" json:"icon"`
+	Deprecated       bool   `json:"deprecated"`
+	ReplacementTagID *uint  `validate:"omitempty,excluded_without=Deprecated" json:"replacement_tag_id"`
 }
@@ -0,0 +1,40 @@
+package response
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/fatah-illah/asset-finder/assettype"
+)
+
+type AssetTypeResponse struct {
+	ID             uint            `json:"id"`
+	Name           string          `json:"name"`
+	Description    string          `json:"description"`
+	CurrentVersion int             `json:"current_version"`
+	Schema         json.RawMessage `json:"schema" swaggertype:"object"`
+	CreatedAt      time.Time       `json:"created_at"`
+	UpdatedAt      time.Time       `json:"updated_at"`
+}
+
+type AssetTypeSchemaResponse struct {
+	AssetTypeID uint            `json:"asset_type_id"`
+	Version     int             `json:"version"`
+	Current     bool            `json:"current"`
+	Schema      json.RawMessage `json:"schema" swaggertype:"object"`
+	CreatedAt   time.Time       `json:"created_at"`
+}
+
+type AssetTypeReportResponse struct {
+	AssetTypeID  uint                          `json:"asset_type_id"`
+	Version      int                           `json:"version"`
+	CheckedPosts int                           `json:"checked_posts"`
+	FailingPosts int                           `json:"failing_posts"`
+	Posts        []AssetTypeReportPostResponse `json:"posts"`
+}
+
+type AssetTypeReportPostResponse struct {
+	ID         uint                  `json:"id"`
+	Title      string                `json:"title"`
+	Violations []assettype.Violation `json:"violations"`
+}
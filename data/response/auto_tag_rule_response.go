@@ -0,0 +1,12 @@
+package response
+
+type AutoTagDryRunResponse struct {
+	MatchedPosts int64                       `json:"matched_posts"`
+	Posts        []AutoTagDryRunPostResponse `json:"posts"`
+}
+
+type AutoTagDryRunPostResponse struct {
+	ID        uint     `json:"id"`
+	Title     string   `json:"title"`
+	AddedTags []string `json:"added_tags"`
+}
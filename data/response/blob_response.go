@@ -0,0 +1,15 @@
+package response
+
+type BlobResponse struct {
+	SHA256      string                   `json:"sha256"`
+	Size        int64                    `json:"size"`
+	ContentType string                   `json:"content_type"`
+	Attachments []BlobAttachmentResponse `json:"attachments"`
+}
+
+type BlobAttachmentResponse struct {
+	ID        uint   `json:"id"`
+	FileName  string `json:"file_name"`
+	PostID    uint   `json:"post_id"`
+	PostTitle string `json:"post_title"`
+}
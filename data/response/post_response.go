@@ -1,8 +1,9 @@
 package response
 
 type PostResponse struct {
-	ID      uint          `json:"id"`
-	Title   string        `json:"title"`
-	Content string        `json:"content"`
-	Tags    []TagResponse `json:"tags"`
+	ID       uint                   `json:"id"`
+	Title    string                 `json:"title"`
+	Content  string                 `json:"content"`
+	Metadata map[string]interface{} `json:"metadata"`
+	Tags     []TagResponse          `json:"tags"`
 }
@@ -0,0 +1,21 @@
+package response
+
+import "time"
+
+type RelatedTagsResponse struct {
+	TagID       uint                 `json:"tag_id"`
+	RefreshedAt *time.Time           `json:"refreshed_at"`
+	Related     []RelatedTagResponse `json:"related"`
+}
+
+type RelatedTagResponse struct {
+	ID      uint    `json:"id"`
+	Label   string  `json:"label"`
+	Support int64   `json:"support"`
+	Lift    float64 `json:"lift"`
+	PMI     float64 `json:"pmi"`
+}
+
+type CooccurrenceRefreshResponse struct {
+	Pairs int64 `json:"pairs"`
+}
@@ -0,0 +1,11 @@
+package response
+
+import "time"
+
+type ScheduledPostResponse struct {
+	PostID     uint      `json:"post_id"`
+	Title      string    `json:"title"`
+	Status     string    `json:"status"`
+	Transition string    `json:"transition"`
+	At         time.Time `json:"at"`
+}
@@ -0,0 +1,8 @@
+package response
+
+type SimilarPostResponse struct {
+	ID         uint    `json:"id"`
+	Title      string  `json:"title"`
+	SharedTags int64   `json:"shared_tags"`
+	Similarity float64 `json:"similarity"`
+}
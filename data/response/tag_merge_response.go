@@ -0,0 +1,8 @@
+package response
+
+type TagMergeResponse struct {
+	TagID             uint     `json:"tag_id"`
+	MergedTagIDs      []uint   `json:"merged_tag_ids"`
+	AssociationsMoved int64    `json:"associations_moved"`
+	AliasesCreated    []string `json:"aliases_created"`
+}
@@ -0,0 +1,8 @@
+package response
+
+type TagNamespaceResponse struct {
+	Namespace  string `json:"namespace"`
+	TagCount   int64  `json:"tag_count"`
+	PostCount  int64  `json:"post_count"`
+	MaxPerPost int    `json:"max_per_post,omitempty"`
+}
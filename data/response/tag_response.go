@@ -1,7 +1,18 @@
 package response
 
 type TagResponse struct {
-	ID    uint           `json:"id"`
-	Label string         `json:"label"`
+	ID        uint   `json:"id"`
+	Label     string `json:"label"`
+	Slug      string `json:"slug"`
+	Namespace string `json:"namespace,omitempty"`
+	Value     string `json:"value,omitempty"`
+	ParentID  *uint  `json:"parent_id"`
+
+	Description      string `json:"description"`
+	Color            string `json:"color"`
+	Icon             string `json:"icon"`
+	Deprecated       bool   `json:"deprecated"`
+	ReplacementTagID *uint  `json:"replacement_tag_id"`
+
 	Posts []PostResponse `json:"posts"`
 }
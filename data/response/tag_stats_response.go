@@ -0,0 +1,26 @@
+package response
+
+import "time"
+
+type TagStatsResponse struct {
+	Tags    []TagStatResponse `json:"tags"`
+	Orphans []TagStatResponse `json:"orphans"`
+}
+
+type TagStatResponse struct {
+	ID          uint       `json:"id"`
+	Label       string     `json:"label"`
+	Slug        string     `json:"slug"`
+	PostCount   int64      `json:"post_count"`
+	FirstUsedAt *time.Time `json:"first_used_at"`
+	LastUsedAt  *time.Time `json:"last_used_at"`
+}
+
+type TagCloudResponse struct {
+	ID        uint    `json:"id"`
+	Label     string  `json:"label"`
+	Slug      string  `json:"slug"`
+	PostCount int64   `json:"post_count"`
+	Weight    float64 `json:"weight"`
+	Size      int     `json:"size"`
+}
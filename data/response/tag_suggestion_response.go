@@ -0,0 +1,7 @@
+package response
+
+type TagSuggestionResponse struct {
+	ID         uint   `json:"id"`
+	Label      string `json:"label"`
+	UsageCount int64  `json:"usage_count"`
+}
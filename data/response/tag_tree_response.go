@@ -0,0 +1,8 @@
+package response
+
+type TagTreeResponse struct {
+	ID       uint               `json:"id"`
+	Label    string             `json:"label"`
+	ParentID *uint              `json:"parent_id"`
+	Children []*TagTreeResponse `json:"children"`
+}
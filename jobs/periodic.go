@@ -0,0 +1,63 @@
+package jobs
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Periodic runs a background job at startup and then at a fixed interval until
+// it is stopped
+type Periodic struct {
+	name     string
+	interval time.Duration
+	run      func(ctx context.Context) error
+
+	cancel context.CancelFunc
+	done   sync.WaitGroup
+}
+
+func NewPeriodic(name string, interval time.Duration, run func(ctx context.Context) error) *Periodic {
+	return &Periodic{name: name, interval: interval, run: run}
+}
+
+// Start runs the job in its own goroutine
+func (p *Periodic) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	p.cancel = cancel
+
+	logger := log.With().Str("job", p.name).Logger()
+	ctx = logger.WithContext(ctx)
+
+	p.done.Add(1)
+	go func() {
+		defer p.done.Done()
+
+		ticker := time.NewTicker(p.interval)
+		defer ticker.Stop()
+
+		for {
+			if err := p.run(ctx); err != nil && ctx.Err() == nil {
+				logger.Error().Err(err).Msg("Job failed")
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop cancels the running job and waits for it to return
+func (p *Periodic) Stop() {
+	if p.cancel == nil {
+		return
+	}
+
+	p.cancel()
+	p.done.Wait()
+}
@@ -0,0 +1,90 @@
+package jobs
+
+import (
+	"context"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Pool handles queued items with a fixed number of workers until it is stopped,
+// the items still queued when it stops are dropped
+type Pool struct {
+	name    string
+	workers int
+	handle  func(ctx context.Context, item string) error
+	queue   chan string
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   sync.WaitGroup
+}
+
+func NewPool(name string, workers, queueSize int, handle func(ctx context.Context, item string) error) *Pool {
+	ctx, cancel := context.WithCancel(context.Background())
+	logger := log.With().Str("job", name).Logger()
+
+	return &Pool{
+		name:    name,
+		workers: workers,
+		handle:  handle,
+		queue:   make(chan string, queueSize),
+		ctx:     logger.WithContext(ctx),
+		cancel:  cancel,
+	}
+}
+
+// Start runs the workers in their own goroutines
+func (p *Pool) Start() {
+	logger := log.Ctx(p.ctx)
+
+	for i := 0; i < p.workers; i++ {
+		p.done.Add(1)
+		go func() {
+			defer p.done.Done()
+
+			for {
+				select {
+				case <-p.ctx.Done():
+					return
+				case item := <-p.queue:
+					if err := p.handle(p.ctx, item); err != nil && p.ctx.Err() == nil {
+						logger.Error().Err(err).Str("item", item).Msg("Job failed")
+					}
+				}
+			}
+		}()
+	}
+}
+
+// TryEnqueue queues an item unless the queue is full or the pool stopped
+func (p *Pool) TryEnqueue(item string) bool {
+	if p.ctx.Err() != nil {
+		return false
+	}
+
+	select {
+	case p.queue <- item:
+		return true
+	default:
+		return false
+	}
+}
+
+// Enqueue queues an item, waiting for room in the queue
+func (p *Pool) Enqueue(ctx context.Context, item string) error {
+	select {
+	case p.queue <- item:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-p.ctx.Done():
+		return p.ctx.Err()
+	}
+}
+
+// Stop cancels the running handlers and waits for the workers to return
+func (p *Pool) Stop() {
+	p.cancel()
+	p.done.Wait()
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"fmt"
 	"os"
 
 	"github.com/fatah-illah/asset-finder/config"
@@ -17,27 +18,53 @@ import (
 func main() {
 	utils.SetupTimezone()
 
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(os.Args[1:]))
+	}
+
 	log.Info().Msg("Starting Asset Finder - API Development")
 
 	log.Info().Msg("Initializing configuration ...")
-	confHandler := config.InitConfig(getConfigFileName())
+	configLoader := config.NewLoader(config.Profile())
+	confHandler, err := configLoader.Load()
+	if err != nil {
+		log.Fatal().Err(err).Msg("Error while loading configuration")
+	}
+	utils.SetupLogLevel(confHandler.Log.Level)
+
+	log.Info().Msg("Initializing tracing ...")
+	tracerProvider := server.InitTracing(confHandler)
+	defer server.ShutdownTracing(tracerProvider)
+
+	log.Info().Msg("Initializing attachment storage ...")
+	blobStore := server.InitBlobStore(confHandler)
 
 	log.Info().Msg("Initializing database ...")
-	dbHandler := server.InitDatabase(confHandler)
+	dbHandler := server.InitDatabase(confHandler, blobStore)
 	log.Info().Msgf("Database initialized. Handler: %+v", dbHandler)
 
 	log.Info().Msg("Initializing HTTP Server ...")
-	httpServer := server.InitHttpServer(confHandler, dbHandler)
+	httpServer := server.InitHttpServer(confHandler, dbHandler, blobStore)
+
+	configLoader.Watch(httpServer.Reload)
 
 	httpServer.Start()
-}
 
-func getConfigFileName() string {
-	env := os.Getenv("ENV")
+	server.CloseDatabase(dbHandler)
+	log.Info().Msg("Asset Finder stopped")
+}
 
-	if env != "" {
-		return "asset_finder" + env
+// runCommand runs a command line sub-command and returns the exit code
+func runCommand(args []string) int {
+	switch {
+	case len(args) == 2 && args[0] == "config" && args[1] == "print":
+		if err := config.NewLoader(config.Profile()).Print(os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "\n# configuration is invalid:\n%v\n", err)
+			return 1
+		}
+		return 0
+	default:
+		fmt.Fprintln(os.Stderr, "usage: asset-finder [config print]")
+		return 2
 	}
-
-	return "asset_finder"
 }
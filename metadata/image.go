@@ -0,0 +1,61 @@
+package metadata
+
+import (
+	"image"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/rwcarlsen/goexif/exif"
+
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+
+	_ "golang.org/x/image/bmp"
+	_ "golang.org/x/image/tiff"
+	_ "golang.org/x/image/webp"
+)
+
+func extractImage(content io.ReadSeeker, size int64, values map[string]string) (err error) {
+	// the EXIF decoder panics on some malformed blocks
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = malformed("image: %v", recovered)
+		}
+	}()
+
+	config, _, err := image.DecodeConfig(content)
+	if err != nil {
+		return malformed("image: %v", err)
+	}
+	values[Width] = strconv.Itoa(config.Width)
+	values[Height] = strconv.Itoa(config.Height)
+
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	// only JPEG and TIFF images carry EXIF data the decoder can find
+	x, err := exif.Decode(content)
+	if err != nil {
+		return nil
+	}
+
+	for name, key := range map[exif.FieldName]string{exif.Make: CameraMake, exif.Model: CameraModel} {
+		if tag, err := x.Get(name); err == nil {
+			if value, err := tag.StringVal(); err == nil && value != "" {
+				values[key] = value
+			}
+		}
+	}
+	if takenAt, err := x.DateTime(); err == nil {
+		values[TakenAt] = takenAt.Format(time.RFC3339)
+	}
+	if latitude, longitude, err := x.LatLong(); err == nil {
+		values[GPSLatitude] = strconv.FormatFloat(latitude, 'f', -1, 64)
+		values[GPSLongitude] = strconv.FormatFloat(longitude, 'f', -1, 64)
+	}
+
+	return nil
+}
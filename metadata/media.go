@@ -0,0 +1,146 @@
+package metadata
+
+import (
+	"encoding/binary"
+	"io"
+	"strconv"
+)
+
+// extractMP4 reads the duration of an MP4 or QuickTime file from the movie
+// header box (moov/mvhd)
+func extractMP4(content io.ReadSeeker, size int64, values map[string]string) error {
+	moov, moovEnd, err := findBox(content, 0, size, "moov")
+	if err != nil {
+		return err
+	}
+	mvhd, _, err := findBox(content, moov, moovEnd, "mvhd")
+	if err != nil {
+		return err
+	}
+
+	if _, err := content.Seek(mvhd, io.SeekStart); err != nil {
+		return err
+	}
+
+	var version [4]byte
+	if _, err := io.ReadFull(content, version[:]); err != nil {
+		return malformed("mvhd: %v", err)
+	}
+
+	var timescale uint32
+	var duration uint64
+	if version[0] == 1 {
+		var header struct {
+			Created, Modified uint64
+			Timescale         uint32
+			Duration          uint64
+		}
+		if err := binary.Read(content, binary.BigEndian, &header); err != nil {
+			return malformed("mvhd: %v", err)
+		}
+		timescale, duration = header.Timescale, header.Duration
+	} else {
+		var header struct {
+			Created, Modified uint32
+			Timescale         uint32
+			Duration          uint32
+		}
+		if err := binary.Read(content, binary.BigEndian, &header); err != nil {
+			return malformed("mvhd: %v", err)
+		}
+		timescale, duration = header.Timescale, uint64(header.Duration)
+	}
+
+	if timescale == 0 {
+		return malformed("mvhd: zero timescale")
+	}
+	values[Duration] = formatSeconds(float64(duration) / float64(timescale))
+
+	return nil
+}
+
+// findBox returns the content range of the first box of the given type
+// between start and end
+func findBox(content io.ReadSeeker, start, end int64, boxType string) (int64, int64, error) {
+	for offset := start; offset+8 <= end; {
+		if _, err := content.Seek(offset, io.SeekStart); err != nil {
+			return 0, 0, err
+		}
+
+		var header [8]byte
+		if _, err := io.ReadFull(content, header[:]); err != nil {
+			return 0, 0, malformed("box: %v", err)
+		}
+
+		size := int64(binary.BigEndian.Uint32(header[:4]))
+		headerSize := int64(8)
+		switch size {
+		case 0:
+			size = end - offset
+		case 1:
+			var large uint64
+			if err := binary.Read(content, binary.BigEndian, &large); err != nil {
+				return 0, 0, malformed("box: %v", err)
+			}
+			size, headerSize = int64(large), 16
+		}
+		if size < headerSize || offset+size > end {
+			return 0, 0, malformed("box %q: invalid size %d", header[4:], size)
+		}
+
+		if string(header[4:]) == boxType {
+			return offset + headerSize, offset + size, nil
+		}
+		offset += size
+	}
+
+	return 0, 0, malformed("box %q not found", boxType)
+}
+
+// extractWAV reads the duration of a WAV file from its format and data chunks
+func extractWAV(content io.ReadSeeker, size int64, values map[string]string) error {
+	var riff [12]byte
+	if _, err := io.ReadFull(content, riff[:]); err != nil {
+		return malformed("wav: %v", err)
+	}
+	if string(riff[:4]) != "RIFF" || string(riff[8:]) != "WAVE" {
+		return malformed("wav: not a RIFF WAVE file")
+	}
+
+	var byteRate uint32
+	for {
+		var header [8]byte
+		if _, err := io.ReadFull(content, header[:]); err != nil {
+			return malformed("wav: %v", err)
+		}
+		chunkSize := int64(binary.LittleEndian.Uint32(header[4:]))
+
+		switch string(header[:4]) {
+		case "fmt ":
+			if chunkSize < 12 {
+				return malformed("wav: format chunk of %d bytes", chunkSize)
+			}
+			var format [12]byte
+			if _, err := io.ReadFull(content, format[:]); err != nil {
+				return malformed("wav: %v", err)
+			}
+			byteRate = binary.LittleEndian.Uint32(format[8:])
+			chunkSize -= int64(len(format))
+		case "data":
+			if byteRate == 0 {
+				return malformed("wav: data before format")
+			}
+			values[Duration] = formatSeconds(float64(chunkSize) / float64(byteRate))
+			return nil
+		}
+
+		// chunks are padded to an even size
+		if _, err := content.Seek(chunkSize+chunkSize%2, io.SeekCurrent); err != nil {
+			return err
+		}
+	}
+}
+
+func formatSeconds(seconds float64) string {
+	return strconv.FormatFloat(seconds, 'f', 3, 64)
+}
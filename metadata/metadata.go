@@ -0,0 +1,99 @@
+// Package metadata detects the media type of uploaded files and extracts what
+// can be read from them with pure Go parsers: image dimensions and EXIF, PDF
+// page count and title, audio and video duration.
+package metadata
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/gabriel-vasile/mimetype"
+)
+
+// Metadata keys
+const (
+	Width        = "width"
+	Height       = "height"
+	CameraMake   = "camera_make"
+	CameraModel  = "camera_model"
+	TakenAt      = "taken_at"
+	GPSLatitude  = "gps_latitude"
+	GPSLongitude = "gps_longitude"
+	PageCount    = "page_count"
+	Title        = "title"
+	Duration     = "duration_seconds"
+)
+
+// Detect returns the media type of a content from its first bytes, whatever
+// its name or the type announced by the client, and rewinds it
+func Detect(content io.ReadSeeker) (string, error) {
+	detected, err := mimetype.DetectReader(content)
+	if err != nil {
+		return "", err
+	}
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+
+	mediaType, _, _ := strings.Cut(detected.String(), ";")
+	return mediaType, nil
+}
+
+// Kind groups media types for the type:<kind> tags: image, video, audio, text,
+// document, archive or file
+func Kind(mediaType string) string {
+	major, minor, _ := strings.Cut(mediaType, "/")
+	switch {
+	case major == "image" || major == "video" || major == "audio" || major == "text":
+		return major
+	case minor == "pdf" || minor == "msword" || minor == "rtf" ||
+		strings.HasPrefix(minor, "vnd.openxmlformats-officedocument.") ||
+		strings.HasPrefix(minor, "vnd.oasis.opendocument.") ||
+		strings.HasPrefix(minor, "vnd.ms-"):
+		return "document"
+	case minor == "zip" || minor == "gzip" || minor == "x-tar" || minor == "x-7z-compressed" ||
+		minor == "x-bzip2" || minor == "x-xz" || minor == "zstd" || minor == "vnd.rar":
+		return "archive"
+	default:
+		return "file"
+	}
+}
+
+// Extract reads the metadata of a content of the given media type. Contents the
+// parsers do not understand have no metadata, only read errors are returned.
+func Extract(content io.ReadSeeker, size int64, mediaType string) (map[string]string, error) {
+	values := make(map[string]string)
+
+	var extract func(io.ReadSeeker, int64, map[string]string) error
+	switch {
+	case strings.HasPrefix(mediaType, "image/"):
+		extract = extractImage
+	case mediaType == "application/pdf":
+		extract = extractPDF
+	case mediaType == "video/mp4" || mediaType == "video/quicktime" || mediaType == "audio/mp4" ||
+		mediaType == "video/3gpp" || mediaType == "video/3gpp2" || mediaType == "audio/x-m4a" || mediaType == "video/x-m4v":
+		extract = extractMP4
+	case mediaType == "audio/wav":
+		extract = extractWAV
+	default:
+		return values, nil
+	}
+
+	err := extract(content, size, values)
+	if _, seekErr := content.Seek(0, io.SeekStart); seekErr != nil {
+		return nil, seekErr
+	}
+	if errors.Is(err, errMalformed) {
+		return values, nil
+	}
+	return values, err
+}
+
+// errMalformed stops the extraction of a content its parser does not understand
+var errMalformed = errors.New("malformed content")
+
+func malformed(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", errMalformed, fmt.Sprintf(format, args...))
+}
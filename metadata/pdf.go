@@ -0,0 +1,50 @@
+package metadata
+
+import (
+	"io"
+	"strconv"
+	"strings"
+
+	"rsc.io/pdf"
+)
+
+func extractPDF(content io.ReadSeeker, size int64, values map[string]string) (err error) {
+	// the PDF reader panics on some malformed documents
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = malformed("pdf: %v", recovered)
+		}
+	}()
+
+	document, err := pdf.NewReader(readerAt(content), size)
+	if err != nil {
+		return malformed("pdf: %v", err)
+	}
+
+	values[PageCount] = strconv.Itoa(document.NumPage())
+	if title := strings.TrimSpace(document.Trailer().Key("Info").Key("Title").Text()); title != "" {
+		values[Title] = title
+	}
+
+	return nil
+}
+
+// readerAt reads at an offset of a content by seeking, when it is not an
+// io.ReaderAt already
+func readerAt(content io.ReadSeeker) io.ReaderAt {
+	if r, ok := content.(io.ReaderAt); ok {
+		return r
+	}
+	return seekingReaderAt{content}
+}
+
+type seekingReaderAt struct {
+	io.ReadSeeker
+}
+
+func (r seekingReaderAt) ReadAt(p []byte, offset int64) (int, error) {
+	if _, err := r.Seek(offset, io.SeekStart); err != nil {
+		return 0, err
+	}
+	return io.ReadFull(r, p)
+}
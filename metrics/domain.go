@@ -0,0 +1,64 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/fatah-illah/asset-finder/models"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+)
+
+const domainScrapeTimeout = 2 * time.Second
+
+// domainCollector counts posts, tags and tag associations on every scrape
+type domainCollector struct {
+	db *gorm.DB
+
+	posts           *prometheus.Desc
+	tags            *prometheus.Desc
+	tagAssociations *prometheus.Desc
+}
+
+func newDomainCollector(db *gorm.DB) *domainCollector {
+	return &domainCollector{
+		db:              db,
+		posts:           prometheus.NewDesc(namespace+"_posts", "Number of posts.", nil, nil),
+		tags:            prometheus.NewDesc(namespace+"_tags", "Number of tags.", nil, nil),
+		tagAssociations: prometheus.NewDesc(namespace+"_tag_associations", "Number of post to tag associations.", nil, nil),
+	}
+}
+
+// Describe implements prometheus.Collector
+func (d *domainCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- d.posts
+	ch <- d.tags
+	ch <- d.tagAssociations
+}
+
+// Collect implements prometheus.Collector
+func (d *domainCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), domainScrapeTimeout)
+	defer cancel()
+
+	db := d.db.WithContext(ctx)
+
+	for _, count := range []struct {
+		desc  *prometheus.Desc
+		model interface{}
+	}{
+		{d.posts, &models.Post{}},
+		{d.tags, &models.Tag{}},
+		{d.tagAssociations, &models.PostTag{}},
+	} {
+		var total int64
+		if err := db.Model(count.model).Count(&total).Error; err != nil {
+			log.Warn().Err(err).Str("metric", count.desc.String()).Msg("Error while collecting domain metric")
+			ch <- prometheus.NewInvalidMetric(count.desc, err)
+			continue
+		}
+
+		ch <- prometheus.MustNewConstMetric(count.desc, prometheus.GaugeValue, float64(total))
+	}
+}
@@ -0,0 +1,89 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"sync"
+
+	"github.com/fatah-illah/asset-finder/data/response"
+	"github.com/gin-gonic/gin"
+)
+
+// ContextRoleKey is the gin context key holding the role of the authenticated user, if any.
+const ContextRoleKey = "role"
+
+// APIKey is the identity behind an API key
+type APIKey struct {
+	User string
+	Role string
+}
+
+// Authenticator identifies the callers by API key. Requests without a key stay
+// anonymous, requests with an unknown key are rejected and counted against the
+// AuthFailuresGroup rule of the client IP, so that keys cannot be guessed at speed.
+type Authenticator struct {
+	failures *RateLimiter
+
+	mu        sync.RWMutex
+	keyHeader string
+	keys      map[string]APIKey
+}
+
+// NewAuthenticator returns an Authenticator for keys indexed by the hex SHA-256 of the key
+func NewAuthenticator(keyHeader string, keys map[string]APIKey, failures *RateLimiter) *Authenticator {
+	return &Authenticator{keyHeader: keyHeader, keys: keys, failures: failures}
+}
+
+// Configure replaces the key header and the keys
+func (a *Authenticator) Configure(keyHeader string, keys map[string]APIKey) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.keyHeader = keyHeader
+	a.keys = keys
+}
+
+// Handler returns the middleware setting the user and role of the request
+func (a *Authenticator) Handler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		a.mu.RLock()
+		keyHeader, keys := a.keyHeader, a.keys
+		a.mu.RUnlock()
+
+		apiKey := c.GetHeader(keyHeader)
+		if apiKey == "" {
+			c.Next()
+			return
+		}
+
+		// a blocked client is rejected whatever the key, valid keys included
+		if retryAfter := a.failures.Blocked(c, AuthFailuresGroup); retryAfter > 0 {
+			abortTooManyRequests(c, retryAfter)
+			return
+		}
+
+		// only the digests are kept, the lookup does not compare the keys themselves
+		digest := sha256.Sum256([]byte(apiKey))
+		keyDigest := hex.EncodeToString(digest[:])
+		identity, ok := keys[keyDigest]
+		if !ok {
+			if retryAfter := a.failures.Fail(c, AuthFailuresGroup); retryAfter > 0 {
+				abortTooManyRequests(c, retryAfter)
+				return
+			}
+			c.AbortWithStatusJSON(http.StatusUnauthorized, response.NewErrorResponse(http.StatusUnauthorized, "Invalid API key"))
+			return
+		}
+
+		c.Set(ContextAPIKeyKey, keyDigest)
+		c.Set(ContextUserKey, identity.User)
+		c.Set(ContextRoleKey, identity.Role)
+		c.Next()
+	}
+}
+
+// Identity returns the user and role of the request, empty for anonymous requests
+func Identity(c *gin.Context) (user, role string) {
+	return c.GetString(ContextUserKey), c.GetString(ContextRoleKey)
+}
@@ -0,0 +1,85 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newAuthTestRouter(keys map[string]string, failureRule, groupRule RateLimitRule) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+
+	digests := make(map[string]APIKey, len(keys))
+	for key, user := range keys {
+		digest := sha256.Sum256([]byte(key))
+		digests[hex.EncodeToString(digest[:])] = APIKey{User: user, Role: "viewer"}
+	}
+
+	rateLimiter := NewRateLimiter(NewMemoryRateLimitStore(), RateLimitRule{},
+		map[string]RateLimitRule{AuthFailuresGroup: failureRule, "posts": groupRule})
+	authenticator := NewAuthenticator("X-API-Key", digests, rateLimiter)
+
+	r := gin.New()
+	r.GET("/posts", authenticator.Handler(), rateLimiter.Handler("posts"), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	return r
+}
+
+func get(r *gin.Engine, remoteAddr, apiKey string) int {
+	request := httptest.NewRequest(http.MethodGet, "/posts", nil)
+	request.RemoteAddr = remoteAddr
+	if apiKey != "" {
+		request.Header.Set("X-API-Key", apiKey)
+	}
+
+	recorder := httptest.NewRecorder()
+	r.ServeHTTP(recorder, request)
+	return recorder.Code
+}
+
+func TestAuthFailuresBlockClientIP(t *testing.T) {
+	r := newAuthTestRouter(map[string]string{"valid-key": "alice"}, RateLimitRule{Requests: 3, Period: time.Minute}, RateLimitRule{})
+
+	for i := 0; i < 3; i++ {
+		if code := get(r, "192.0.2.1:1234", "guess"); code != http.StatusUnauthorized {
+			t.Fatalf("failure %d: status = %d, want %d", i+1, code, http.StatusUnauthorized)
+		}
+	}
+	if code := get(r, "192.0.2.1:1234", "guess"); code != http.StatusTooManyRequests {
+		t.Errorf("failure beyond the rule: status = %d, want %d", code, http.StatusTooManyRequests)
+	}
+	if code := get(r, "192.0.2.1:1234", "valid-key"); code != http.StatusTooManyRequests {
+		t.Errorf("valid key from a blocked client: status = %d, want %d", code, http.StatusTooManyRequests)
+	}
+
+	if code := get(r, "192.0.2.2:1234", "valid-key"); code != http.StatusOK {
+		t.Errorf("valid key from another client: status = %d, want %d", code, http.StatusOK)
+	}
+	if code := get(r, "192.0.2.1:1234", ""); code != http.StatusOK {
+		t.Errorf("anonymous request from the blocked client: status = %d, want %d", code, http.StatusOK)
+	}
+}
+
+func TestRateLimitKeyedByVerifiedAPIKey(t *testing.T) {
+	r := newAuthTestRouter(map[string]string{"first-key": "alice", "second-key": "alice"},
+		RateLimitRule{Requests: 10, Period: time.Minute}, RateLimitRule{Requests: 1, Period: time.Minute})
+
+	if code := get(r, "192.0.2.1:1234", "first-key"); code != http.StatusOK {
+		t.Fatalf("first request: status = %d, want %d", code, http.StatusOK)
+	}
+	if code := get(r, "192.0.2.1:1234", "first-key"); code != http.StatusTooManyRequests {
+		t.Errorf("second request with the same key: status = %d, want %d", code, http.StatusTooManyRequests)
+	}
+	if code := get(r, "192.0.2.1:1234", "second-key"); code != http.StatusOK {
+		t.Errorf("request with another key of the user: status = %d, want %d", code, http.StatusOK)
+	}
+	if code := get(r, "192.0.2.1:1234", ""); code != http.StatusOK {
+		t.Errorf("anonymous request from the same IP: status = %d, want %d", code, http.StatusOK)
+	}
+}
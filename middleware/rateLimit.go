@@ -0,0 +1,292 @@
+package middleware
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/fatah-illah/asset-finder/data/response"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+)
+
+// ContextUserKey is the gin context key holding the authenticated user, if any.
+const ContextUserKey = "user"
+
+// ContextAPIKeyKey is the gin context key holding the hex SHA-256 of the verified API key, if any.
+const ContextAPIKeyKey = "api_key"
+
+// AuthFailuresGroup is the group of the rule limiting the requests with an unknown
+// API key per client IP, a client exhausting it is blocked before its keys are checked
+const AuthFailuresGroup = "auth_failures"
+
+// RateLimitRule describes a token bucket: Requests tokens are refilled every Period
+// and at most Burst tokens can be accumulated. A rule with Requests <= 0 is unlimited.
+type RateLimitRule struct {
+	Requests int
+	Period   time.Duration
+	Burst    int
+}
+
+func (r RateLimitRule) capacity() int {
+	if r.Burst > 0 {
+		return r.Burst
+	}
+	return r.Requests
+}
+
+// policy formats the rule as a RateLimit-Policy header value
+func (r RateLimitRule) policy() string {
+	return strconv.Itoa(r.Requests) + ";w=" + strconv.Itoa(ceilSeconds(r.Period)) + ";burst=" + strconv.Itoa(r.capacity())
+}
+
+func (r RateLimitRule) ratePerSecond() float64 {
+	return float64(r.Requests) / r.Period.Seconds()
+}
+
+// RateLimitResult is the outcome of taking a token from a bucket
+type RateLimitResult struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	ResetAfter time.Duration
+	RetryAfter time.Duration
+}
+
+// RateLimitStore keeps the token buckets. The in-process MemoryRateLimitStore is used
+// by default; a shared store (e.g. Redis) can be plugged in for multiple replicas.
+type RateLimitStore interface {
+	Take(ctx context.Context, key string, rule RateLimitRule) (RateLimitResult, error)
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+	rule   RateLimitRule
+}
+
+// MemoryRateLimitStore is an in-process RateLimitStore
+type MemoryRateLimitStore struct {
+	mu            sync.Mutex
+	buckets       map[string]*tokenBucket
+	sweepInterval time.Duration
+	lastSweep     time.Time
+	now           func() time.Time
+}
+
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{
+		buckets:       make(map[string]*tokenBucket),
+		sweepInterval: time.Minute,
+		lastSweep:     time.Now(),
+		now:           time.Now,
+	}
+}
+
+// Take implements RateLimitStore
+func (s *MemoryRateLimitStore) Take(_ context.Context, key string, rule RateLimitRule) (RateLimitResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.sweep(now)
+
+	capacity := float64(rule.capacity())
+	rate := rule.ratePerSecond()
+
+	bucket, ok := s.buckets[key]
+	if !ok || bucket.rule != rule {
+		bucket = &tokenBucket{tokens: capacity, last: now, rule: rule}
+		s.buckets[key] = bucket
+	}
+
+	elapsed := now.Sub(bucket.last).Seconds()
+	bucket.tokens = math.Min(capacity, bucket.tokens+elapsed*rate)
+	bucket.last = now
+
+	result := RateLimitResult{Limit: rule.capacity()}
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = secondsToDuration((1 - bucket.tokens) / rate)
+	}
+
+	result.Remaining = int(math.Floor(bucket.tokens))
+	result.ResetAfter = secondsToDuration((capacity - bucket.tokens) / rate)
+
+	return result, nil
+}
+
+// sweep drops buckets that have been idle long enough to be full again
+func (s *MemoryRateLimitStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < s.sweepInterval {
+		return
+	}
+	s.lastSweep = now
+
+	for key, bucket := range s.buckets {
+		refill := now.Sub(bucket.last).Seconds() * bucket.rule.ratePerSecond()
+		if bucket.tokens+refill >= float64(bucket.rule.capacity()) {
+			delete(s.buckets, key)
+		}
+	}
+}
+
+func secondsToDuration(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// RateLimiter applies per route group rules on top of a RateLimitStore
+type RateLimiter struct {
+	store RateLimitStore
+
+	mu          sync.RWMutex
+	defaultRule RateLimitRule
+	groupRules  map[string]RateLimitRule
+
+	// blocked holds when the clients that exhausted a failure rule may retry
+	blockedMu sync.Mutex
+	blocked   map[string]time.Time
+	now       func() time.Time
+}
+
+func NewRateLimiter(store RateLimitStore, defaultRule RateLimitRule, groupRules map[string]RateLimitRule) *RateLimiter {
+	return &RateLimiter{
+		store:       store,
+		defaultRule: defaultRule,
+		groupRules:  groupRules,
+		blocked:     make(map[string]time.Time),
+		now:         time.Now,
+	}
+}
+
+// Configure replaces the rules, buckets of a changed rule start over full
+func (rl *RateLimiter) Configure(defaultRule RateLimitRule, groupRules map[string]RateLimitRule) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	rl.defaultRule = defaultRule
+	rl.groupRules = groupRules
+}
+
+// Rule returns the rule configured for a route group, falling back to the default rule
+func (rl *RateLimiter) Rule(group string) RateLimitRule {
+	rl.mu.RLock()
+	defer rl.mu.RUnlock()
+
+	if rule, ok := rl.groupRules[group]; ok {
+		return rule
+	}
+	return rl.defaultRule
+}
+
+// Handler returns the middleware limiting requests of a route group
+func (rl *RateLimiter) Handler(group string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rule := rl.Rule(group)
+		if rule.Requests <= 0 || rule.Period <= 0 {
+			c.Next()
+			return
+		}
+
+		key := group + "|" + clientKey(c)
+		result, err := rl.store.Take(c.Request.Context(), key, rule)
+		if err != nil {
+			// fail open, an unavailable store must not take the API down
+			log.Warn().Err(err).Str("group", group).Msg("Rate limit store unavailable")
+			c.Next()
+			return
+		}
+
+		c.Header("RateLimit-Limit", strconv.Itoa(result.Limit))
+		c.Header("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		c.Header("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.ResetAfter)))
+		c.Header("RateLimit-Policy", rule.policy())
+
+		if !result.Allowed {
+			abortTooManyRequests(c, result.RetryAfter)
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// Blocked returns how long the client IP of the request is still blocked for having
+// exhausted the rule of group with failures, zero when it is not blocked
+func (rl *RateLimiter) Blocked(c *gin.Context, group string) time.Duration {
+	key := group + "|ip:" + c.ClientIP()
+
+	rl.blockedMu.Lock()
+	defer rl.blockedMu.Unlock()
+
+	until, ok := rl.blocked[key]
+	if !ok {
+		return 0
+	}
+	if retryAfter := until.Sub(rl.now()); retryAfter > 0 {
+		return retryAfter
+	}
+	delete(rl.blocked, key)
+	return 0
+}
+
+// Fail counts a failure of the client IP of the request against the rule of group.
+// The client is blocked once the rule is exhausted, until a token is refilled, and
+// the duration of the block is returned.
+func (rl *RateLimiter) Fail(c *gin.Context, group string) time.Duration {
+	rule := rl.Rule(group)
+	if rule.Requests <= 0 || rule.Period <= 0 {
+		return 0
+	}
+
+	key := group + "|ip:" + c.ClientIP()
+	result, err := rl.store.Take(c.Request.Context(), key, rule)
+	if err != nil {
+		log.Warn().Err(err).Str("group", group).Msg("Rate limit store unavailable")
+		return 0
+	}
+	if result.Allowed {
+		return 0
+	}
+
+	rl.blockedMu.Lock()
+	defer rl.blockedMu.Unlock()
+
+	now := rl.now()
+	for blockedKey, until := range rl.blocked {
+		if !until.After(now) {
+			delete(rl.blocked, blockedKey)
+		}
+	}
+	rl.blocked[key] = now.Add(result.RetryAfter)
+
+	return result.RetryAfter
+}
+
+func abortTooManyRequests(c *gin.Context, retryAfter time.Duration) {
+	c.Header("Retry-After", strconv.Itoa(ceilSeconds(retryAfter)))
+	webResponse := response.NewErrorResponse(http.StatusTooManyRequests, "Too many requests, please retry later")
+	c.AbortWithStatusJSON(http.StatusTooManyRequests, webResponse)
+}
+
+// clientKey identifies the caller by verified API key, then authenticated user,
+// then client IP. Unverified keys are rejected before, they never get a bucket.
+func clientKey(c *gin.Context) string {
+	if apiKey := c.GetString(ContextAPIKeyKey); apiKey != "" {
+		return "key:" + apiKey
+	}
+	if user := c.GetString(ContextUserKey); user != "" {
+		return "user:" + user
+	}
+
+	return "ip:" + c.ClientIP()
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
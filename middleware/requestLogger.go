@@ -0,0 +1,128 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"runtime/debug"
+	"time"
+
+	"github.com/fatah-illah/asset-finder/data/response"
+	"github.com/fatah-illah/asset-finder/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// RequestIDHeader carries the request id from the client and back in the response
+	RequestIDHeader = "X-Request-ID"
+
+	// ContextRequestIDKey is the gin context key holding the request id
+	ContextRequestIDKey = "request_id"
+
+	maxRequestIDLength = 128
+)
+
+// RequestLogger assigns or propagates the request id, attaches a request-scoped
+// zerolog logger to the request context and logs every request once it completes.
+func RequestLogger() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		requestID := c.GetHeader(RequestIDHeader)
+		if !validRequestID(requestID) {
+			requestID = newRequestID()
+		}
+
+		c.Set(ContextRequestIDKey, requestID)
+		c.Header(RequestIDHeader, requestID)
+
+		loggerContext := log.With().Str("request_id", requestID)
+		if spanContext := trace.SpanContextFromContext(c.Request.Context()); spanContext.IsValid() {
+			loggerContext = loggerContext.Str("trace_id", spanContext.TraceID().String())
+		}
+
+		logger := loggerContext.Logger()
+		c.Request = c.Request.WithContext(logger.WithContext(c.Request.Context()))
+
+		c.Next()
+
+		status := c.Writer.Status()
+
+		var event *zerolog.Event
+		switch {
+		case status >= http.StatusInternalServerError:
+			event = logger.Error()
+		case status >= http.StatusBadRequest:
+			event = logger.Warn()
+		default:
+			event = logger.Info()
+		}
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+
+		event = event.
+			Str("method", c.Request.Method).
+			Str("route", route).
+			Str("path", c.Request.URL.Path).
+			Int("status", status).
+			Dur("latency", time.Since(start)).
+			Int("bytes", max(c.Writer.Size(), 0)).
+			Str("client_ip", c.ClientIP())
+
+		if user := c.GetString(ContextUserKey); user != "" {
+			event = event.Str("user", user)
+		}
+
+		if len(c.Errors) > 0 {
+			event = event.Str("errors", c.Errors.String())
+		}
+
+		event.Msg("Request completed")
+	}
+}
+
+// Recovery turns a panic into a 500 response and logs it through the request logger
+func Recovery() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				utils.Logger(c.Request.Context()).Error().
+					Interface("panic", recovered).
+					Str("stack", string(debug.Stack())).
+					Msg("Recovered from panic")
+
+				webResponse := response.NewErrorResponse(http.StatusInternalServerError, "Internal server error")
+				c.AbortWithStatusJSON(http.StatusInternalServerError, webResponse)
+			}
+		}()
+
+		c.Next()
+	}
+}
+
+func validRequestID(requestID string) bool {
+	if requestID == "" || len(requestID) > maxRequestIDLength {
+		return false
+	}
+
+	for _, r := range requestID {
+		if r < 0x21 || r > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return hex.EncodeToString([]byte(time.Now().Format(time.RFC3339Nano)))
+	}
+	return hex.EncodeToString(buf)
+}
@@ -0,0 +1,92 @@
+package migrations
+
+import (
+	"context"
+	"errors"
+
+	"github.com/fatah-illah/asset-finder/models"
+	"github.com/fatah-illah/asset-finder/storage"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+)
+
+type legacyAttachment struct {
+	ID          uint
+	StorageKey  string
+	ContentType string
+	Size        int64
+}
+
+// dedupeAttachments hashes the content of the attachments stored under their
+// own key, they become blobs shared by the attachments with the same SHA-256.
+// The contents duplicated before are no longer referenced, they are logged to
+// be deleted from the blob store by hand.
+func dedupeAttachments(tx *gorm.DB, opts Options) error {
+	if !tx.Migrator().HasColumn(&models.Attachment{}, "storage_key") {
+		return nil
+	}
+
+	var attachments []legacyAttachment
+	err := tx.Table("attachments").Select("id", "storage_key", "content_type", "size").
+		Where("sha256 IS NULL OR sha256 = ''").Order("id").Find(&attachments).Error
+	if err != nil {
+		return err
+	}
+
+	var duplicates, missing []string
+
+	for _, attachment := range attachments {
+		hash, err := hashBlob(opts.Blobs, attachment.StorageKey)
+		if errors.Is(err, storage.ErrNotFound) {
+			missing = append(missing, attachment.StorageKey)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		referenced := tx.Model(&models.Blob{}).Where("sha256 = ?", hash).UpdateColumn("ref_count", gorm.Expr("ref_count + 1"))
+		if referenced.Error != nil {
+			return referenced.Error
+		}
+
+		if referenced.RowsAffected > 0 {
+			duplicates = append(duplicates, attachment.StorageKey)
+		} else {
+			blob := models.Blob{
+				SHA256:      hash,
+				Size:        attachment.Size,
+				ContentType: attachment.ContentType,
+				StorageKey:  attachment.StorageKey,
+				RefCount:    1,
+			}
+			if err := tx.Create(&blob).Error; err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Table("attachments").Where("id = ?", attachment.ID).Update("sha256", hash).Error; err != nil {
+			return err
+		}
+	}
+
+	if len(missing) > 0 {
+		log.Warn().Strs("keys", missing).Msg("Attachment contents not found in the blob store")
+	}
+	if len(duplicates) > 0 {
+		log.Warn().Strs("keys", duplicates).Msg("Duplicated attachment contents are no longer referenced, they can be deleted from the blob store")
+	}
+	log.Info().Int("attachments", len(attachments)).Int("duplicates", len(duplicates)).Msg("Attachment contents deduplicated")
+
+	return tx.Migrator().DropColumn(&models.Attachment{}, "storage_key")
+}
+
+func hashBlob(store storage.BlobStore, key string) (string, error) {
+	blob, err := store.Get(context.Background(), key)
+	if err != nil {
+		return "", err
+	}
+	defer blob.Close()
+
+	return storage.Hash(blob)
+}
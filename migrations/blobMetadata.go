@@ -0,0 +1,76 @@
+package migrations
+
+import (
+	"context"
+	"errors"
+
+	"github.com/fatah-illah/asset-finder/metadata"
+	"github.com/fatah-illah/asset-finder/models"
+	"github.com/fatah-illah/asset-finder/storage"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+)
+
+// extractBlobMetadata detects again the content type of the stored blobs, with
+// the content sniffing of the metadata package, and extracts their metadata
+func extractBlobMetadata(tx *gorm.DB, opts Options) error {
+	var blobs []models.Blob
+	if err := tx.Order("sha256").Find(&blobs).Error; err != nil {
+		return err
+	}
+
+	var missing []string
+
+	for _, blob := range blobs {
+		contentType, values, err := readBlobMetadata(opts.Blobs, blob)
+		if errors.Is(err, storage.ErrNotFound) {
+			missing = append(missing, blob.StorageKey)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		if contentType != blob.ContentType {
+			if err := tx.Model(&blob).Update("content_type", contentType).Error; err != nil {
+				return err
+			}
+			err := tx.Model(&models.Attachment{}).Where("sha256 = ?", blob.SHA256).Update("content_type", contentType).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Where("sha256 = ?", blob.SHA256).Delete(&models.BlobMetadata{}).Error; err != nil {
+			return err
+		}
+		if rows := models.NewBlobMetadata(blob.SHA256, values); len(rows) > 0 {
+			if err := tx.Create(&rows).Error; err != nil {
+				return err
+			}
+		}
+	}
+
+	if len(missing) > 0 {
+		log.Warn().Strs("keys", missing).Msg("Attachment contents not found in the blob store")
+	}
+	log.Info().Int("blobs", len(blobs)).Msg("Attachment metadata extracted")
+
+	return nil
+}
+
+func readBlobMetadata(store storage.BlobStore, blob models.Blob) (string, map[string]string, error) {
+	content, err := store.Get(context.Background(), blob.StorageKey)
+	if err != nil {
+		return "", nil, err
+	}
+	defer content.Close()
+
+	contentType, err := metadata.Detect(content)
+	if err != nil {
+		return "", nil, err
+	}
+
+	values, err := metadata.Extract(content, content.Size(), contentType)
+	return contentType, values, err
+}
@@ -0,0 +1,97 @@
+package migrations
+
+import (
+	"context"
+	"time"
+
+	"github.com/fatah-illah/asset-finder/storage"
+	"github.com/fatah-illah/asset-finder/utils"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+)
+
+// advisoryLockKey serializes migrations between replicas starting at the same time
+const advisoryLockKey = 7_236_419_501
+
+// Migration is a versioned schema or data change applied once, after AutoMigrate
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(tx *gorm.DB, opts Options) error
+}
+
+// Options carries the settings some migrations depend on
+type Options struct {
+	TagNormalizer utils.TagNormalizer
+	Blobs         storage.BlobStore
+}
+
+// SchemaMigration records an applied migration
+type SchemaMigration struct {
+	Version   int `gorm:"primaryKey;autoIncrement:false"`
+	Name      string
+	AppliedAt time.Time
+}
+
+var all = []Migration{
+	{Version: 1, Name: "baseline", Up: func(tx *gorm.DB, opts Options) error { return nil }},
+	{Version: 2, Name: "tag_normalization", Up: normalizeTags},
+	{Version: 3, Name: "tag_suggest_indexes", Up: indexTagSuggestions},
+	{Version: 4, Name: "tag_namespaces", Up: splitTagNamespaces},
+	{Version: 5, Name: "attachment_blobs", Up: dedupeAttachments},
+	{Version: 6, Name: "blob_metadata", Up: extractBlobMetadata},
+	{Version: 7, Name: "post_metadata_index", Up: indexPostMetadata},
+	{Version: 8, Name: "post_status", Up: publishExistingPosts},
+	{Version: 9, Name: "unique_tag_aliases", Up: uniqueTagAliases},
+}
+
+// Latest returns the schema version this build expects
+func Latest() int {
+	return all[len(all)-1].Version
+}
+
+// Current returns the highest applied schema version
+func Current(ctx context.Context, db *gorm.DB) (int, error) {
+	var version int
+	err := db.WithContext(ctx).Model(&SchemaMigration{}).Select("COALESCE(MAX(version), 0)").Scan(&version).Error
+	return version, err
+}
+
+// Run applies the pending migrations in a single transaction
+func Run(db *gorm.DB, opts Options) error {
+	if err := db.AutoMigrate(&SchemaMigration{}); err != nil {
+		return err
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if tx.Dialector.Name() == "postgres" {
+			if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", advisoryLockKey).Error; err != nil {
+				return err
+			}
+		}
+
+		current, err := Current(context.Background(), tx)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range all {
+			if migration.Version <= current {
+				continue
+			}
+
+			log.Info().Int("version", migration.Version).Str("name", migration.Name).Msg("Applying migration")
+
+			if err := migration.Up(tx, opts); err != nil {
+				return err
+			}
+
+			applied := SchemaMigration{Version: migration.Version, Name: migration.Name, AppliedAt: time.Now()}
+			if err := tx.Create(&applied).Error; err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,13 @@
+package migrations
+
+import "gorm.io/gorm"
+
+// indexPostMetadata adds the GIN index behind the meta.<key>=<value> post filters
+// on Postgres, jsonb_path_ops keeps it small as the filters only use containment
+func indexPostMetadata(tx *gorm.DB, _ Options) error {
+	if tx.Dialector.Name() != "postgres" {
+		return nil
+	}
+
+	return tx.Exec("CREATE INDEX IF NOT EXISTS idx_posts_metadata ON posts USING gin (metadata jsonb_path_ops)").Error
+}
@@ -0,0 +1,13 @@
+package migrations
+
+import (
+	"github.com/fatah-illah/asset-finder/models"
+	"github.com/fatah-illah/asset-finder/workflow"
+	"gorm.io/gorm"
+)
+
+// publishExistingPosts publishes the posts created before the publication
+// workflow, they were all live, the new posts start as drafts
+func publishExistingPosts(tx *gorm.DB, _ Options) error {
+	return tx.Model(&models.Post{}).Where("1 = 1").Update("status", workflow.StatusPublished).Error
+}
@@ -0,0 +1,55 @@
+package migrations
+
+import (
+	"fmt"
+
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+)
+
+// uniqueTagAliases makes the normalized aliases unique: the first alias of a
+// normalized alias keeps it, the next ones are suffixed with #<id> like the tags
+// in normalizeTags. The plain index created by AutoMigrate is replaced by a
+// unique one.
+func uniqueTagAliases(tx *gorm.DB, _ Options) error {
+	var aliases []struct {
+		ID              uint
+		Alias           string
+		NormalizedAlias string
+		TagID           uint
+	}
+	duplicated := tx.Table("tag_aliases").Select("normalized_alias").Group("normalized_alias").Having("COUNT(*) > 1")
+	err := tx.Table("tag_aliases").Select("id", "alias", "normalized_alias", "tag_id").
+		Where("normalized_alias IN (?)", duplicated).Order("normalized_alias, id").Find(&aliases).Error
+	if err != nil {
+		return err
+	}
+
+	kept := make(map[string]uint, len(aliases))
+	for _, alias := range aliases {
+		keptID, ok := kept[alias.NormalizedAlias]
+		if !ok {
+			kept[alias.NormalizedAlias] = alias.ID
+			continue
+		}
+
+		log.Warn().Uint("alias_id", alias.ID).Str("alias", alias.Alias).Uint("tag_id", alias.TagID).Uint("kept_alias_id", keptID).
+			Msg("Tag alias shares its normalized alias with another alias, it no longer resolves")
+		err := tx.Table("tag_aliases").Where("id = ?", alias.ID).
+			Update("normalized_alias", fmt.Sprintf("%s#%d", alias.NormalizedAlias, alias.ID)).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, statement := range []string{
+		"DROP INDEX IF EXISTS idx_tag_aliases_normalized_alias",
+		"CREATE UNIQUE INDEX idx_tag_aliases_normalized_alias ON tag_aliases (normalized_alias)",
+	} {
+		if err := tx.Exec(statement).Error; err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,52 @@
+package migrations
+
+import (
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+)
+
+// splitTagNamespaces fills in the namespace and value of the existing namespaced
+// tags, and their normalized labels now that the spaces around the separator
+// are dropped. The labels becoming the same are kept unique like in normalizeTags.
+func splitTagNamespaces(tx *gorm.DB, opts Options) error {
+	normalizer := opts.TagNormalizer
+
+	var tags []normalizationTag
+	if err := tx.Table("tags").Select("id", "label").Order("id").Find(&tags).Error; err != nil {
+		return err
+	}
+
+	// the normalized labels are swapped between tags, they are unique again at the end
+	if err := tx.Exec("DROP INDEX IF EXISTS idx_tags_normalized_label").Error; err != nil {
+		return err
+	}
+
+	storedKeys := uniqueTagKeys(tags, normalizer)
+	tagIDByKey := make(map[string]uint, len(tags))
+	namespaced := 0
+
+	for i, tag := range tags {
+		key := normalizer.Key(tag.Label)
+		if otherID, ok := tagIDByKey[key]; ok {
+			log.Warn().Str("normalized_label", key).Interface("tag_ids", []uint{otherID, tag.ID}).
+				Msgf("Tags share the same normalized label, merge them into tag %d", otherID)
+		} else {
+			tagIDByKey[key] = tag.ID
+		}
+
+		namespace, value := normalizer.Split(tag.Label)
+		if namespace != "" {
+			namespaced++
+		}
+
+		err := tx.Table("tags").Where("id = ?", tag.ID).
+			Updates(map[string]interface{}{"normalized_label": storedKeys[i], "namespace": namespace, "value": value}).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	log.Info().Int("tags", len(tags)).Int("namespaced", namespaced).Msg("Tag namespaces split")
+
+	return tx.Exec("CREATE UNIQUE INDEX idx_tags_normalized_label ON tags (normalized_label)").Error
+}
@@ -0,0 +1,169 @@
+package migrations
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/fatah-illah/asset-finder/utils"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+)
+
+type normalizationTag struct {
+	ID    uint
+	Label string
+}
+
+type normalizationAlias struct {
+	ID    uint
+	Alias string
+	TagID uint
+}
+
+// normalizeTags fills in the normalized labels and slugs of the existing tags and
+// aliases, then makes the normalized labels and the slugs unique. Tags whose labels
+// only differ by case or whitespace are kept as they are and reported, they can be
+// merged with POST /api/tags/{tagId}/merge. Until then the first one is found by
+// its label, the normalized labels of the others are suffixed with #<id>.
+func normalizeTags(tx *gorm.DB, opts Options) error {
+	normalizer := opts.TagNormalizer
+
+	var tags []normalizationTag
+	if err := tx.Table("tags").Select("id", "label").Order("id").Find(&tags).Error; err != nil {
+		return err
+	}
+
+	storedKeys := uniqueTagKeys(tags, normalizer)
+	tagsByKey := make(map[string][]normalizationTag)
+	tagIDByKey := make(map[string]uint)
+	usedSlugs := make(map[string]bool, len(tags))
+	slugCollisions := 0
+
+	for i, tag := range tags {
+		key := normalizer.Key(tag.Label)
+		tagsByKey[key] = append(tagsByKey[key], tag)
+		if _, ok := tagIDByKey[key]; !ok {
+			tagIDByKey[key] = tag.ID
+		}
+
+		base := utils.Slugify(normalizer.Label(tag.Label))
+		slug := base
+		for n := 2; usedSlugs[slug]; n++ {
+			slug = fmt.Sprintf("%s-%d", base, n)
+		}
+		usedSlugs[slug] = true
+
+		if slug != base {
+			slugCollisions++
+			log.Info().Uint("tag_id", tag.ID).Str("label", tag.Label).Str("slug", slug).
+				Msg("Tag slug already taken, suffixed")
+		}
+
+		err := tx.Table("tags").Where("id = ?", tag.ID).
+			Updates(map[string]interface{}{"normalized_label": storedKeys[i], "slug": slug}).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	keys := make([]string, 0, len(tagsByKey))
+	for key := range tagsByKey {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	labelCollisions := 0
+	for _, key := range keys {
+		colliding := tagsByKey[key]
+		if len(colliding) < 2 {
+			continue
+		}
+		labelCollisions++
+
+		ids := make([]uint, len(colliding))
+		labels := make([]string, len(colliding))
+		for i, tag := range colliding {
+			ids[i], labels[i] = tag.ID, tag.Label
+		}
+		log.Warn().Str("normalized_label", key).Interface("tag_ids", ids).Strs("labels", labels).
+			Msgf("Tags share the same normalized label, merge them into tag %d", ids[0])
+	}
+
+	var aliases []normalizationAlias
+	if err := tx.Table("tag_aliases").Select("id", "alias", "tag_id").Order("id").Find(&aliases).Error; err != nil {
+		return err
+	}
+
+	aliasCollisions := 0
+	aliasTagByKey := make(map[string]uint, len(aliases))
+	for _, alias := range aliases {
+		key := normalizer.Key(alias.Alias)
+
+		tagID, isLabel := tagIDByKey[key]
+		if !isLabel {
+			tagID, isLabel = aliasTagByKey[key]
+		}
+		if isLabel && tagID != alias.TagID {
+			aliasCollisions++
+			log.Warn().Uint("alias_id", alias.ID).Str("alias", alias.Alias).Uint("tag_id", alias.TagID).
+				Uint("conflicting_tag_id", tagID).Msg("Tag alias collides with the label or alias of another tag")
+		}
+		if _, ok := aliasTagByKey[key]; !ok {
+			aliasTagByKey[key] = alias.TagID
+		}
+
+		if err := tx.Table("tag_aliases").Where("id = ?", alias.ID).Update("normalized_alias", key).Error; err != nil {
+			return err
+		}
+	}
+
+	log.Info().
+		Int("tags", len(tags)).
+		Int("label_collisions", labelCollisions).
+		Int("slug_collisions", slugCollisions).
+		Int("alias_collisions", aliasCollisions).
+		Msg("Tag labels normalized")
+
+	// AutoMigrate created a plain index on the normalized labels, it is replaced
+	// by a unique one
+	for _, statement := range []string{
+		"DROP INDEX IF EXISTS idx_tags_normalized_label",
+		"CREATE UNIQUE INDEX IF NOT EXISTS idx_tags_normalized_label ON tags (normalized_label)",
+		"CREATE UNIQUE INDEX IF NOT EXISTS idx_tags_slug ON tags (slug)",
+	} {
+		if err := tx.Exec(statement).Error; err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// uniqueTagKeys returns the normalized labels to store for tags, in order. The
+// first tag of a normalized label keeps it, the labels of the next ones are
+// suffixed with #<id> so that the normalized labels can be unique.
+func uniqueTagKeys(tags []normalizationTag, normalizer utils.TagNormalizer) []string {
+	keys := make([]string, len(tags))
+	used := make(map[string]bool, len(tags))
+	for i, tag := range tags {
+		keys[i] = normalizer.Key(tag.Label)
+		used[keys[i]] = true
+	}
+
+	kept := make(map[string]bool, len(tags))
+	for i, tag := range tags {
+		key := keys[i]
+		if !kept[key] {
+			kept[key] = true
+			continue
+		}
+
+		keys[i] = fmt.Sprintf("%s#%d", key, tag.ID)
+		for n := 2; used[keys[i]]; n++ {
+			keys[i] = fmt.Sprintf("%s#%d-%d", key, tag.ID, n)
+		}
+		used[keys[i]] = true
+	}
+
+	return keys
+}
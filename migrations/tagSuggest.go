@@ -0,0 +1,38 @@
+package migrations
+
+import (
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+)
+
+// indexTagSuggestions adds the indexes behind the tag autocomplete on Postgres: a
+// pattern index for prefix matches and, when the pg_trgm extension can be
+// created, a trigram index for fuzzy matches. Without pg_trgm the autocomplete
+// falls back to substring matches.
+func indexTagSuggestions(tx *gorm.DB, _ Options) error {
+	if tx.Dialector.Name() != "postgres" {
+		return nil
+	}
+
+	err := tx.Exec("CREATE INDEX IF NOT EXISTS idx_tags_normalized_label_pattern ON tags (normalized_label text_pattern_ops)").Error
+	if err != nil {
+		return err
+	}
+
+	// creating an extension needs privileges the service may not have, a failure
+	// must not abort the other migrations of the transaction
+	if err := tx.SavePoint("pg_trgm").Error; err != nil {
+		return err
+	}
+
+	err = tx.Exec("CREATE EXTENSION IF NOT EXISTS pg_trgm").Error
+	if err == nil {
+		err = tx.Exec("CREATE INDEX IF NOT EXISTS idx_tags_normalized_label_trgm ON tags USING gin (normalized_label gin_trgm_ops)").Error
+	}
+	if err != nil {
+		log.Warn().Err(err).Msg("pg_trgm is not available, tag suggestions fall back to substring matches")
+		return tx.RollbackTo("pg_trgm").Error
+	}
+
+	return nil
+}
@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// AssetType is a kind of asset, such as laptop or licence, whose posts have
+// metadata matching the JSON Schema of its current version
+type AssetType struct {
+	ID             uint      `json:"id" gorm:"primaryKey"`
+	Name           string    `json:"name" gorm:"size:64;not null;uniqueIndex"`
+	Description    string    `json:"description" gorm:"size:1000"`
+	CurrentVersion int       `json:"current_version" gorm:"not null"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// AssetTypeSchema is a version of the JSON Schema of an asset type, versions
+// are never modified so that any of them can be made current again
+type AssetTypeSchema struct {
+	AssetTypeID uint      `gorm:"primaryKey;autoIncrement:false"`
+	AssetType   AssetType `gorm:"constraint:OnDelete:CASCADE"`
+	Version     int       `gorm:"primaryKey;autoIncrement:false"`
+	Schema      string    `gorm:"type:text;not null"`
+	CreatedAt   time.Time
+}
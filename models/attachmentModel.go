@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// Attachment is a file uploaded to a post, its content is the blob with the
+// same SHA-256
+type Attachment struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	PostID      uint      `json:"post_id" gorm:"index"`
+	Post        Post      `json:"-" gorm:"constraint:OnDelete:CASCADE"`
+	FileName    string    `json:"file_name"`
+	ContentType string    `json:"content_type"`
+	Size        int64     `json:"size"`
+	SHA256      string    `json:"sha256" gorm:"size:64;index"`
+	CreatedAt   time.Time `json:"created_at"`
+	// Metadata is extracted from the content, see the metadata package for the keys
+	Metadata map[string]string `json:"metadata,omitempty" gorm:"-"`
+}
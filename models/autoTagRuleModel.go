@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// AutoTagRule adds its tags to the posts whose title or content matches its
+// pattern, the rules with the highest priority are applied first
+type AutoTagRule struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	Name      string    `json:"name" gorm:"size:255"`
+	Field     string    `json:"field" gorm:"size:16;not null"`
+	MatchType string    `json:"match_type" gorm:"size:16;not null"`
+	Pattern   string    `json:"pattern" gorm:"not null"`
+	Priority  int       `json:"priority" gorm:"not null;index"`
+	Enabled   bool      `json:"enabled" gorm:"not null"`
+	Tags      []Tag     `json:"tags" gorm:"many2many:auto_tag_rule_tags;constraint:OnDelete:CASCADE"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// Statuses of an AutoTagRun
+const (
+	AutoTagRunQueued    = "queued"
+	AutoTagRunRunning   = "running"
+	AutoTagRunCompleted = "completed"
+	AutoTagRunFailed    = "failed"
+)
+
+// AutoTagRun is a re-application of the auto-tagging rules to every post, run in
+// the background and committed batch by batch. The counts grow with each batch.
+type AutoTagRun struct {
+	ID          uint       `json:"id" gorm:"primaryKey"`
+	Status      string     `json:"status" gorm:"size:16;not null;index"`
+	Posts       int64      `json:"posts" gorm:"not null;default:0"`
+	AddedTags   int64      `json:"added_tags" gorm:"not null;default:0"`
+	RemovedTags int64      `json:"removed_tags" gorm:"not null;default:0"`
+	Error       string     `json:"error,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	FinishedAt  *time.Time `json:"finished_at"`
+}
@@ -0,0 +1,25 @@
+package models
+
+import "sort"
+
+// BlobMetadata is a value extracted from a blob content, such as the width of
+// an image or the page count of a PDF
+type BlobMetadata struct {
+	SHA256 string `json:"-" gorm:"primaryKey;size:64"`
+	Key    string `json:"key" gorm:"primaryKey;size:64;index:idx_blob_metadata_key_value,priority:1"`
+	Value  string `json:"value" gorm:"index:idx_blob_metadata_key_value,priority:2"`
+}
+
+func (BlobMetadata) TableName() string {
+	return "blob_metadata"
+}
+
+// NewBlobMetadata returns the rows of the metadata extracted from a blob content
+func NewBlobMetadata(sha256 string, values map[string]string) []BlobMetadata {
+	rows := make([]BlobMetadata, 0, len(values))
+	for key, value := range values {
+		rows = append(rows, BlobMetadata{SHA256: sha256, Key: key, Value: value})
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].Key < rows[j].Key })
+	return rows
+}
@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// Blob is a stored file content shared by the attachments with the same SHA-256,
+// it is deleted from the blob store with its last attachment
+type Blob struct {
+	SHA256      string    `json:"sha256" gorm:"primaryKey;size:64"`
+	Size        int64     `json:"size"`
+	ContentType string    `json:"content_type"`
+	StorageKey  string    `json:"-"`
+	RefCount    int64     `json:"ref_count" gorm:"not null;default:0"`
+	CreatedAt   time.Time `json:"created_at"`
+}
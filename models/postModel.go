@@ -1,8 +1,63 @@
 package models
 
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
 type Post struct {
-	ID      uint   `gorm:"primaryKey"`
-	Title   string `json:"title"`
-	Content string `json:"content"`
-	Tags    []Tag  `gorm:"many2many:post_tags;"`
+	ID          uint         `gorm:"primaryKey"`
+	Title       string       `json:"title"`
+	Content     string       `json:"content"`
+	AssetTypeID *uint        `gorm:"index" json:"asset_type_id"`
+	AssetType   *AssetType   `gorm:"constraint:OnDelete:RESTRICT" json:"-"`
+	Metadata    PostMetadata `gorm:"not null;default:'{}'" json:"metadata"`
+	Status      string       `gorm:"size:16;not null;default:draft;index" json:"status"`
+	PublishAt   *time.Time   `gorm:"index" json:"publish_at"`
+	UnpublishAt *time.Time   `gorm:"index" json:"unpublish_at"`
+	Tags        []Tag        `gorm:"many2many:post_tags;"`
+}
+
+// PostMetadata holds the free-form attributes of a post, such as a serial number
+// or a vendor, stored as JSONB on Postgres and as JSON text elsewhere
+type PostMetadata map[string]interface{}
+
+func (PostMetadata) GormDataType() string {
+	return "json"
+}
+
+func (PostMetadata) GormDBDataType(db *gorm.DB, _ *schema.Field) string {
+	if db.Dialector.Name() == "postgres" {
+		return "JSONB"
+	}
+	return "JSON"
+}
+
+func (m PostMetadata) Value() (driver.Value, error) {
+	if m == nil {
+		return "{}", nil
+	}
+	out, err := json.Marshal(map[string]interface{}(m))
+	return string(out), err
+}
+
+func (m *PostMetadata) Scan(value interface{}) error {
+	var data []byte
+	switch v := value.(type) {
+	case nil:
+		*m = nil
+		return nil
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return fmt.Errorf("unsupported post metadata type %T", value)
+	}
+	return json.Unmarshal(data, m)
 }
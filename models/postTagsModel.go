@@ -1,10 +1,28 @@
 package models
 
-import "gorm.io/gorm"
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Sources of the tags of a post
+const (
+	TagSourceManual     = "manual"
+	TagSourceAuto       = "auto"
+	TagSourceAttachment = "attachment"
+)
 
 type PostTag struct {
 	TagID  uint `gorm:"primaryKey"`
 	PostID uint `gorm:"primaryKey"`
+	// CreatedAt is when the tag was put on the post, it is null for the
+	// associations created before it was recorded
+	CreatedAt time.Time `gorm:"index"`
+	// Source tells whether the tag was put by a user, by an auto-tagging rule or
+	// from the type of an attachment. The auto tags are removed when their rules
+	// no longer match.
+	Source string `gorm:"size:16;not null;default:manual"`
 
 	Post Post `gorm:"foreignKey:PostID"`
 	Tag  Tag  `gorm:"foreignKey:TagID"`
@@ -14,6 +32,15 @@ func (PostTag) TableName() string {
 	return "post_tags"
 }
 
+// SetupJoinTables makes GORM save the post and tag associations as PostTag rows,
+// so that their CreatedAt is filled in
+func SetupJoinTables(db *gorm.DB) error {
+	if err := db.SetupJoinTable(&Post{}, "Tags", &PostTag{}); err != nil {
+		return err
+	}
+	return db.SetupJoinTable(&Tag{}, "Posts", &PostTag{})
+}
+
 func AutoMigratePostTag(db *gorm.DB) {
 	err := db.AutoMigrate(&PostTag{})
 	if err != nil {
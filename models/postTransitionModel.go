@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// PostTransition records a change of the publication status of a post
+type PostTransition struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	PostID     uint      `json:"post_id" gorm:"not null;index"`
+	Post       Post      `json:"-" gorm:"constraint:OnDelete:CASCADE"`
+	Transition string    `json:"transition" gorm:"size:16;not null"`
+	FromStatus string    `json:"from_status" gorm:"size:16;not null"`
+	ToStatus   string    `json:"to_status" gorm:"size:16;not null"`
+	Actor      string    `json:"actor" gorm:"size:255;not null"`
+	Role       string    `json:"role" gorm:"size:16"`
+	Comment    string    `json:"comment" gorm:"size:1000"`
+	CreatedAt  time.Time `json:"created_at"`
+}
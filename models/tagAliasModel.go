@@ -0,0 +1,10 @@
+package models
+
+type TagAlias struct {
+	ID    uint   `json:"id" gorm:"primaryKey"`
+	Alias string `json:"alias" gorm:"uniqueIndex"`
+	// NormalizedAlias is unique, the index is created by the unique_tag_aliases migration
+	NormalizedAlias string `json:"-"`
+	TagID           uint   `json:"tag_id" gorm:"index"`
+	Tag             Tag    `json:"-" gorm:"constraint:OnDelete:CASCADE"`
+}
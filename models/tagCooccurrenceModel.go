@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// TagCooccurrence is a snapshot of how often two tags are used on the same posts,
+// refreshed periodically. Every pair is stored in both directions.
+type TagCooccurrence struct {
+	TagID        uint      `json:"tag_id" gorm:"primaryKey;autoIncrement:false"`
+	RelatedTagID uint      `json:"related_tag_id" gorm:"primaryKey;autoIncrement:false"`
+	Support      int64     `json:"support"`
+	Lift         float64   `json:"lift"`
+	RefreshedAt  time.Time `json:"refreshed_at"`
+}
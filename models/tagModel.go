@@ -3,5 +3,25 @@ package models
 type Tag struct {
 	ID    uint   `gorm:"primaryKey"`
 	Label string `json:"label" gorm:"unique"`
+	// NormalizedLabel and Slug are unique, the indexes are created by the
+	// tag_normalization migration once the existing tags are filled in
+	NormalizedLabel string `json:"-"`
+	Slug            string `json:"slug" gorm:"size:255"`
+	// Namespace and Value split namespaced labels such as env:prod, the
+	// namespace is normalized like the label
+	Namespace string `json:"namespace" gorm:"index"`
+	Value     string `json:"value"`
+	ParentID  *uint  `json:"parent_id" gorm:"index"`
+	Parent    *Tag   `json:"-" gorm:"constraint:OnDelete:SET NULL"`
+
+	Description string `json:"description"`
+	Color       string `json:"color" gorm:"size:7"`
+	Icon        string `json:"icon" gorm:"size:64"`
+	// Deprecated tags keep their posts but cannot be put on new ones, the
+	// replacement tag is suggested instead
+	Deprecated       bool  `json:"deprecated" gorm:"not null;default:false"`
+	ReplacementTagID *uint `json:"replacement_tag_id"`
+	ReplacementTag   *Tag  `json:"-" gorm:"constraint:OnDelete:SET NULL"`
+
 	Posts []Post `gorm:"many2many:post_tags;"`
 }
@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// Thumbnail is a downscaled copy of an image blob fitting in a Size x Size box.
+// A thumbnail with an Error could not be generated, it has no content and is not
+// generated again.
+type Thumbnail struct {
+	SHA256      string    `json:"sha256" gorm:"primaryKey;size:64"`
+	Size        int       `json:"size" gorm:"primaryKey;autoIncrement:false"`
+	Width       int       `json:"width"`
+	Height      int       `json:"height"`
+	ContentType string    `json:"content_type"`
+	StorageKey  string    `json:"-"`
+	Error       string    `json:"error,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
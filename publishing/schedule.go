@@ -0,0 +1,111 @@
+// Package publishing applies the scheduled publication changes of the posts.
+package publishing
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/fatah-illah/asset-finder/models"
+	"github.com/fatah-illah/asset-finder/utils"
+	"github.com/fatah-illah/asset-finder/workflow"
+	"gorm.io/gorm"
+)
+
+// Actor records the scheduler as the author of the transitions it applies
+const Actor = "scheduler"
+
+// batchSize is the number of posts changed per transaction, the posts being
+// locked until it commits
+const batchSize = 100
+
+// schedule is a scheduled transition and the column holding its time
+type schedule struct {
+	transition workflow.Transition
+	column     string
+}
+
+func schedules() []schedule {
+	publish, _ := workflow.Lookup(workflow.TransitionPublish)
+	unpublish, _ := workflow.Lookup(workflow.TransitionUnpublish)
+
+	// published first so that a post whose both times are due ends up archived
+	return []schedule{{transition: publish, column: "publish_at"}, {transition: unpublish, column: "unpublish_at"}}
+}
+
+// ApplySchedule publishes the posts whose publish_at is due and archives the
+// published posts whose unpublish_at is due, clearing the applied times. The due
+// posts are locked with SKIP LOCKED on Postgres so that replicas running the
+// scheduler at the same time share them rather than apply them twice. It returns
+// the number of changed posts per transition.
+func ApplySchedule(ctx context.Context, db *gorm.DB, now time.Time) (map[string]int, error) {
+	applied := make(map[string]int)
+
+	for _, s := range schedules() {
+		for {
+			if err := ctx.Err(); err != nil {
+				return applied, err
+			}
+
+			changed, err := applyBatch(db.WithContext(ctx), s, now)
+			if err != nil {
+				return applied, err
+			}
+			applied[s.transition.Name] += changed
+
+			if changed < batchSize {
+				break
+			}
+		}
+	}
+
+	if applied[workflow.TransitionPublish] > 0 || applied[workflow.TransitionUnpublish] > 0 {
+		utils.Logger(ctx).Info().
+			Int("published", applied[workflow.TransitionPublish]).
+			Int("unpublished", applied[workflow.TransitionUnpublish]).
+			Msg("Scheduled publication changes applied")
+	}
+
+	return applied, nil
+}
+
+func applyBatch(db *gorm.DB, s schedule, now time.Time) (int, error) {
+	var posts []models.Post
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		err := utils.ForUpdateSkipLocked(tx).Select("id", "status", s.column).
+			Where("status IN ? AND "+s.column+" <= ?", s.transition.From, now).
+			Order(s.column + ", id").Limit(batchSize).Find(&posts).Error
+		if err != nil {
+			return err
+		}
+
+		for _, post := range posts {
+			due := post.PublishAt
+			if s.column == "unpublish_at" {
+				due = post.UnpublishAt
+			}
+
+			record := models.PostTransition{
+				PostID:     post.ID,
+				Transition: s.transition.Name,
+				FromStatus: post.Status,
+				ToStatus:   s.transition.To,
+				Actor:      Actor,
+				Comment:    fmt.Sprintf("Scheduled at %s", due.Format(time.RFC3339)),
+			}
+
+			err := tx.Model(&post).Updates(map[string]interface{}{"status": s.transition.To, s.column: nil}).Error
+			if err != nil {
+				return err
+			}
+			if err := tx.Create(&record).Error; err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	return len(posts), err
+}
@@ -0,0 +1,26 @@
+package server
+
+import (
+	"github.com/fatah-illah/asset-finder/config"
+	"github.com/fatah-illah/asset-finder/middleware"
+	"github.com/rs/zerolog/log"
+)
+
+func InitAuthenticator(conf *config.Config, rateLimiter *middleware.RateLimiter) *middleware.Authenticator {
+	authenticator := middleware.NewAuthenticator("", nil, rateLimiter)
+	ConfigureAuthenticator(authenticator, conf.Auth)
+
+	return authenticator
+}
+
+// ConfigureAuthenticator applies the auth section, at startup and on reload
+func ConfigureAuthenticator(authenticator *middleware.Authenticator, conf config.AuthConfig) {
+	keys := make(map[string]middleware.APIKey, len(conf.Keys))
+	for user, key := range conf.Keys {
+		keys[key.KeySHA256] = middleware.APIKey{User: user, Role: key.Role}
+	}
+
+	log.Info().Str("header", conf.KeyHeader).Int("keys", len(keys)).Msg("API key authentication configured")
+
+	authenticator.Configure(conf.KeyHeader, keys)
+}
@@ -0,0 +1,23 @@
+package server
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/fatah-illah/asset-finder/config"
+	"github.com/fatah-illah/asset-finder/controllers"
+	"github.com/fatah-illah/asset-finder/jobs"
+	"gorm.io/gorm"
+)
+
+// InitAutoTagPool creates the worker applying the auto-tagging rules to all posts
+// for the queued runs, it is started and stopped with the HttpServer
+func InitAutoTagPool(conf *config.Config, db *gorm.DB) *jobs.Pool {
+	return jobs.NewPool("auto_tag_runs", 1, 1, func(ctx context.Context, item string) error {
+		runID, err := strconv.ParseUint(item, 10, 64)
+		if err != nil {
+			return err
+		}
+		return controllers.RunAutoTagRules(ctx, db, conf.Tags.Namespaces, uint(runID))
+	})
+}
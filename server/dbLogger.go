@@ -0,0 +1,85 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/fatah-illah/asset-finder/utils"
+	"github.com/rs/zerolog"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// dbLogger sends GORM logs through zerolog, using the request-scoped logger
+// from the query context so SQL logs carry the same request id.
+type dbLogger struct {
+	level         logger.LogLevel
+	slowThreshold time.Duration
+}
+
+func newDBLogger(slowThreshold time.Duration) *dbLogger {
+	return &dbLogger{
+		level:         logger.Info,
+		slowThreshold: slowThreshold,
+	}
+}
+
+// LogMode implements logger.Interface
+func (l *dbLogger) LogMode(level logger.LogLevel) logger.Interface {
+	newLogger := *l
+	newLogger.level = level
+	return &newLogger
+}
+
+// Info implements logger.Interface
+func (l *dbLogger) Info(ctx context.Context, msg string, data ...interface{}) {
+	if l.level >= logger.Info {
+		utils.Logger(ctx).Info().Str("component", "gorm").Msgf(msg, data...)
+	}
+}
+
+// Warn implements logger.Interface
+func (l *dbLogger) Warn(ctx context.Context, msg string, data ...interface{}) {
+	if l.level >= logger.Warn {
+		utils.Logger(ctx).Warn().Str("component", "gorm").Msgf(msg, data...)
+	}
+}
+
+// Error implements logger.Interface
+func (l *dbLogger) Error(ctx context.Context, msg string, data ...interface{}) {
+	if l.level >= logger.Error {
+		utils.Logger(ctx).Error().Str("component", "gorm").Msgf(msg, data...)
+	}
+}
+
+// Trace implements logger.Interface
+func (l *dbLogger) Trace(ctx context.Context, begin time.Time, fc func() (sql string, rowsAffected int64), err error) {
+	if l.level <= logger.Silent {
+		return
+	}
+
+	elapsed := time.Since(begin)
+	log := utils.Logger(ctx)
+
+	var event *zerolog.Event
+	switch {
+	case err != nil && !errors.Is(err, gorm.ErrRecordNotFound) && l.level >= logger.Error:
+		event = log.Error().Err(err)
+	case l.slowThreshold > 0 && elapsed > l.slowThreshold && l.level >= logger.Warn:
+		event = log.Warn().Str("slow_query", fmt.Sprintf(">= %v", l.slowThreshold))
+	case l.level >= logger.Info:
+		event = log.Debug()
+	default:
+		return
+	}
+
+	sql, rows := fc()
+	event.
+		Str("component", "gorm").
+		Str("sql", sql).
+		Int64("rows", rows).
+		Dur("elapsed", elapsed).
+		Msg("SQL query")
+}
@@ -1,27 +1,28 @@
 package server
 
 import (
-	"os"
-
+	"github.com/fatah-illah/asset-finder/config"
+	"github.com/fatah-illah/asset-finder/migrations"
 	"github.com/fatah-illah/asset-finder/models"
-	"github.com/rs/zerolog"
+	"github.com/fatah-illah/asset-finder/storage"
+	"github.com/fatah-illah/asset-finder/tracing"
 	"github.com/rs/zerolog/log"
-	"github.com/spf13/viper"
+	"go.opentelemetry.io/otel"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
 
-func InitDatabase(config *viper.Viper) *gorm.DB {
-	dsn := config.GetString("database.connection_string")
-
-	if dsn == "" {
-		log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr}).With().Caller().Logger()
-		log.Fatal().Msg("Database connection string is missing")
+func InitDatabase(conf *config.Config, blobStore storage.BlobStore) *gorm.DB {
+	db, err := gorm.Open(postgres.Open(conf.Database.ConnectionString), &gorm.Config{
+		Logger: newDBLogger(conf.Database.SlowQueryThreshold),
+	})
+	if err != nil {
+		log.Fatal().Err(err).Msg("Error while initializing database: %v")
 	}
 
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	err = db.Use(tracing.NewGormPlugin(otel.GetTracerProvider()))
 	if err != nil {
-		log.Fatal().Err(err).Msg("Error while initializing database: %v")
+		log.Fatal().Err(err).Msg("Error while instrumenting database")
 	}
 
 	sqlDB, err := db.DB()
@@ -29,13 +30,9 @@ func InitDatabase(config *viper.Viper) *gorm.DB {
 		log.Fatal().Err(err).Msg("Error getting underlying database: %v")
 	}
 
-	maxIdleConnections := config.GetInt("database.max_idle_connections")
-	maxOpenConnections := config.GetInt("database.max_open_connections")
-	connectionMaxLifetime := config.GetDuration("database.connection_max_lifetime")
-
-	sqlDB.SetMaxIdleConns(maxIdleConnections)
-	sqlDB.SetMaxOpenConns(maxOpenConnections)
-	sqlDB.SetConnMaxLifetime(connectionMaxLifetime)
+	sqlDB.SetMaxIdleConns(conf.Database.MaxIdleConnections)
+	sqlDB.SetMaxOpenConns(conf.Database.MaxOpenConnections)
+	sqlDB.SetConnMaxLifetime(conf.Database.ConnectionMaxLifetime)
 
 	err = sqlDB.Ping()
 	if err != nil {
@@ -46,12 +43,35 @@ func InitDatabase(config *viper.Viper) *gorm.DB {
 		log.Fatal().Err(err).Msg("Error while validating database: %v")
 	}
 
-	err = db.AutoMigrate(&models.Post{}, &models.Tag{})
+	err = models.SetupJoinTables(db)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Error while setting up join tables")
+	}
+
+	err = db.AutoMigrate(&models.Post{}, &models.Tag{}, &models.TagAlias{}, &models.TagCooccurrence{}, &models.AutoTagRule{}, &models.AutoTagRun{}, &models.AssetType{}, &models.AssetTypeSchema{}, &models.PostTransition{}, &models.Blob{}, &models.BlobMetadata{}, &models.Thumbnail{}, &models.Attachment{})
 	if err != nil {
 		log.Fatal().Err(err).Msg("Error while migrating database: %v")
 	}
 
 	models.AutoMigratePostTag(db)
 
+	err = migrations.Run(db, migrations.Options{TagNormalizer: InitTagNormalizer(conf), Blobs: blobStore})
+	if err != nil {
+		log.Fatal().Err(err).Msg("Error while running migrations")
+	}
+
 	return db
 }
+
+// CloseDatabase releases the connections of the pool
+func CloseDatabase(db *gorm.DB) {
+	sqlDB, err := db.DB()
+	if err != nil {
+		log.Warn().Err(err).Msg("Error getting underlying database")
+		return
+	}
+
+	if err := sqlDB.Close(); err != nil {
+		log.Warn().Err(err).Msg("Error while closing database connection")
+	}
+}
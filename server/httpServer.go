@@ -1,36 +1,119 @@
 package server
 
 import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/fatah-illah/asset-finder/config"
 	"github.com/fatah-illah/asset-finder/controllers"
+	"github.com/fatah-illah/asset-finder/jobs"
+	"github.com/fatah-illah/asset-finder/middleware"
+	"github.com/fatah-illah/asset-finder/storage"
+	"github.com/fatah-illah/asset-finder/utils"
 	"github.com/gin-gonic/gin"
 	"github.com/rs/zerolog/log"
-	"github.com/spf13/viper"
 	"gorm.io/gorm"
 )
 
 type HttpServer struct {
-	config             *viper.Viper
+	config             *config.Config
 	router             *gin.Engine
+	rateLimiter        *middleware.RateLimiter
+	authenticator      *middleware.Authenticator
+	jobs               []*jobs.Periodic
+	thumbnails         *jobs.Pool
+	autoTagRuns        *jobs.Pool
 	ManagerControllers controllers.ManagerControllers
 }
 
-func InitHttpServer(config *viper.Viper, dbInstance *gorm.DB) HttpServer {
-	managerControllers := controllers.NewManagerControllers(dbInstance)
+func InitHttpServer(conf *config.Config, dbInstance *gorm.DB, blobStore storage.BlobStore) HttpServer {
+	thumbnailPool := InitThumbnailPool(conf, dbInstance, blobStore)
+
+	autoTagPool := InitAutoTagPool(conf, dbInstance)
+
+	managerControllers := controllers.NewManagerControllers(dbInstance, conf, InitTagNormalizer(conf), blobStore, thumbnailPool, autoTagPool)
+
+	rateLimiter := InitRateLimiter(conf)
+
+	authenticator := InitAuthenticator(conf, rateLimiter)
+
+	appMetrics := InitMetrics(conf, dbInstance)
 
-	router := InitRoute(managerControllers)
+	router := InitRoute(conf, managerControllers, rateLimiter, authenticator, appMetrics)
 
 	return HttpServer{
-		config:             config,
+		config:             conf,
 		router:             router,
+		rateLimiter:        rateLimiter,
+		authenticator:      authenticator,
+		jobs:               InitJobs(conf, dbInstance, thumbnailPool),
+		thumbnails:         thumbnailPool,
+		autoTagRuns:        autoTagPool,
 		ManagerControllers: *managerControllers,
 	}
 }
 
-// Start HttpServer
+// Reload applies the hot reloadable settings of a changed configuration
+func (hs HttpServer) Reload(conf *config.Config) {
+	utils.SetupLogLevel(conf.Log.Level)
+	ConfigureRateLimiter(hs.rateLimiter, conf.RateLimit)
+	ConfigureAuthenticator(hs.authenticator, conf.Auth)
+}
+
+// Start HttpServer and block until SIGINT or SIGTERM, then shut down gracefully:
+// readiness fails first so the orchestrator stops routing traffic, then in-flight
+// requests are drained.
 func (hs HttpServer) Start() {
-	err := hs.router.Run(hs.config.GetString("http.server_address"))
+	srv := &http.Server{
+		Addr:    hs.config.HTTP.ServerAddress,
+		Handler: hs.router,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	hs.thumbnails.Start()
+	hs.autoTagRuns.Start()
+	for _, job := range hs.jobs {
+		job.Start()
+	}
+
+	go func() {
+		log.Info().Str("address", srv.Addr).Msg("HTTP Server listening")
+
+		err := srv.ListenAndServe()
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal().Err(err).Msg("Error while starting HTTP Server")
+		}
+	}()
+
+	<-ctx.Done()
+	stop()
+
+	log.Info().Msg("Shutting down HTTP Server ...")
+	hs.ManagerControllers.MarkShuttingDown()
+
+	drainDelay := hs.config.HTTP.ShutdownDrainDelay
+	if drainDelay > 0 {
+		log.Info().Dur("delay", drainDelay).Msg("Waiting for traffic to drain")
+		time.Sleep(drainDelay)
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), hs.config.HTTP.ShutdownTimeout)
+	defer cancel()
+
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Error().Err(err).Msg("Error while shutting down HTTP Server")
+	}
 
-	if err != nil {
-		log.Fatal().Err(err).Msg("Error while starting HTTP Server: %v")
+	for _, job := range hs.jobs {
+		job.Stop()
 	}
+	hs.thumbnails.Stop()
+	hs.autoTagRuns.Stop()
 }
@@ -3,40 +3,85 @@ package server
 import (
 	"net/http"
 
+	"github.com/fatah-illah/asset-finder/config"
 	"github.com/fatah-illah/asset-finder/controllers"
+	"github.com/fatah-illah/asset-finder/metrics"
+	"github.com/fatah-illah/asset-finder/middleware"
+	"github.com/fatah-illah/asset-finder/tracing"
 	"github.com/gin-gonic/gin"
 	"github.com/rs/zerolog/log"
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 )
 
-func InitRoute(mgrController *controllers.ManagerControllers) *gin.Engine {
-	r := gin.Default()
+func InitRoute(conf *config.Config, mgrController *controllers.ManagerControllers, rateLimiter *middleware.RateLimiter, authenticator *middleware.Authenticator, appMetrics *metrics.Metrics) *gin.Engine {
+	gin.DebugPrintRouteFunc = func(httpMethod, absolutePath, handlerName string, nuHandlers int) {
+		log.Debug().Str("method", httpMethod).Str("route", absolutePath).Str("handler", handlerName).Msg("Route registered")
+	}
+
+	r := gin.New()
+	// the client IP keys the rate limits of anonymous callers, X-Forwarded-For is
+	// only honoured from the configured proxies
+	if err := r.SetTrustedProxies(conf.HTTP.TrustedProxies); err != nil {
+		log.Fatal().Err(err).Msg("Invalid trusted proxies")
+	}
+	r.Use(otelgin.Middleware(tracing.ServerName), middleware.RequestLogger(), middleware.Recovery())
+
+	if appMetrics != nil {
+		r.Use(appMetrics.HTTPMiddleware())
+		r.GET("/metrics", gin.WrapH(appMetrics.Handler()))
+	}
 
 	r.GET("", func(context *gin.Context) {
 		context.JSON(http.StatusOK, "Welcome Home!")
-
-		log.Info().Msg("Request to home endpoint")
 	})
 
+	// Probes, outside of the API rate limits
+	r.GET("/healthz", mgrController.Liveness)
+	r.GET("/readyz", mgrController.Readiness)
+
 	// Setup Swagger
 	r.GET("/docs/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
 
-	baseRouter := r.Group("/api")
-	postRouter := baseRouter.Group("/posts")
-	tagsRouter := baseRouter.Group("/tags")
-	postTagsRouter := baseRouter.Group("/postTags")
+	// identified before the rate limits, which count per user
+	baseRouter := r.Group("/api", authenticator.Handler())
+	postRouter := baseRouter.Group("/posts", rateLimiter.Handler("posts"))
+	tagsRouter := baseRouter.Group("/tags", rateLimiter.Handler("tags"))
+	postTagsRouter := baseRouter.Group("/postTags", rateLimiter.Handler("post_tags"))
+	attachmentsRouter := baseRouter.Group("/attachments", rateLimiter.Handler("attachments"))
+	autoTagRulesRouter := baseRouter.Group("/autoTagRules", rateLimiter.Handler("auto_tag_rules"))
+	assetTypesRouter := baseRouter.Group("/assetTypes", rateLimiter.Handler("asset_types"))
 
 	// router (API) end-point Post
 	postRouter.GET("", mgrController.GetPosts)
+	postRouter.GET("/scheduled", mgrController.GetScheduledPosts)
 	postRouter.GET("/:postId", mgrController.GetPost)
+	postRouter.GET("/:postId/similar", mgrController.GetSimilarPosts)
 	postRouter.POST("", mgrController.CreatePost)
 	postRouter.PUT("/:postId", mgrController.UpdatePost)
 	postRouter.DELETE("/:postId", mgrController.DeletePost)
+	postRouter.GET("/:postId/transitions", mgrController.GetPostTransitions)
+	postRouter.POST("/:postId/transitions/:transition", mgrController.TransitionPost)
+	postRouter.GET("/:postId/attachments", mgrController.GetPostAttachments)
+	postRouter.POST("/:postId/attachments", mgrController.UploadAttachment)
 
 	// router (API) end-point Tag
 	tagsRouter.GET("", mgrController.GetTags)
+	tagsRouter.GET("/tree", mgrController.GetTagTree)
+	tagsRouter.GET("/suggest", mgrController.SuggestTags)
+	tagsRouter.GET("/stats", mgrController.GetTagStats)
+	tagsRouter.GET("/namespaces", mgrController.GetTagNamespaces)
+	tagsRouter.POST("/cooccurrences/refresh", mgrController.RefreshTagCooccurrences)
+	tagsRouter.GET("/by-slug/:slug", mgrController.GetTagBySlug)
 	tagsRouter.GET("/:tagId", mgrController.GetTag)
+	tagsRouter.GET("/:tagId/posts", mgrController.GetTagPosts)
+	tagsRouter.GET("/:tagId/related", mgrController.GetRelatedTags)
+	tagsRouter.PUT("/:tagId/move", mgrController.MoveTag)
+	tagsRouter.POST("/:tagId/merge", mgrController.MergeTags)
+	tagsRouter.GET("/:tagId/aliases", mgrController.GetTagAliases)
+	tagsRouter.POST("/:tagId/aliases", mgrController.CreateTagAlias)
+	tagsRouter.DELETE("/:tagId/aliases/:aliasId", mgrController.DeleteTagAlias)
 	tagsRouter.POST("", mgrController.CreateTag)
 	tagsRouter.PUT("/:tagId", mgrController.UpdateTag)
 	tagsRouter.DELETE("/:tagId", mgrController.DeleteTag)
@@ -48,5 +93,36 @@ func InitRoute(mgrController *controllers.ManagerControllers) *gin.Engine {
 	postTagsRouter.DELETE("/post/:postId", mgrController.DeletePostTagsByPostID)
 	postTagsRouter.DELETE("/tag/:tagId", mgrController.DeletePostTagsByTagID)
 
+	// router (API) end-point Attachment
+	attachmentsRouter.GET("", mgrController.GetAttachments)
+	attachmentsRouter.GET("/by-hash/:sha256", mgrController.GetAttachmentsByHash)
+	attachmentsRouter.GET("/:attachmentId", mgrController.GetAttachment)
+	attachmentsRouter.GET("/:attachmentId/download", mgrController.DownloadAttachment)
+	attachmentsRouter.GET("/:attachmentId/thumbnail", mgrController.GetAttachmentThumbnail)
+	attachmentsRouter.DELETE("/:attachmentId", mgrController.DeleteAttachment)
+
+	// router (API) end-point AutoTagRule
+	autoTagRulesRouter.GET("", mgrController.GetAutoTagRules)
+	autoTagRulesRouter.POST("", mgrController.CreateAutoTagRule)
+	autoTagRulesRouter.POST("/dry-run", mgrController.DryRunAutoTagRule)
+	autoTagRulesRouter.POST("/apply", mgrController.ApplyAutoTagRules)
+	autoTagRulesRouter.GET("/apply/:runId", mgrController.GetAutoTagRun)
+	autoTagRulesRouter.GET("/:ruleId", mgrController.GetAutoTagRule)
+	autoTagRulesRouter.GET("/:ruleId/dry-run", mgrController.DryRunSavedAutoTagRule)
+	autoTagRulesRouter.PUT("/:ruleId", mgrController.UpdateAutoTagRule)
+	autoTagRulesRouter.DELETE("/:ruleId", mgrController.DeleteAutoTagRule)
+
+	// router (API) end-point AssetType
+	assetTypesRouter.GET("", mgrController.GetAssetTypes)
+	assetTypesRouter.POST("", mgrController.CreateAssetType)
+	assetTypesRouter.GET("/:typeId", mgrController.GetAssetType)
+	assetTypesRouter.PUT("/:typeId", mgrController.UpdateAssetType)
+	assetTypesRouter.DELETE("/:typeId", mgrController.DeleteAssetType)
+	assetTypesRouter.GET("/:typeId/report", mgrController.GetAssetTypeReport)
+	assetTypesRouter.GET("/:typeId/schemas", mgrController.GetAssetTypeSchemas)
+	assetTypesRouter.POST("/:typeId/schemas", mgrController.CreateAssetTypeSchema)
+	assetTypesRouter.GET("/:typeId/schemas/:version", mgrController.GetAssetTypeSchema)
+	assetTypesRouter.POST("/:typeId/schemas/:version/activate", mgrController.ActivateAssetTypeSchema)
+
 	return r
 }
@@ -0,0 +1,61 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"github.com/fatah-illah/asset-finder/analytics"
+	"github.com/fatah-illah/asset-finder/config"
+	"github.com/fatah-illah/asset-finder/jobs"
+	"github.com/fatah-illah/asset-finder/publishing"
+	"github.com/fatah-illah/asset-finder/thumbnails"
+	"gorm.io/gorm"
+)
+
+// thumbnailBackfillBatch is the number of blobs the thumbnail backfill reads at once
+const thumbnailBackfillBatch = 500
+
+// InitJobs creates the background jobs, they are started and stopped with the HttpServer
+func InitJobs(conf *config.Config, db *gorm.DB, thumbnailPool *jobs.Pool) []*jobs.Periodic {
+	var backgroundJobs []*jobs.Periodic
+
+	cooccurrence := conf.Tags.Cooccurrence
+	if cooccurrence.RefreshInterval > 0 {
+		backgroundJobs = append(backgroundJobs, jobs.NewPeriodic("tag_cooccurrences", cooccurrence.RefreshInterval, func(ctx context.Context) error {
+			_, err := analytics.RefreshCooccurrences(ctx, db, cooccurrence.MinSupport)
+			return err
+		}))
+	}
+
+	thumbnailsConfig := conf.Attachments.Thumbnails
+	if thumbnailsConfig.BackfillInterval > 0 && len(thumbnailsConfig.Sizes) > 0 {
+		backgroundJobs = append(backgroundJobs, jobs.NewPeriodic("thumbnail_backfill", thumbnailsConfig.BackfillInterval, func(ctx context.Context) error {
+			after := ""
+			for {
+				hashes, err := thumbnails.Missing(ctx, db, thumbnailsConfig.Sizes, after, thumbnailBackfillBatch)
+				if err != nil {
+					return err
+				}
+
+				for _, sha256 := range hashes {
+					if err := thumbnailPool.Enqueue(ctx, sha256); err != nil {
+						return err
+					}
+				}
+				if len(hashes) < thumbnailBackfillBatch {
+					return nil
+				}
+				after = hashes[len(hashes)-1]
+			}
+		}))
+	}
+
+	if interval := conf.Workflow.SchedulerInterval; interval > 0 {
+		backgroundJobs = append(backgroundJobs, jobs.NewPeriodic("post_schedule", interval, func(ctx context.Context) error {
+			_, err := publishing.ApplySchedule(ctx, db, time.Now())
+			return err
+		}))
+	}
+
+	return backgroundJobs
+}
@@ -0,0 +1,22 @@
+package server
+
+import (
+	"github.com/fatah-illah/asset-finder/config"
+	"github.com/fatah-illah/asset-finder/metrics"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+)
+
+func InitMetrics(conf *config.Config, dbInstance *gorm.DB) *metrics.Metrics {
+	if !conf.Metrics.Enabled {
+		log.Info().Msg("Metrics disabled")
+		return nil
+	}
+
+	appMetrics, err := metrics.New(dbInstance)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Error while initializing metrics")
+	}
+
+	return appMetrics
+}
@@ -0,0 +1,34 @@
+package server
+
+import (
+	"github.com/fatah-illah/asset-finder/config"
+	"github.com/fatah-illah/asset-finder/middleware"
+	"github.com/rs/zerolog/log"
+)
+
+func InitRateLimiter(conf *config.Config) *middleware.RateLimiter {
+	rateLimiter := middleware.NewRateLimiter(middleware.NewMemoryRateLimitStore(), middleware.RateLimitRule{}, nil)
+	ConfigureRateLimiter(rateLimiter, conf.RateLimit)
+
+	return rateLimiter
+}
+
+// ConfigureRateLimiter applies the rate limit section, at startup and on reload
+func ConfigureRateLimiter(rateLimiter *middleware.RateLimiter, conf config.RateLimitConfig) {
+	if !conf.Enabled {
+		log.Info().Msg("Rate limiting disabled")
+		rateLimiter.Configure(middleware.RateLimitRule{}, nil)
+		return
+	}
+
+	defaultRule := middleware.RateLimitRule(conf.Default)
+
+	groupRules := make(map[string]middleware.RateLimitRule, len(conf.Groups))
+	for group, rule := range conf.Groups {
+		groupRules[group] = middleware.RateLimitRule(rule)
+	}
+
+	log.Info().Interface("default", defaultRule).Interface("groups", groupRules).Msg("Rate limiting enabled")
+
+	rateLimiter.Configure(defaultRule, groupRules)
+}
@@ -0,0 +1,40 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"github.com/fatah-illah/asset-finder/config"
+	"github.com/fatah-illah/asset-finder/storage"
+	"github.com/rs/zerolog/log"
+)
+
+// InitBlobStore opens the blob store of the attachments
+func InitBlobStore(conf *config.Config) storage.BlobStore {
+	switch conf.Attachments.Storage {
+	case "s3":
+		s3 := conf.Attachments.S3
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		store, err := storage.NewS3Store(ctx, storage.S3Config{
+			Endpoint:        s3.Endpoint,
+			Region:          s3.Region,
+			Bucket:          s3.Bucket,
+			AccessKeyID:     s3.AccessKeyID,
+			SecretAccessKey: s3.SecretAccessKey,
+			UseSSL:          s3.UseSSL,
+		})
+		if err != nil {
+			log.Fatal().Err(err).Str("endpoint", s3.Endpoint).Str("bucket", s3.Bucket).Msg("Error while opening S3 storage")
+		}
+		return store
+	default:
+		store, err := storage.NewLocalStore(conf.Attachments.Local.Path)
+		if err != nil {
+			log.Fatal().Err(err).Str("path", conf.Attachments.Local.Path).Msg("Error while opening local storage")
+		}
+		return store
+	}
+}
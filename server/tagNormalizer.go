@@ -0,0 +1,18 @@
+package server
+
+import (
+	"github.com/fatah-illah/asset-finder/config"
+	"github.com/fatah-illah/asset-finder/utils"
+)
+
+// InitTagNormalizer builds the tag label normalizer from the configuration
+func InitTagNormalizer(conf *config.Config) utils.TagNormalizer {
+	normalization := conf.Tags.Normalization
+
+	return utils.TagNormalizer{
+		Trim:               normalization.Trim,
+		NFC:                normalization.NFC,
+		CaseFold:           normalization.CaseFold,
+		CollapseWhitespace: normalization.CollapseWhitespace,
+	}
+}
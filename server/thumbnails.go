@@ -0,0 +1,21 @@
+package server
+
+import (
+	"context"
+
+	"github.com/fatah-illah/asset-finder/config"
+	"github.com/fatah-illah/asset-finder/jobs"
+	"github.com/fatah-illah/asset-finder/storage"
+	"github.com/fatah-illah/asset-finder/thumbnails"
+	"gorm.io/gorm"
+)
+
+// InitThumbnailPool creates the workers generating the thumbnails of the uploaded
+// images, they are started and stopped with the HttpServer
+func InitThumbnailPool(conf *config.Config, db *gorm.DB, blobStore storage.BlobStore) *jobs.Pool {
+	thumbnailsConfig := conf.Attachments.Thumbnails
+
+	return jobs.NewPool("thumbnails", thumbnailsConfig.Workers, thumbnailsConfig.QueueSize, func(ctx context.Context, sha256 string) error {
+		return thumbnails.Generate(ctx, db, blobStore, sha256, thumbnailsConfig.Sizes)
+	})
+}
@@ -0,0 +1,43 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"github.com/fatah-illah/asset-finder/config"
+	"github.com/fatah-illah/asset-finder/tracing"
+	"github.com/rs/zerolog/log"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+func InitTracing(conf *config.Config) *sdktrace.TracerProvider {
+	tracingConfig := tracing.Config{
+		Exporter:     conf.Tracing.Exporter,
+		ServiceName:  conf.Tracing.ServiceName,
+		SampleRatio:  conf.Tracing.SampleRatio,
+		OTLPEndpoint: conf.Tracing.OTLP.Endpoint,
+		OTLPInsecure: conf.Tracing.OTLP.Insecure,
+	}
+
+	exporter, err := tracing.NewExporter(context.Background(), tracingConfig)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Error while initializing tracing exporter")
+	}
+
+	provider := tracing.NewProvider(tracingConfig, exporter)
+	tracing.Setup(provider)
+
+	log.Info().Str("exporter", tracingConfig.Exporter).Msg("Tracing initialized")
+
+	return provider
+}
+
+// ShutdownTracing flushes the spans still buffered in the provider
+func ShutdownTracing(provider *sdktrace.TracerProvider) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := provider.Shutdown(ctx); err != nil {
+		log.Warn().Err(err).Msg("Error while shutting down tracing")
+	}
+}
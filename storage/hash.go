@@ -0,0 +1,24 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"regexp"
+)
+
+var sha256Pattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// Hash returns the hex encoded SHA-256 of a content
+func Hash(content io.Reader) (string, error) {
+	hash := sha256.New()
+	if _, err := io.Copy(hash, content); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// ValidHash reports whether s is a lowercase hex encoded SHA-256
+func ValidHash(s string) bool {
+	return sha256Pattern.MatchString(s)
+}
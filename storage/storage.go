@@ -0,0 +1,27 @@
+// Package storage keeps the binary content of the attachments in a BlobStore:
+// the local filesystem or an S3-compatible object storage.
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+)
+
+// ErrNotFound is returned when a blob does not exist
+var ErrNotFound = errors.New("blob not found")
+
+// Blob is the content of a stored blob, seekable to serve Range requests
+type Blob interface {
+	io.ReadSeekCloser
+	Size() int64
+	ModTime() time.Time
+}
+
+// BlobStore stores blobs by key, keys are slash separated paths
+type BlobStore interface {
+	Put(ctx context.Context, key string, content io.Reader, size int64, contentType string) error
+	Get(ctx context.Context, key string) (Blob, error)
+	Delete(ctx context.Context, key string) error
+}
@@ -0,0 +1,339 @@
+// Package tagexpr parses boolean tag expressions such as
+//
+//	linux AND (prod OR staging) AND NOT deprecated
+//
+// The operators are AND, OR and NOT (case insensitive), NOT binding tighter than
+// AND and AND tighter than OR. Tags are bare words or double quoted strings.
+//
+// An expression has at most MaxTerms tags and MaxDepth nested parentheses and
+// NOTs, which bounds the bind parameters and the recursion of its SQL.
+package tagexpr
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// MaxTerms is the maximum number of tags in an expression
+	MaxTerms = 100
+	// MaxDepth is the maximum nesting of parentheses and NOTs in an expression
+	MaxDepth = 20
+)
+
+// Node is a parsed expression: a Tag, Not, And or Or
+type Node interface {
+	String() string
+}
+
+type Tag struct {
+	Name string
+	Pos  int
+}
+
+type Not struct {
+	Operand Node
+}
+
+type And struct {
+	Left, Right Node
+}
+
+type Or struct {
+	Left, Right Node
+}
+
+func (t Tag) String() string { return fmt.Sprintf("%q", t.Name) }
+func (n Not) String() string { return "NOT " + n.Operand.String() }
+func (a And) String() string { return "(" + a.Left.String() + " AND " + a.Right.String() + ")" }
+func (o Or) String() string  { return "(" + o.Left.String() + " OR " + o.Right.String() + ")" }
+
+// SyntaxError reports an invalid expression, Pos is the 1-based position of the
+// offending character
+type SyntaxError struct {
+	Pos int
+	Msg string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("position %d: %s", e.Pos, e.Msg)
+}
+
+// Parse parses an expression
+func Parse(expression string) (Node, error) {
+	tokens, err := tokenize(expression)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+	node, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if next := p.peek(); next.kind != tokenEnd {
+		return nil, &SyntaxError{Pos: next.pos, Msg: fmt.Sprintf("unexpected %s", next)}
+	}
+	return node, nil
+}
+
+// SQL compiles an expression to a SQL condition, term returns the condition
+// matching a single tag
+func SQL(node Node, term func(tag Tag) (string, []interface{})) (string, []interface{}) {
+	switch n := node.(type) {
+	case Tag:
+		return term(n)
+	case Not:
+		sql, args := SQL(n.Operand, term)
+		return "NOT " + sql, args
+	case And:
+		return binarySQL("AND", n.Left, n.Right, term)
+	case Or:
+		return binarySQL("OR", n.Left, n.Right, term)
+	default:
+		panic(fmt.Sprintf("tagexpr: unknown node %T", node))
+	}
+}
+
+// binarySQL joins a chain of the same operator in a single parenthesis, a AND b
+// AND c nesting no deeper than a AND b
+func binarySQL(operator string, left, right Node, term func(tag Tag) (string, []interface{})) (string, []interface{}) {
+	operands := chain(operator, left, []Node{right})
+
+	conditions := make([]string, len(operands))
+	var args []interface{}
+	for i, operand := range operands {
+		sql, operandArgs := SQL(operand, term)
+		conditions[i] = sql
+		args = append(args, operandArgs...)
+	}
+	return "(" + strings.Join(conditions, " "+operator+" ") + ")", args
+}
+
+// chain prepends to operands the operands of the left-nested operator nodes
+func chain(operator string, left Node, operands []Node) []Node {
+	for {
+		switch n := left.(type) {
+		case And:
+			if operator != "AND" {
+				return append([]Node{left}, operands...)
+			}
+			operands = append([]Node{n.Right}, operands...)
+			left = n.Left
+		case Or:
+			if operator != "OR" {
+				return append([]Node{left}, operands...)
+			}
+			operands = append([]Node{n.Right}, operands...)
+			left = n.Left
+		default:
+			return append([]Node{left}, operands...)
+		}
+	}
+}
+
+type tokenKind int
+
+const (
+	tokenEnd tokenKind = iota
+	tokenTag
+	tokenAnd
+	tokenOr
+	tokenNot
+	tokenOpen
+	tokenClose
+)
+
+type token struct {
+	kind  tokenKind
+	value string
+	pos   int
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokenEnd:
+		return "end of expression"
+	case tokenTag:
+		return fmt.Sprintf("tag %q", t.value)
+	case tokenOpen:
+		return `"("`
+	case tokenClose:
+		return `")"`
+	default:
+		return t.value
+	}
+}
+
+func tokenize(expression string) ([]token, error) {
+	var tokens []token
+	runes := []rune(expression)
+	// a large expression is rejected before the rest of it is tokenized
+	terms := 0
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		pos := i + 1
+
+		switch {
+		case r == ' ' || r == '\t' || r == '\n' || r == '\r':
+			i++
+		case r == '(':
+			tokens = append(tokens, token{kind: tokenOpen, value: "(", pos: pos})
+			i++
+		case r == ')':
+			tokens = append(tokens, token{kind: tokenClose, value: ")", pos: pos})
+			i++
+		case r == '"':
+			end := i + 1
+			for end < len(runes) && runes[end] != '"' {
+				end++
+			}
+			if end == len(runes) {
+				return nil, &SyntaxError{Pos: pos, Msg: "unterminated quoted tag"}
+			}
+			if end == i+1 {
+				return nil, &SyntaxError{Pos: pos, Msg: "empty quoted tag"}
+			}
+			tokens = append(tokens, token{kind: tokenTag, value: string(runes[i+1 : end]), pos: pos})
+			if terms++; terms > MaxTerms {
+				return nil, tooManyTerms(pos)
+			}
+			i = end + 1
+		default:
+			end := i
+			for end < len(runes) && !strings.ContainsRune(" \t\n\r()\"", runes[end]) {
+				end++
+			}
+			word := string(runes[i:end])
+
+			kind := tokenTag
+			switch strings.ToUpper(word) {
+			case "AND":
+				kind = tokenAnd
+			case "OR":
+				kind = tokenOr
+			case "NOT":
+				kind = tokenNot
+			}
+			if kind != tokenTag {
+				word = strings.ToUpper(word)
+			}
+
+			tokens = append(tokens, token{kind: kind, value: word, pos: pos})
+			if kind == tokenTag {
+				if terms++; terms > MaxTerms {
+					return nil, tooManyTerms(pos)
+				}
+			}
+			i = end
+		}
+	}
+
+	return append(tokens, token{kind: tokenEnd, pos: len(runes) + 1}), nil
+}
+
+func tooManyTerms(pos int) error {
+	return &SyntaxError{Pos: pos, Msg: fmt.Sprintf("more than %d tags", MaxTerms)}
+}
+
+type parser struct {
+	tokens []token
+	next   int
+	depth  int
+}
+
+// enter descends into a parenthesis or a NOT starting at t
+func (p *parser) enter(t token) error {
+	p.depth++
+	if p.depth > MaxDepth {
+		return &SyntaxError{Pos: t.pos, Msg: fmt.Sprintf("more than %d nested parentheses and NOTs", MaxDepth)}
+	}
+	return nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.next]
+}
+
+func (p *parser) take() token {
+	t := p.tokens[p.next]
+	if t.kind != tokenEnd {
+		p.next++
+	}
+	return t
+}
+
+func (p *parser) parseOr() (Node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peek().kind == tokenOr {
+		p.take()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = Or{Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (Node, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peek().kind == tokenAnd {
+		p.take()
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = And{Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseNot() (Node, error) {
+	if p.peek().kind == tokenNot {
+		if err := p.enter(p.take()); err != nil {
+			return nil, err
+		}
+		operand, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		p.depth--
+		return Not{Operand: operand}, nil
+	}
+	return p.parseOperand()
+}
+
+func (p *parser) parseOperand() (Node, error) {
+	t := p.take()
+
+	switch t.kind {
+	case tokenTag:
+		return Tag{Name: t.value, Pos: t.pos}, nil
+	case tokenOpen:
+		if err := p.enter(t); err != nil {
+			return nil, err
+		}
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.take(); closing.kind != tokenClose {
+			return nil, &SyntaxError{Pos: closing.pos, Msg: fmt.Sprintf("expected \")\" to close the \"(\" at position %d, got %s", t.pos, closing)}
+		}
+		p.depth--
+		return node, nil
+	default:
+		return nil, &SyntaxError{Pos: t.pos, Msg: fmt.Sprintf("expected a tag, \"(\" or NOT, got %s", t)}
+	}
+}
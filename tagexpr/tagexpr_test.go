@@ -0,0 +1,112 @@
+package tagexpr
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestParsePrecedence(t *testing.T) {
+	tests := []struct {
+		expression string
+		want       string
+	}{
+		{`linux`, `"linux"`},
+		{`a OR b AND c`, `("a" OR ("b" AND "c"))`},
+		{`a AND b OR c`, `(("a" AND "b") OR "c")`},
+		{`NOT a AND b`, `(NOT "a" AND "b")`},
+		{`not (a or b)`, `NOT ("a" OR "b")`},
+		{`a AND b AND c`, `(("a" AND "b") AND "c")`},
+		{`linux AND (prod OR staging) AND NOT deprecated`, `(("linux" AND ("prod" OR "staging")) AND NOT "deprecated")`},
+		{`"web server" OR "and"`, `("web server" OR "and")`},
+	}
+
+	for _, test := range tests {
+		node, err := Parse(test.expression)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", test.expression, err)
+			continue
+		}
+		if got := node.String(); got != test.want {
+			t.Errorf("Parse(%q) = %s, want %s", test.expression, got, test.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		expression string
+		pos        int
+		msg        string
+	}{
+		{``, 1, "expected a tag"},
+		{`a AND`, 6, "expected a tag"},
+		{`a b`, 3, `unexpected tag "b"`},
+		{`(a OR b`, 8, `expected ")" to close the "(" at position 1`},
+		{`a)`, 2, `unexpected ")"`},
+		{`"unterminated`, 1, "unterminated quoted tag"},
+		{`a OR ""`, 6, "empty quoted tag"},
+		{`NOT`, 4, "expected a tag"},
+	}
+
+	for _, test := range tests {
+		_, err := Parse(test.expression)
+		var syntaxError *SyntaxError
+		if !errors.As(err, &syntaxError) {
+			t.Errorf("Parse(%q) = %v, want a syntax error", test.expression, err)
+			continue
+		}
+		if syntaxError.Pos != test.pos || !strings.Contains(syntaxError.Msg, test.msg) {
+			t.Errorf("Parse(%q) = %v, want position %d: %s", test.expression, err, test.pos, test.msg)
+		}
+	}
+}
+
+func TestParseLimits(t *testing.T) {
+	terms := make([]string, MaxTerms+1)
+	for i := range terms {
+		terms[i] = "t"
+	}
+	if _, err := Parse(strings.Join(terms[:MaxTerms], " OR ")); err != nil {
+		t.Errorf("%d tags: %v", MaxTerms, err)
+	}
+	if _, err := Parse(strings.Join(terms, " OR ")); err == nil || !strings.Contains(err.Error(), "more than") {
+		t.Errorf("%d tags: err = %v, want too many tags", MaxTerms+1, err)
+	}
+
+	nested := func(depth int, open, close string) string {
+		return strings.Repeat(open, depth) + "t" + strings.Repeat(close, depth)
+	}
+	if _, err := Parse(nested(MaxDepth, "(", ")")); err != nil {
+		t.Errorf("%d nested parentheses: %v", MaxDepth, err)
+	}
+	if _, err := Parse(nested(MaxDepth+1, "(", ")")); err == nil || !strings.Contains(err.Error(), "nested") {
+		t.Errorf("%d nested parentheses: err = %v, want too deep", MaxDepth+1, err)
+	}
+	if _, err := Parse(nested(MaxDepth+1, "NOT ", "")); err == nil || !strings.Contains(err.Error(), "nested") {
+		t.Errorf("%d nested NOTs: err = %v, want too deep", MaxDepth+1, err)
+	}
+	// the depth is that of the nesting, not the number of groups
+	if _, err := Parse(strings.Repeat("(t) AND ", MaxDepth) + "(t)"); err != nil {
+		t.Errorf("%d sibling groups: %v", MaxDepth+1, err)
+	}
+}
+
+func TestSQL(t *testing.T) {
+	node, err := Parse(`a AND b AND NOT (c OR d OR e) OR f`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sql, args := SQL(node, func(tag Tag) (string, []interface{}) {
+		return "has(?)", []interface{}{tag.Name}
+	})
+	// the chains of an operator are not nested
+	if want := "((has(?) AND has(?) AND NOT (has(?) OR has(?) OR has(?))) OR has(?))"; sql != want {
+		t.Errorf("SQL = %s, want %s", sql, want)
+	}
+	if want := "[a b c d e f]"; fmt.Sprint(args) != want {
+		t.Errorf("args = %v, want %s", args, want)
+	}
+}
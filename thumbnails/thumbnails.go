@@ -0,0 +1,219 @@
+// Package thumbnails generates downscaled copies of the image blobs, stored
+// next to them in the blob store.
+package thumbnails
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"slices"
+
+	"github.com/fatah-illah/asset-finder/models"
+	"github.com/fatah-illah/asset-finder/storage"
+	"golang.org/x/image/draw"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	_ "image/gif"
+
+	_ "golang.org/x/image/webp"
+)
+
+// maxSourcePixels keeps huge images from exhausting the memory when decoded
+const maxSourcePixels = 64 << 20
+
+// errUnusable marks the images thumbnails can never be generated for
+var errUnusable = errors.New("unusable image")
+
+// ContentTypes are the image types thumbnails are generated for
+var ContentTypes = []string{"image/jpeg", "image/png", "image/gif", "image/webp"}
+
+// Supports reports whether thumbnails are generated for a content type
+func Supports(contentType string) bool {
+	return slices.Contains(ContentTypes, contentType)
+}
+
+// Key returns the storage key of a thumbnail, the same for every generation
+// so that concurrent generations overwrite each other
+func Key(sha256 string, size int) string {
+	return fmt.Sprintf("thumbnails/%s/%s/%d", sha256[:2], sha256, size)
+}
+
+// Generate creates the missing thumbnails of a blob in the given sizes
+func Generate(ctx context.Context, db *gorm.DB, store storage.BlobStore, sha256 string, sizes []int) error {
+	db = db.WithContext(ctx)
+
+	var blob models.Blob
+	if err := db.Where("sha256 = ?", sha256).Limit(1).Find(&blob).Error; err != nil {
+		return err
+	}
+	if blob.SHA256 == "" || !Supports(blob.ContentType) {
+		return nil
+	}
+
+	var existing []int
+	if err := db.Model(&models.Thumbnail{}).Where("sha256 = ?", sha256).Pluck("size", &existing).Error; err != nil {
+		return err
+	}
+	missing := slices.DeleteFunc(slices.Clone(sizes), func(size int) bool { return slices.Contains(existing, size) })
+	if len(missing) == 0 {
+		return nil
+	}
+
+	source, err := decode(ctx, store, blob)
+	if errors.Is(err, errUnusable) {
+		// recorded as failed thumbnails, not to decode the image over and over
+		failed := make([]models.Thumbnail, len(missing))
+		for i, size := range missing {
+			failed[i] = models.Thumbnail{SHA256: sha256, Size: size, Error: err.Error()}
+		}
+		if err := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&failed).Error; err != nil {
+			return err
+		}
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, size := range missing {
+		thumbnail, content, err := render(source, blob, size)
+		if err != nil {
+			return err
+		}
+
+		if err := store.Put(ctx, thumbnail.StorageKey, bytes.NewReader(content), int64(len(content)), thumbnail.ContentType); err != nil {
+			return err
+		}
+		if err := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&thumbnail).Error; err != nil {
+			return err
+		}
+	}
+
+	// the blob may have been deleted with its last attachment in the meantime
+	var remaining int64
+	if err := db.Model(&models.Blob{}).Where("sha256 = ?", sha256).Count(&remaining).Error; err != nil {
+		return err
+	}
+	if remaining == 0 {
+		keys, err := Release(db, []string{sha256})
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			if err := store.Delete(ctx, key); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Missing returns at most limit image blobs lacking a thumbnail in one of the
+// sizes, in the order of their hashes from the one following after, the failed
+// thumbnails are not missing
+func Missing(ctx context.Context, db *gorm.DB, sizes []int, after string, limit int) ([]string, error) {
+	var hashes []string
+	if len(sizes) == 0 {
+		return hashes, nil
+	}
+
+	err := db.WithContext(ctx).Model(&models.Blob{}).
+		Where("content_type IN ?", ContentTypes).
+		Where("sha256 > ?", after).
+		Where("(SELECT COUNT(*) FROM thumbnails WHERE thumbnails.sha256 = blobs.sha256 AND thumbnails.size IN ?) < ?", sizes, len(sizes)).
+		Order("sha256").
+		Limit(limit).
+		Pluck("sha256", &hashes).Error
+	return hashes, err
+}
+
+// Release deletes the thumbnails of deleted blobs and returns their storage keys,
+// to delete their content once the transaction is committed
+func Release(tx *gorm.DB, hashes []string) ([]string, error) {
+	var thumbnails []models.Thumbnail
+	if err := tx.Where("sha256 IN ?", hashes).Find(&thumbnails).Error; err != nil {
+		return nil, err
+	}
+	if len(thumbnails) == 0 {
+		return nil, nil
+	}
+
+	keys := make([]string, 0, len(thumbnails))
+	for _, thumbnail := range thumbnails {
+		if thumbnail.StorageKey != "" {
+			keys = append(keys, thumbnail.StorageKey)
+		}
+	}
+
+	return keys, tx.Where("sha256 IN ?", hashes).Delete(&models.Thumbnail{}).Error
+}
+
+func decode(ctx context.Context, store storage.BlobStore, blob models.Blob) (image.Image, error) {
+	content, err := store.Get(ctx, blob.StorageKey)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, fmt.Errorf("%w: content of image %s: %v", errUnusable, blob.SHA256, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer content.Close()
+
+	config, _, err := image.DecodeConfig(content)
+	if err != nil {
+		return nil, fmt.Errorf("%w: decoding image %s: %v", errUnusable, blob.SHA256, err)
+	}
+	if config.Width*config.Height > maxSourcePixels {
+		return nil, fmt.Errorf("%w: image %s of %dx%d pixels is too large for thumbnails", errUnusable, blob.SHA256, config.Width, config.Height)
+	}
+
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	source, _, err := image.Decode(content)
+	if err != nil {
+		return nil, fmt.Errorf("%w: decoding image %s: %v", errUnusable, blob.SHA256, err)
+	}
+	return source, nil
+}
+
+// render scales an image down to fit in a size x size box, never up, as a JPEG
+// for JPEG sources and as a PNG to keep the transparency of the other types
+func render(source image.Image, blob models.Blob, size int) (models.Thumbnail, []byte, error) {
+	bounds := source.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if longest := max(width, height); longest > size {
+		width = max(1, width*size/longest)
+		height = max(1, height*size/longest)
+	}
+
+	scaled := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(scaled, scaled.Bounds(), source, bounds, draw.Src, nil)
+
+	thumbnail := models.Thumbnail{
+		SHA256:     blob.SHA256,
+		Size:       size,
+		Width:      width,
+		Height:     height,
+		StorageKey: Key(blob.SHA256, size),
+	}
+
+	var content bytes.Buffer
+	var err error
+	if blob.ContentType == "image/jpeg" {
+		thumbnail.ContentType = "image/jpeg"
+		err = jpeg.Encode(&content, scaled, &jpeg.Options{Quality: 85})
+	} else {
+		thumbnail.ContentType = "image/png"
+		err = png.Encode(&content, scaled)
+	}
+
+	return thumbnail, content.Bytes(), err
+}
@@ -0,0 +1,98 @@
+package thumbnails
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/fatah-illah/asset-finder/models"
+	"github.com/fatah-illah/asset-finder/storage"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.Blob{}, &models.Thumbnail{}); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestMissingInBatches(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+
+	var want []string
+	for i := 0; i < 5; i++ {
+		sha256 := fmt.Sprintf("%064d", i)
+		if err := db.Create(&models.Blob{SHA256: sha256, ContentType: "image/png", StorageKey: sha256}).Error; err != nil {
+			t.Fatal(err)
+		}
+		want = append(want, sha256)
+	}
+	// a blob with every thumbnail, even failed, and a blob other than an image are not missing
+	if err := db.Create(&models.Thumbnail{SHA256: want[2], Size: 64, Error: "unusable image"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&models.Blob{SHA256: fmt.Sprintf("%064d", 9), ContentType: "application/pdf"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	want = slices.Delete(want, 2, 3)
+
+	var got []string
+	after := ""
+	for {
+		hashes, err := Missing(ctx, db, []int{64}, after, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(hashes) > 2 {
+			t.Fatalf("Missing returned %d hashes, want at most 2", len(hashes))
+		}
+		got = append(got, hashes...)
+		if len(hashes) < 2 {
+			break
+		}
+		after = hashes[len(hashes)-1]
+	}
+
+	if !slices.Equal(got, want) {
+		t.Errorf("Missing = %v, want %v", got, want)
+	}
+}
+
+func TestGenerateRecordsMissingContent(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+
+	store, err := storage.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sha256 := fmt.Sprintf("%064d", 1)
+	if err := db.Create(&models.Blob{SHA256: sha256, ContentType: "image/png", StorageKey: "blobs/" + sha256}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Generate(ctx, db, store, sha256, []int{64, 256}); !errors.Is(err, errUnusable) {
+		t.Fatalf("Generate = %v, want an unusable image", err)
+	}
+
+	hashes, err := Missing(ctx, db, []int{64, 256}, "", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hashes) != 0 {
+		t.Errorf("Missing = %v, want the blob without content recorded as failed", hashes)
+	}
+}
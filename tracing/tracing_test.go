@@ -0,0 +1,161 @@
+package tracing
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// stubDriver answers every query with a single (id, title) row, so that the
+// GORM spans can be recorded without a database server
+type stubDriver struct{}
+
+func (stubDriver) Open(string) (driver.Conn, error) { return stubConn{}, nil }
+
+type stubConn struct{}
+
+func (stubConn) Prepare(query string) (driver.Stmt, error) { return stubStmt{}, nil }
+func (stubConn) Close() error                              { return nil }
+func (stubConn) Begin() (driver.Tx, error)                 { return stubTx{}, nil }
+
+type stubTx struct{}
+
+func (stubTx) Commit() error   { return nil }
+func (stubTx) Rollback() error { return nil }
+
+type stubStmt struct{}
+
+func (stubStmt) Close() error  { return nil }
+func (stubStmt) NumInput() int { return -1 }
+func (stubStmt) Exec([]driver.Value) (driver.Result, error) {
+	return driver.RowsAffected(1), nil
+}
+func (stubStmt) Query([]driver.Value) (driver.Rows, error) {
+	return &stubRows{}, nil
+}
+
+type stubRows struct{ done bool }
+
+func (*stubRows) Columns() []string { return []string{"id", "title"} }
+func (*stubRows) Close() error      { return nil }
+func (r *stubRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done = true
+	dest[0], dest[1] = int64(1), "Laptop"
+	return nil
+}
+
+func init() {
+	sql.Register("tracing-stub", stubDriver{})
+}
+
+type post struct {
+	ID    uint
+	Title string
+}
+
+func TestRequestSpans(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	exporter := tracetest.NewInMemoryExporter()
+	provider := NewProvider(Config{ServiceName: "asset-finder-test", SampleRatio: 1}, exporter)
+	defer provider.Shutdown(context.Background())
+
+	db, err := gorm.Open(postgres.New(postgres.Config{DriverName: "tracing-stub"}), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Use(NewGormPlugin(provider)); err != nil {
+		t.Fatal(err)
+	}
+
+	router := gin.New()
+	router.Use(otelgin.Middleware(ServerName, otelgin.WithTracerProvider(provider), otelgin.WithPropagators(Propagator())))
+	router.GET("/posts/:postId", func(c *gin.Context) {
+		var posts []post
+		if err := db.WithContext(c.Request.Context()).Table("posts").Where("id = ?", c.Param("postId")).Find(&posts).Error; err != nil {
+			c.Status(http.StatusInternalServerError)
+			return
+		}
+		c.JSON(http.StatusOK, posts)
+	})
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/posts/1", nil))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", recorder.Code, http.StatusOK)
+	}
+
+	if err := provider.ForceFlush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	spans := exporter.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("got %d spans, want the gin and the gorm spans", len(spans))
+	}
+	ginSpan, gormSpan := findSpan(t, spans, "/posts/:postId"), findSpan(t, spans, "gorm.query")
+
+	assertAttribute(t, ginSpan, semconv.HTTPRouteKey, attribute.StringValue("/posts/:postId"))
+	assertAttribute(t, ginSpan, semconv.HTTPStatusCodeKey, attribute.IntValue(http.StatusOK))
+
+	statement, ok := attributeValue(gormSpan, semconv.DBStatementKey)
+	if !ok || !strings.HasPrefix(statement.AsString(), `SELECT * FROM "posts" WHERE id =`) {
+		t.Errorf("db.statement = %q, want the SELECT of the posts", statement.AsString())
+	}
+	assertAttribute(t, gormSpan, semconv.DBSQLTableKey, attribute.StringValue("posts"))
+	assertAttribute(t, gormSpan, "db.rows_affected", attribute.Int64Value(1))
+
+	if gormSpan.Parent.SpanID() != ginSpan.SpanContext.SpanID() {
+		t.Errorf("the gorm span is not a child of the gin span")
+	}
+}
+
+func findSpan(t *testing.T, spans tracetest.SpanStubs, name string) tracetest.SpanStub {
+	t.Helper()
+
+	for _, span := range spans {
+		if span.Name == name {
+			return span
+		}
+	}
+	t.Fatalf("no %q span", name)
+	return tracetest.SpanStub{}
+}
+
+func attributeValue(span tracetest.SpanStub, key attribute.Key) (attribute.Value, bool) {
+	for _, kv := range span.Attributes {
+		if kv.Key == key {
+			return kv.Value, true
+		}
+	}
+	return attribute.Value{}, false
+}
+
+func assertAttribute(t *testing.T, span tracetest.SpanStub, key attribute.Key, want attribute.Value) {
+	t.Helper()
+
+	got, ok := attributeValue(span, key)
+	if !ok {
+		t.Errorf("%s: missing %s", span.Name, key)
+		return
+	}
+	if got != want {
+		t.Errorf("%s: %s = %v, want %v", span.Name, key, got.Emit(), want.Emit())
+	}
+}
@@ -0,0 +1,37 @@
+package utils
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ForUpdate locks the selected rows until the end of the transaction on the
+// databases supporting SELECT ... FOR UPDATE.
+func ForUpdate(db *gorm.DB) *gorm.DB {
+	if db.Dialector.Name() == "postgres" {
+		return db.Clauses(clause.Locking{Strength: "UPDATE"})
+	}
+	return db
+}
+
+// ForUpdateSkipLocked locks the selected rows until the end of the transaction,
+// skipping the rows locked by other transactions, on the databases supporting
+// SELECT ... FOR UPDATE SKIP LOCKED.
+func ForUpdateSkipLocked(db *gorm.DB) *gorm.DB {
+	if db.Dialector.Name() == "postgres" {
+		return db.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"})
+	}
+	return db
+}
+
+// IsUniqueViolation tells whether err is the violation of a unique index, as
+// translated by the dialector of db.
+func IsUniqueViolation(db *gorm.DB, err error) bool {
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return true
+	}
+	translator, ok := db.Dialector.(gorm.ErrorTranslator)
+	return ok && errors.Is(translator.Translate(err), gorm.ErrDuplicatedKey)
+}
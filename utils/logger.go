@@ -0,0 +1,29 @@
+package utils
+
+import (
+	"context"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// Logger returns the request-scoped logger attached to ctx, or the global logger
+func Logger(ctx context.Context) *zerolog.Logger {
+	if ctx != nil {
+		if logger := zerolog.Ctx(ctx); logger.GetLevel() != zerolog.Disabled {
+			return logger
+		}
+	}
+	return &log.Logger
+}
+
+// SetupLogLevel sets the global log level, falling back to info on an unknown level
+func SetupLogLevel(level string) {
+	parsed, err := zerolog.ParseLevel(level)
+	if err != nil || level == "" {
+		log.Warn().Str("level", level).Msg("Unknown log level, using info")
+		parsed = zerolog.InfoLevel
+	}
+
+	zerolog.SetGlobalLevel(parsed)
+}
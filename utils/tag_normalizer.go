@@ -0,0 +1,103 @@
+package utils
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+// TagNormalizer cleans up tag labels so that e.g. " Go", "go" and "GO" are the same tag
+type TagNormalizer struct {
+	Trim               bool
+	NFC                bool
+	CaseFold           bool
+	CollapseWhitespace bool
+}
+
+// NamespaceSeparator separates the namespace from the value of tags like env:prod
+const NamespaceSeparator = ":"
+
+// Label returns the label to store and display, the case is preserved. The
+// spaces around the separator of a namespaced label are dropped.
+func (n TagNormalizer) Label(label string) string {
+	label = n.clean(label)
+	if namespace, value, ok := n.split(label); ok {
+		return namespace + NamespaceSeparator + value
+	}
+	return label
+}
+
+// Split returns the namespace key and the value of a namespaced label, or two
+// empty strings when the label has no namespace
+func (n TagNormalizer) Split(label string) (namespace, value string) {
+	namespace, value, ok := n.split(n.clean(label))
+	if !ok {
+		return "", ""
+	}
+	return n.fold(namespace), value
+}
+
+func (n TagNormalizer) split(label string) (namespace, value string, ok bool) {
+	namespace, value, found := strings.Cut(label, NamespaceSeparator)
+	namespace, value = strings.TrimSpace(namespace), strings.TrimSpace(value)
+	if !found || namespace == "" || value == "" {
+		return "", "", false
+	}
+	return namespace, value, true
+}
+
+func (n TagNormalizer) clean(label string) string {
+	if n.NFC {
+		label = norm.NFC.String(label)
+	}
+	if n.CollapseWhitespace {
+		label = strings.Join(strings.Fields(label), " ")
+	}
+	if n.Trim {
+		label = strings.TrimSpace(label)
+	}
+	return label
+}
+
+// Key returns the lookup key of a label, which is case folded when enabled
+func (n TagNormalizer) Key(label string) string {
+	return n.fold(n.Label(label))
+}
+
+func (n TagNormalizer) fold(label string) string {
+	if n.CaseFold {
+		label = cases.Fold().String(label)
+	}
+	return label
+}
+
+// Slugify turns a label into a lowercase ASCII slug such as "cafe-au-lait".
+// Labels without any ASCII letter or digit give the "tag" slug.
+func Slugify(label string) string {
+	var slug strings.Builder
+	pendingDash := false
+
+	for _, r := range norm.NFKD.String(label) {
+		if unicode.Is(unicode.Mn, r) {
+			continue
+		}
+
+		r = unicode.ToLower(r)
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			if pendingDash && slug.Len() > 0 {
+				slug.WriteByte('-')
+			}
+			pendingDash = false
+			slug.WriteRune(r)
+			continue
+		}
+		pendingDash = true
+	}
+
+	if slug.Len() == 0 {
+		return "tag"
+	}
+	return slug.String()
+}
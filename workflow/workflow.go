@@ -0,0 +1,85 @@
+// Package workflow defines the publication states of posts and the transitions
+// between them.
+package workflow
+
+import (
+	"fmt"
+	"slices"
+)
+
+const (
+	StatusDraft     = "draft"
+	StatusInReview  = "in_review"
+	StatusPublished = "published"
+	StatusArchived  = "archived"
+)
+
+const (
+	TransitionSubmit  = "submit"
+	TransitionApprove = "approve"
+	TransitionReject  = "reject"
+	TransitionArchive = "archive"
+
+	// the scheduled transitions are applied by the scheduler at the publish_at
+	// and unpublish_at times of the posts
+	TransitionPublish   = "publish"
+	TransitionUnpublish = "unpublish"
+)
+
+const (
+	RoleViewer = "viewer"
+	RoleAuthor = "author"
+	RoleEditor = "editor"
+	RoleAdmin  = "admin"
+)
+
+// Statuses lists the statuses in their workflow order
+var Statuses = []string{StatusDraft, StatusInReview, StatusPublished, StatusArchived}
+
+// Roles lists the roles an API key can have
+var Roles = []string{RoleViewer, RoleAuthor, RoleEditor, RoleAdmin}
+
+// Transition moves a post from one of the From statuses to the To status, the
+// Scheduled ones are not applied through the API
+type Transition struct {
+	Name      string
+	From      []string
+	To        string
+	Scheduled bool
+}
+
+var transitions = map[string]Transition{
+	TransitionSubmit:  {Name: TransitionSubmit, From: []string{StatusDraft}, To: StatusInReview},
+	TransitionApprove: {Name: TransitionApprove, From: []string{StatusInReview}, To: StatusPublished},
+	TransitionReject:  {Name: TransitionReject, From: []string{StatusInReview}, To: StatusDraft},
+	TransitionArchive: {Name: TransitionArchive, From: []string{StatusDraft, StatusInReview, StatusPublished}, To: StatusArchived},
+
+	TransitionPublish:   {Name: TransitionPublish, From: []string{StatusDraft, StatusInReview}, To: StatusPublished, Scheduled: true},
+	TransitionUnpublish: {Name: TransitionUnpublish, From: []string{StatusPublished}, To: StatusArchived, Scheduled: true},
+}
+
+// Lookup returns the transition with the given name
+func Lookup(name string) (Transition, bool) {
+	transition, ok := transitions[name]
+	return transition, ok
+}
+
+// Names returns the names of the transitions applied through the API, sorted
+func Names() []string {
+	names := make([]string, 0, len(transitions))
+	for name, transition := range transitions {
+		if !transition.Scheduled {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Apply returns the status a post in status moves to with the transition
+func (t Transition) Apply(status string) (string, error) {
+	if !slices.Contains(t.From, status) {
+		return "", fmt.Errorf("cannot %s a post in status %s", t.Name, status)
+	}
+	return t.To, nil
+}